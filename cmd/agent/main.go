@@ -10,6 +10,7 @@ import (
 	"metrics-and-alerting/internal/agent"
 	"metrics-and-alerting/internal/storage/memstore"
 	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/tlsconfig"
 )
 
 var (
@@ -27,8 +28,12 @@ func ReadyConfig(logger *logpack.LogPack) *agent.Config {
 	}
 
 	cfg.ReadEnvironment()
-	if !strings.Contains(cfg.Addr, "http://") {
-		cfg.Addr = "http://" + cfg.Addr
+	if !strings.Contains(cfg.Addr, "://") {
+		if len(cfg.TLSCA) > 0 || len(cfg.TLSCert) > 0 {
+			cfg.Addr = "https://" + cfg.Addr
+		} else {
+			cfg.Addr = "http://" + cfg.Addr
+		}
 	}
 
 	fmt.Println(cfg)
@@ -46,7 +51,12 @@ func main() {
 
 	logger := logpack.NewLogger()
 	cfg := ReadyConfig(logger)
-	inMemory := memstore.New()
+	inMemory := memstore.New(memstore.WithoutHistory())
+
+	tlsConfig, errTLS := tlsconfig.Client(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+	if errTLS != nil {
+		logger.Fatal.Fatalf("could not configure TLS: %v\n", errTLS)
+	}
 
 	agentService := agent.NewAgent(
 		inMemory,
@@ -57,6 +67,17 @@ func main() {
 		agent.WithReportURL(cfg.ReportType),
 		agent.WithSignKey([]byte(cfg.SecretKey)),
 		agent.WithKey([]byte(cfg.CryptoKey)),
+		agent.WithEncryption(cfg.Encryption),
+		agent.WithInstanceID(cfg.InstanceID),
+		agent.WithLabels(cfg.Labels),
+		agent.WithTLS(tlsConfig),
+		agent.WithSpool(cfg.SpoolDir, cfg.SpoolSize),
+		agent.WithRetry(cfg.Retries, cfg.Backoff.Duration, cfg.BackoffMax.Duration),
+		agent.WithCollectors(cfg.Collectors, cfg.DisableCollectors),
+		agent.WithCollectTimeout(cfg.CollectTimeout.Duration),
+		agent.WithHostRoot(cfg.HostRoot),
+		agent.WithProcesses(cfg.Processes),
+		agent.WithExec(cfg.Exec, cfg.ExecConcurrency),
 	)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
@@ -67,4 +88,6 @@ func main() {
 
 	<-ctx.Done()
 	stop()
+
+	agentService.Wait()
 }
@@ -5,8 +5,13 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"flag"
 	"io/ioutil"
 	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/tlsconfig"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func GenerateRsaKeyPair() (*rsa.PrivateKey, *rsa.PublicKey) {
@@ -46,6 +51,34 @@ func ExportToFile(data string, file string) error {
 	return ioutil.WriteFile(file, []byte(data), 0644)
 }
 
+// GenerateCertificates Создание в каталоге dir локального CA (ca.crt, ca.key),
+// сертификата сервера для hosts (server.crt, server.key) и сертификата агента (agent.crt, agent.key)
+func GenerateCertificates(dir string, hosts []string, validFor time.Duration) error {
+
+	ca, err := tlsconfig.NewCA("metrics-and-alerting local CA", validFor)
+	if err != nil {
+		return err
+	}
+
+	serverCert, err := tlsconfig.NewServerCert(ca, hosts, validFor)
+	if err != nil {
+		return err
+	}
+
+	agentCert, err := tlsconfig.NewClientCert(ca, "metrics-agent", validFor)
+	if err != nil {
+		return err
+	}
+
+	for name, kp := range map[string]*tlsconfig.KeyPair{"ca": ca, "server": serverCert, "agent": agentCert} {
+		if err = kp.WriteFiles(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func main() {
 
 	privatePath := "private.key"
@@ -53,6 +86,22 @@ func main() {
 
 	logger := logpack.NewLogger()
 
+	certs := flag.Bool("tls", false, "bool - generate local CA, server and agent TLS certificates instead of RSA keys")
+	dir := flag.String("dir", ".", "string - directory for TLS certificates")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "string - server certificate hosts and IP addresses, comma separated")
+	validFor := flag.Duration("valid-for", 365*24*time.Hour, "duration - TLS certificates validity")
+	flag.Parse()
+
+	if *certs {
+		if err := GenerateCertificates(*dir, strings.Split(*hosts, ","), *validFor); err != nil {
+			logger.Err.Printf("failed generate TLS certificates: %v\n", err)
+			return
+		}
+
+		logger.Info.Printf("success export TLS certificates to directory: %s\n", *dir)
+		return
+	}
+
 	privateKey, publicKey := GenerateRsaKeyPair()
 
 	privatePEM := PrivateToString(privateKey)
@@ -8,12 +8,16 @@ import (
 	"time"
 
 	"metrics-and-alerting/internal/server"
+	"metrics-and-alerting/internal/server/alerting"
 	handler "metrics-and-alerting/internal/server/handlers"
+	"metrics-and-alerting/internal/server/notifier"
 	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/internal/storage/boltstore"
 	"metrics-and-alerting/internal/storage/dbstore"
 	"metrics-and-alerting/internal/storage/filestorage"
 	"metrics-and-alerting/internal/storage/memstore"
 	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/tlsconfig"
 )
 
 var (
@@ -27,6 +31,7 @@ var (
 	_ storage.Repository = (*memstore.Storage)(nil)
 	_ storage.Repository = (*filestorage.Storage)(nil)
 	_ storage.Repository = (*dbstore.Storage)(nil)
+	_ storage.Repository = (*boltstore.Storage)(nil)
 )
 
 func init() {
@@ -48,48 +53,81 @@ func main() {
 	cfg.ReadEnvVars()
 	fmt.Println(cfg)
 
-	var store storage.Repository
-	if len(cfg.DatabaseDSN) != 0 {
+	if cfg.MigrateOnly {
+		if len(cfg.DatabaseDSN) == 0 {
+			logger.Fatal.Fatalln("migrate-only mode requires DATABASE_DSN")
+		}
 
-		cfg.StoreInterval.Duration = 0
-		db, err := dbstore.New(cfg.DatabaseDSN, logger)
-		if err != nil {
-			panic(err)
+		if err := dbstore.Migrate(cfg.DatabaseDSN, logger); err != nil {
+			logger.Fatal.Fatalf("could not apply migrations: %v\n", err)
 		}
 
-		store = db
-		logger.Info.Println("Using storage: Database")
+		return
 	}
 
-	if store == nil && len(cfg.StoreFile) != 0 {
-		store = filestorage.New(cfg.StoreFile, logger)
-		logger.Info.Println("Using storage: File")
+	store, errStore := newStorage(cfg, logger)
+	if errStore != nil {
+		logger.Fatal.Fatalf("could not create storage: %v\n", errStore)
 	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Err.Printf("could not close storage: %v\n", err)
+		}
+	}()
 
-	if store == nil {
-		store = memstore.New()
-		logger.Info.Println("Using storage: Memory")
+	rules, errRules := alerting.ParseRules(cfg.AlertRules)
+	if errRules != nil {
+		logger.Fatal.Fatalf("error alert rules: %v\n", errRules)
 	}
 
-	storeManager := server.New(
-		store,
-		logger,
+	managerOpts := []server.OptionsManager{
 		server.WithSignKey([]byte(cfg.SecretKey)),
 		server.WithFlush(cfg.StoreInterval.Duration),
 		server.WithRestore(cfg.Restore),
-	)
+	}
+
+	if len(rules) > 0 {
+		var engineOpts []alerting.OptionsEngine
+
+		if len(cfg.AlertWebhooks) > 0 {
+			alertNotifier := notifier.New(
+				cfg.AlertWebhooks,
+				logger,
+				notifier.WithGroupBy(cfg.AlertGroupBy),
+				notifier.WithRepeatInterval(cfg.AlertRepeatInterval.Duration),
+				notifier.WithRetry(cfg.AlertRetries, cfg.AlertRetryBackoff.Duration),
+			)
+			defer alertNotifier.Close()
+
+			engineOpts = append(engineOpts, alerting.WithNotifier(alertNotifier))
+		}
+
+		engine := alerting.New(store, rules, logger, engineOpts...)
+		managerOpts = append(managerOpts, server.WithAlerting(engine, cfg.AlertInterval.Duration))
+		logger.Info.Printf("Loaded alert rules: %d\n", len(rules))
+	}
+
+	storeManager := server.New(store, logger, managerOpts...)
 
 	handlers := handler.New(storeManager,
 		logger,
 		handler.WithKey(cfg.CryptoKey),
 		handler.WithTrustedSubnet(cfg.TrustedSubnet))
 
-	serv := server.NewHTTPServer(cfg.Addr, handlers)
+	tlsConfig, errTLS := tlsconfig.Server(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+	if errTLS != nil {
+		logger.Fatal.Fatalf("could not configure TLS: %v\n", errTLS)
+	}
+
+	serv := server.NewHTTPServer(cfg.Addr, handlers, server.WithTLS(tlsConfig))
 	serv.Start()
 	logger.Info.Println("HTTP server started")
 
 	if len(cfg.AddrRPC) != 0 {
-		gServ, errServ := server.NewGRPCServer(cfg.AddrRPC, storeManager)
+		gServ, errServ := server.NewGRPCServer(cfg.AddrRPC,
+			storeManager,
+			server.WithTrustedSubnet(cfg.TrustedSubnet),
+			server.WithGRPCTLS(tlsConfig))
 		if errServ != nil {
 			logger.Err.Fatalf("failed create gRPC server: %v\n", errServ)
 		}
@@ -112,3 +150,52 @@ func main() {
 	cancel()
 
 }
+
+// newStorage Создание хранилища по STORE_ENGINE.
+// Если движок не задан, используется PostgreSQL при заданном DATABASE_DSN, файл при заданном STORE_FILE, иначе память.
+func newStorage(cfg *server.Config, logger *logpack.LogPack) (storage.Repository, error) {
+
+	engine := cfg.StoreEngine
+	if len(engine) == 0 {
+		switch {
+		case len(cfg.DatabaseDSN) != 0:
+			engine = server.EnginePostgres
+		case len(cfg.StoreFile) != 0:
+			engine = server.EngineFile
+		default:
+			engine = server.EngineMemory
+		}
+	}
+
+	switch engine {
+	case server.EnginePostgres:
+		cfg.StoreInterval.Duration = 0
+		logger.Info.Println("Using storage: Database")
+		return dbstore.New(cfg.DatabaseDSN, logger, dbstore.WithRetention(cfg.Retention.Duration))
+
+	case server.EngineFile:
+		logger.Info.Println("Using storage: File")
+
+		opts := []filestorage.OptionsStorage{
+			filestorage.WithRetention(cfg.Retention.Duration),
+			filestorage.WithSync(cfg.StoreSync),
+		}
+
+		// При STORE_INTERVAL=0 Flush вызывается после каждого изменения, которое уже сохранено в журнале
+		if cfg.StoreInterval.Duration == 0 {
+			opts = append(opts, filestorage.WithWALLimit(filestorage.DefaultWALLimit))
+		}
+
+		return filestorage.New(cfg.StoreFile, logger, opts...), nil
+
+	case server.EngineBolt:
+		logger.Info.Printf("Using storage: Bolt (%s)\n", cfg.StoreBoltFile)
+		return boltstore.New(cfg.StoreBoltFile, logger, boltstore.WithRetention(cfg.Retention.Duration))
+
+	case server.EngineMemory:
+		logger.Info.Println("Using storage: Memory")
+		return memstore.New(memstore.WithRetention(cfg.Retention.Duration)), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage engine: %s", engine)
+}
@@ -2,15 +2,20 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/envelope"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"metrics-and-alerting/internal/agent/services/reporter"
 	"metrics-and-alerting/internal/agent/services/scanner"
+	"metrics-and-alerting/internal/agent/services/spool"
 	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/pkg/logpack"
 	"metrics-and-alerting/pkg/metric"
@@ -18,6 +23,9 @@ import (
 
 type OptionsAgent func(*Agent)
 
+// defaultSpoolSize Размер очереди неотправленных пакетов, если он не задан в конфигурации
+const defaultSpoolSize = 100
+
 type Agent struct {
 	reportInterval time.Duration
 	pollInterval   time.Duration
@@ -25,8 +33,27 @@ type Agent struct {
 	reportType     string
 	signKey        []byte
 	publicKey      []byte
+	encryption     string
+	instanceID     string
+	labels         map[string]string
 	storage        storage.Repository
+	storeMu        *sync.Mutex
+	stopped        *sync.WaitGroup // сбор метрик, завершается после отмены контекста Start
 	conn           *grpc.ClientConn
+	tlsConfig      *tls.Config
+	spoolDir       string
+	spoolSize      int
+	retries        int
+	backoff        time.Duration
+	backoffMax     time.Duration
+	enabled        []string
+	disabled       []string
+	collectTimeout time.Duration
+	hostRoot       string
+	processes      map[string]string
+	exec           []ExecCommand
+	execLimit      int
+	collectors     []scanner.Collector
 	logger         *logpack.LogPack
 }
 
@@ -34,7 +61,10 @@ type Agent struct {
 // Используется паттерн "Функциональные опции"
 func NewAgent(storage storage.Repository, opts ...OptionsAgent) *Agent {
 	a := &Agent{
-		storage: storage,
+		storage:   storage,
+		storeMu:   &sync.Mutex{},
+		stopped:   &sync.WaitGroup{},
+		spoolSize: defaultSpoolSize,
 	}
 
 	for _, opt := range opts {
@@ -86,6 +116,96 @@ func WithKey(key []byte) OptionsAgent {
 	}
 }
 
+// WithEncryption Схема шифрования данных открытым ключом: envelope или legacy
+func WithEncryption(scheme string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.encryption = scheme
+	}
+}
+
+// WithInstanceID Идентификатор экземпляра агента, который передается в метке instance
+func WithInstanceID(id string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.instanceID = id
+	}
+}
+
+// WithLabels Статические метки, которые добавляются ко всем отправляемым метрикам
+func WithLabels(labels map[string]string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.labels = labels
+	}
+}
+
+// WithTLS Настройки TLS для соединений с сервером по HTTPS и gRPC
+func WithTLS(cfg *tls.Config) OptionsAgent {
+	return func(agent *Agent) {
+		agent.tlsConfig = cfg
+	}
+}
+
+// WithSpool Каталог и размер (в пакетах) очереди неотправленных метрик.
+// Если каталог не задан, очередь хранится в памяти. Размер меньше 1 заменяется размером по умолчанию.
+func WithSpool(dir string, size int) OptionsAgent {
+	return func(agent *Agent) {
+		agent.spoolDir = dir
+
+		if size > 0 {
+			agent.spoolSize = size
+		} else {
+			agent.spoolSize = defaultSpoolSize
+		}
+	}
+}
+
+// WithRetry Число повторов отправки пакета и границы задержки между повторами
+func WithRetry(retries int, backoff, backoffMax time.Duration) OptionsAgent {
+	return func(agent *Agent) {
+		agent.retries = retries
+		agent.backoff = backoff
+		agent.backoffMax = backoffMax
+	}
+}
+
+// WithCollectors Включение и отключение сборщиков метрик по имени.
+// Пустой список enabled включает все встроенные сборщики.
+func WithCollectors(enabled, disabled []string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.enabled = enabled
+		agent.disabled = disabled
+	}
+}
+
+// WithCollectTimeout Ограничение времени работы одного сборщика метрик
+func WithCollectTimeout(timeout time.Duration) OptionsAgent {
+	return func(agent *Agent) {
+		agent.collectTimeout = timeout
+	}
+}
+
+// WithHostRoot Корень файловой системы хоста, в которой сборщики читают /proc и /sys
+func WithHostRoot(root string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.hostRoot = root
+	}
+}
+
+// WithProcesses Группы процессов для сборщика process: имя группы и регулярное выражение
+// для имени или командной строки процесса либо pidfile:<путь>
+func WithProcesses(processes map[string]string) OptionsAgent {
+	return func(agent *Agent) {
+		agent.processes = processes
+	}
+}
+
+// WithExec Команды сборщика exec и число одновременно выполняемых команд
+func WithExec(commands []ExecCommand, concurrency int) OptionsAgent {
+	return func(agent *Agent) {
+		agent.exec = commands
+		agent.execLimit = concurrency
+	}
+}
+
 // Start Запуск агента для сбора и отправки метрик
 func (a Agent) Start(ctx context.Context) error {
 
@@ -101,6 +221,16 @@ func (a Agent) Start(ctx context.Context) error {
 		return fmt.Errorf("could not start agent: not setted report type")
 	}
 
+	switch a.encryption {
+	case "", envelope.SchemeEnvelope, envelope.SchemeLegacy:
+	default:
+		return fmt.Errorf("could not start agent: unknown encryption scheme %q", a.encryption)
+	}
+
+	if err := a.selectCollectors(); err != nil {
+		return fmt.Errorf("could not start agent: %w", err)
+	}
+
 	if a.reportType == reporter.ReportAsGRPC {
 		parts := strings.Split(a.addr, ":")
 		if len(parts) == 0 {
@@ -108,38 +238,136 @@ func (a Agent) Start(ctx context.Context) error {
 		}
 
 		var errConn error
-		a.conn, errConn = grpc.Dial(":"+parts[len(parts)-1], grpc.WithTransportCredentials(insecure.NewCredentials()))
+		a.conn, errConn = grpc.Dial(":"+parts[len(parts)-1], grpc.WithTransportCredentials(a.transportCredentials()))
 		if errConn != nil {
 			return fmt.Errorf("failed create gRPC client connection: %w", errConn)
 		}
 	}
 
+	queue, err := a.openSpool()
+	if err != nil {
+		return fmt.Errorf("could not start agent: %w", err)
+	}
+
+	a.stopped.Add(1)
 	go a.updateMetrics(ctx)
-	go a.reportMetrics(ctx)
+	go a.reportMetrics(ctx, queue)
 
 	return nil
 }
 
+// Wait Ожидание остановки сбора метрик после отмены контекста Start,
+// в том числе завершения прерванных команд сборщика exec
+func (a *Agent) Wait() {
+	a.stopped.Wait()
+}
+
+// selectCollectors Встроенные сборщики и сборщики из конфигурации, включенные в конфигурации
+func (a *Agent) selectCollectors() error {
+
+	collectors := scanner.Builtin(a.hostRoot)
+
+	if len(a.processes) > 0 {
+		selectors, err := scanner.ParseProcessSelectors(a.processes)
+		if err != nil {
+			return err
+		}
+
+		collectors = append(collectors, scanner.NewProcessCollector(a.hostRoot, selectors))
+	}
+
+	if len(a.exec) > 0 {
+		commands := make([]scanner.ExecCommand, 0, len(a.exec))
+		for _, command := range a.exec {
+			commands = append(commands, scanner.ExecCommand{
+				Name:     command.Name,
+				Command:  command.Command,
+				Interval: command.Interval.Duration,
+				Timeout:  command.Timeout.Duration,
+				Format:   command.Format,
+			})
+		}
+
+		execCollector, err := scanner.NewExecCollector(commands, a.execLimit)
+		if err != nil {
+			return err
+		}
+
+		collectors = append(collectors, execCollector)
+	}
+
+	var err error
+	a.collectors, err = scanner.Select(collectors, a.enabled, a.disabled)
+
+	return err
+}
+
+// transportCredentials Параметры соединения gRPC: TLS, если он настроен, иначе без шифрования.
+// Сертификат сервера проверяется по имени хоста из адреса сервера.
+func (a Agent) transportCredentials() credentials.TransportCredentials {
+
+	if a.tlsConfig == nil {
+		return insecure.NewCredentials()
+	}
+
+	cfg := a.tlsConfig.Clone()
+	if len(cfg.ServerName) == 0 {
+		cfg.ServerName = "localhost"
+
+		if u, err := url.Parse(a.addr); err == nil && len(u.Hostname()) > 0 {
+			cfg.ServerName = u.Hostname()
+		}
+	}
+
+	return credentials.NewTLS(cfg)
+}
+
 func (a *Agent) updateMetrics(ctx context.Context) {
 
-	scan := scanner.NewScanner(a.storage)
+	defer a.stopped.Done()
+
+	store := lockedStorage{Repository: a.storage, mu: a.storeMu}
+	scan := scanner.NewScanner(store, scanner.WithCollectors(a.collectors...), scanner.WithTimeout(a.collectTimeout))
 	ticker := time.NewTicker(a.pollInterval)
 
 	for {
 		select {
 
 		case <-ticker.C:
-			if err := scan.Scan(); err != nil {
+			if err := scan.Scan(ctx); err != nil {
 				a.logger.Err.Printf("scan task failed with error: %v\n", err)
 			}
 
 		case <-ctx.Done():
+			if err := scan.Close(); err != nil {
+				a.logger.Err.Printf("could not stop collectors: %v\n", err)
+			}
+
 			return
 		}
 	}
 }
 
-func (a *Agent) reportMetrics(ctx context.Context) {
+// openSpool Открытие очереди неотправленных пакетов.
+// Если каталог очереди недоступен, пакеты хранятся в памяти до перезапуска агента.
+func (a *Agent) openSpool() (*spool.Spool, error) {
+
+	queue, err := spool.New(a.spoolDir, a.spoolSize)
+	if err == nil {
+		return queue, nil
+	}
+
+	a.logger.Err.Printf("could not open spool %s, use in-memory spool: %v\n", a.spoolDir, err)
+
+	queue, err = spool.New("", a.spoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not open in-memory spool: %w", err)
+	}
+
+	return queue, nil
+}
+
+func (a *Agent) reportMetrics(ctx context.Context, queue *spool.Spool) {
 
 	report := reporter.NewReporter(
 		a.addr,
@@ -147,7 +375,17 @@ func (a *Agent) reportMetrics(ctx context.Context) {
 		a.logger,
 		reporter.WithSignKey(a.signKey),
 		reporter.WithKey(a.publicKey),
-		reporter.WithRPC(a.conn))
+		reporter.WithEncryption(a.encryption),
+		reporter.WithRPC(a.conn),
+		reporter.WithTLS(a.tlsConfig),
+		reporter.WithInstanceID(a.instanceID),
+		reporter.WithLabels(a.labels))
+
+	send := func(ctx context.Context, metrics []metric.Metric) error {
+		return report.Send(ctx, a.reportType, metrics)
+	}
+
+	delivery := reporter.NewDelivery(send, queue, a.logger, reporter.WithRetry(a.retries, a.backoff, a.backoffMax))
 
 	ticker := time.NewTicker(a.reportInterval)
 
@@ -155,14 +393,15 @@ func (a *Agent) reportMetrics(ctx context.Context) {
 		select {
 
 		case <-ticker.C:
-			if err := report.Report(ctx, a.reportType); err != nil {
-				a.logger.Err.Printf("report failed with error: %v\n", err)
+			batch, err := a.snapshot(delivery)
+			if err != nil {
+				a.logger.Err.Printf("could not collect metrics for report: %v\n", err)
+				continue
 			}
 
-			// Сброс значения метрики PollCount
-			pollCount, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(0))
-			if err := a.storage.Delete(pollCount); err != nil && err != errs.ErrNotFound {
-				a.logger.Err.Printf("error delete metric %s after report: %v\n", pollCount.ShotString(), err)
+			if err = delivery.Deliver(ctx, batch); err != nil {
+				stats := delivery.Stats()
+				a.logger.Err.Printf("report failed with error: %v (pending batches: %d)\n", err, stats.Pending)
 			}
 
 		case <-ctx.Done():
@@ -177,3 +416,70 @@ func (a *Agent) reportMetrics(ctx context.Context) {
 		}
 	}
 }
+
+// snapshot Снимок метрик хранилища для отправки вместе со статистикой доставки.
+// Попавшие в снимок значения счетчиков вычитаются из хранилища, а гистограммы обнуляются,
+// поэтому приращения, сделанные после снимка, уйдут в следующем пакете, а не потеряются.
+func (a *Agent) snapshot(delivery *reporter.Delivery) ([]metric.Metric, error) {
+
+	a.storeMu.Lock()
+	defer a.storeMu.Unlock()
+
+	metrics, err := a.storage.GetBatch()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range metrics {
+		switch {
+		case m.MType == metric.CounterType && m.Delta != nil && *m.Delta != 0:
+			reset := m
+			delta := -*m.Delta
+			reset.Delta = &delta
+
+			if _, err = a.storage.Add(reset); err != nil {
+				a.logger.Err.Printf("error reset counter %s after snapshot: %v\n", m.ShotString(), err)
+			}
+
+		case m.MType == metric.HistogramType && m.Histogram != nil && m.Histogram.Count != 0:
+			reset := m
+			if reset.Histogram, err = metric.NewHistogram(m.Histogram.Bounds); err == nil {
+				err = a.storage.Upsert(reset)
+			}
+
+			if err != nil {
+				a.logger.Err.Printf("error reset histogram %s after snapshot: %v\n", m.ShotString(), err)
+			}
+		}
+	}
+
+	return append(metrics, delivery.Metrics()...), nil
+}
+
+// lockedStorage Хранилище агента для сборщиков. Запись не пересекается со снимком для отправки,
+// иначе наблюдения гистограмм между чтением снимка и обнулением были бы потеряны
+type lockedStorage struct {
+	storage.Repository
+	mu *sync.Mutex
+}
+
+func (s lockedStorage) Upsert(m metric.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Repository.Upsert(m)
+}
+
+func (s lockedStorage) UpsertBatch(metrics []metric.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Repository.UpsertBatch(metrics)
+}
+
+func (s lockedStorage) Add(m metric.Metric) (metric.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Repository.Add(m)
+}
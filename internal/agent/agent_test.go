@@ -1,5 +1,20 @@
 package agent
 
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metrics-and-alerting/internal/agent/services/reporter"
+	"metrics-and-alerting/internal/agent/services/spool"
+	"metrics-and-alerting/internal/storage/memstore"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 /*
 import (
 	"context"
@@ -119,3 +134,115 @@ func TestAgent_report(t *testing.T) {
 	server.Close()
 }
 */
+
+func TestAgent_Snapshot(t *testing.T) {
+
+	store := memstore.New()
+	a := NewAgent(store, WithLogger(logpack.NewLogger()))
+
+	queue, err := spool.New("", 10)
+	require.NoError(t, err)
+	delivery := reporter.NewDelivery(nil, queue, a.logger)
+
+	counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(3))
+	_, err = store.Add(counter)
+	require.NoError(t, err)
+
+	batch, err := a.snapshot(delivery)
+	require.NoError(t, err)
+
+	var snapshotted int64
+	for _, m := range batch {
+		if m.ID == "PollCount" {
+			snapshotted = *m.Delta
+		}
+	}
+	assert.Equal(t, int64(3), snapshotted)
+
+	// Приращение после снимка уходит в следующий пакет
+	counter, _ = metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(2))
+	_, err = store.Add(counter)
+	require.NoError(t, err)
+
+	got, err := store.Get(counter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *got.Delta)
+
+	// Гистограмма после снимка обнуляется, следующие наблюдения сливаются с пустой
+	histogram, _ := metric.CreateMetric(metric.HistogramType, "Latency", metric.WithBuckets([]float64{1}))
+	histogram.Histogram.Observe(0.5)
+	_, err = store.Add(histogram)
+	require.NoError(t, err)
+
+	batch, err = a.snapshot(delivery)
+	require.NoError(t, err)
+
+	var observed uint64
+	for _, m := range batch {
+		if m.ID == "Latency" {
+			observed = m.Histogram.Count
+		}
+	}
+	assert.Equal(t, uint64(1), observed)
+
+	got, err = store.Get(histogram)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), got.Histogram.Count)
+
+	_, err = store.Add(histogram)
+	require.NoError(t, err)
+
+	got, err = store.Get(histogram)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 0}, got.Histogram.Counts)
+}
+
+func TestAgent_SelectCollectors(t *testing.T) {
+
+	a := NewAgent(memstore.New(),
+		WithProcesses(map[string]string{"web": "^nginx$"}),
+		WithCollectors([]string{"runtime", "process"}, nil))
+	require.NoError(t, a.selectCollectors())
+	require.Len(t, a.collectors, 2)
+	assert.Equal(t, "process", a.collectors[1].Name())
+
+	a = NewAgent(memstore.New(), WithCollectors([]string{"process"}, nil))
+	assert.Error(t, a.selectCollectors())
+
+	a = NewAgent(memstore.New(), WithProcesses(map[string]string{"bad": "("}))
+	assert.Error(t, a.selectCollectors())
+
+	a = NewAgent(memstore.New(),
+		WithExec([]ExecCommand{{Name: "check", Command: "true"}}, 2),
+		WithCollectors([]string{"exec"}, nil))
+	require.NoError(t, a.selectCollectors())
+	require.Len(t, a.collectors, 1)
+	assert.Equal(t, "exec", a.collectors[0].Name())
+
+	a = NewAgent(memstore.New(), WithExec([]ExecCommand{{Name: "check", Command: "true", Format: "xml"}}, 2))
+	assert.Error(t, a.selectCollectors())
+}
+
+func TestAgent_OpenSpool(t *testing.T) {
+
+	// Без WithSpool и с нулевым размером используется размер очереди по умолчанию
+	for _, a := range []*Agent{
+		NewAgent(memstore.New(), WithLogger(logpack.NewLogger())),
+		NewAgent(memstore.New(), WithLogger(logpack.NewLogger()), WithSpool("", 0)),
+	} {
+		queue, err := a.openSpool()
+		require.NoError(t, err)
+		require.NotNil(t, queue)
+		assert.Equal(t, defaultSpoolSize, a.spoolSize)
+	}
+
+	// Недоступный каталог заменяется очередью в памяти
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+
+	a := NewAgent(memstore.New(), WithLogger(logpack.NewLogger()), WithSpool(filepath.Join(file, "spool"), 5))
+	queue, err := a.openSpool()
+	require.NoError(t, err)
+	require.NoError(t, queue.Push([]metric.Metric{}))
+	assert.Equal(t, 1, queue.Len())
+}
@@ -1,42 +1,233 @@
 package agent
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"metrics-and-alerting/internal/agent/services/reporter"
+	"metrics-and-alerting/pkg/envelope"
 
 	"github.com/caarlos0/env"
 )
 
 type Config struct {
-	Addr           string   `env:"ADDRESS"         json:"address"        `
-	ReportInterval Duration `env:"REPORT_INTERVAL" json:"report_interval"`
-	PollInterval   Duration `env:"POLL_INTERVAL"   json:"poll_interval"  `
-	ReportType     string   `env:"REPORT_TYPE"     json:"report_type"    `
-	SecretKey      string   `env:"KEY"             json:"key"            `
-	CryptoKey      string   `env:"CRYPTO_KEY"      json:"crypto_key"     `
-	ConfigFile     string   `env:"CONFIG"`
+	Addr              string        `env:"ADDRESS"            json:"address"           `
+	ReportInterval    Duration      `env:"REPORT_INTERVAL"    json:"report_interval"   `
+	PollInterval      Duration      `env:"POLL_INTERVAL"      json:"poll_interval"     `
+	ReportType        string        `env:"REPORT_TYPE"        json:"report_type"       `
+	SecretKey         string        `env:"KEY"                json:"key"               `
+	CryptoKey         string        `env:"CRYPTO_KEY"         json:"crypto_key"        `
+	Encryption        string        `env:"ENCRYPTION"         json:"encryption"        `
+	InstanceID        string        `env:"INSTANCE_ID"        json:"instance_id"       `
+	Labels            Labels        `env:"LABELS"             json:"labels"            `
+	TLSCA             string        `env:"TLS_CA"             json:"tls_ca"            `
+	TLSCert           string        `env:"TLS_CERT"           json:"tls_cert"          `
+	TLSKey            string        `env:"TLS_KEY"            json:"tls_key"           `
+	SpoolDir          string        `env:"SPOOL_DIR"          json:"spool_dir"         `
+	SpoolSize         int           `env:"SPOOL_SIZE"         json:"spool_size"        `
+	Retries           int           `env:"REPORT_RETRIES"     json:"report_retries"    `
+	Backoff           Duration      `env:"REPORT_BACKOFF"     json:"report_backoff"    `
+	BackoffMax        Duration      `env:"REPORT_BACKOFF_MAX" json:"report_backoff_max"`
+	Collectors        []string      `env:"COLLECTORS"         json:"collectors"        `
+	DisableCollectors []string      `env:"DISABLE_COLLECTORS" json:"disable_collectors"`
+	CollectTimeout    Duration      `env:"COLLECT_TIMEOUT"    json:"collect_timeout"   `
+	HostRoot          string        `env:"HOST_ROOT"          json:"host_root"         `
+	Processes         Processes     `env:"PROCESSES"          json:"processes"         `
+	Exec              []ExecCommand `env:"EXEC_COMMANDS"      json:"exec_commands"     `
+	ExecConcurrency   int           `env:"EXEC_CONCURRENCY"   json:"exec_concurrency"  `
+	ConfigFile        string        `env:"CONFIG"`
 }
 
+// Labels Статические метки, добавляемые ко всем отправляемым метрикам
+// В переменной окружения и аргументах командной строки задаются в формате: <name>=<value>,<name>=<value>
+type Labels map[string]string
+
 // DefaultConfig Конфигурация для сервиса агента со значениями по умолчанию
 func DefaultConfig() *Config {
 
 	return &Config{
-		Addr:           ":8080",
-		ReportInterval: Duration{Duration: 10 * time.Second},
-		PollInterval:   Duration{Duration: 2 * time.Second},
-		ReportType:     reporter.ReportAsBatchJSON,
-		SecretKey:      "",
-		CryptoKey:      "",
+		Addr:            ":8080",
+		ReportInterval:  Duration{Duration: 10 * time.Second},
+		PollInterval:    Duration{Duration: 2 * time.Second},
+		ReportType:      reporter.ReportAsBatchJSON,
+		SecretKey:       "",
+		CryptoKey:       "",
+		Encryption:      envelope.SchemeEnvelope,
+		InstanceID:      newInstanceID(),
+		SpoolDir:        filepath.Join(os.TempDir(), "metrics-agent-spool"),
+		SpoolSize:       100,
+		Retries:         3,
+		Backoff:         Duration{Duration: time.Second},
+		BackoffMax:      Duration{Duration: 30 * time.Second},
+		CollectTimeout:  Duration{Duration: 10 * time.Second},
+		HostRoot:        "/",
+		ExecConcurrency: 4,
+	}
+}
+
+// newInstanceID Случайный идентификатор экземпляра агента
+func newInstanceID() string {
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("could not generate instance id: %v\n", err)
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// UnmarshalText Разбор меток из строки формата <name>=<value>,<name>=<value>
+func (labels *Labels) UnmarshalText(text []byte) error {
+
+	parsed := make(Labels)
+
+	for _, pair := range strings.Split(string(text), ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return fmt.Errorf("invalid label %q: need format name=value", pair)
+		}
+
+		parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	*labels = parsed
+	return nil
+}
+
+// UnmarshalJSON Разбор меток из JSON объекта или строки формата <name>=<value>,<name>=<value>
+func (labels *Labels) UnmarshalJSON(b []byte) error {
+
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		return labels.UnmarshalText([]byte(text))
+	}
+
+	var parsed map[string]string
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+
+	*labels = parsed
+	return nil
+}
+
+// String Метки в формате <name>=<value>,<name>=<value>, отсортированные по имени
+func (labels Labels) String() string {
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+labels[name])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Set Реализация интерфейса flag.Value
+func (labels *Labels) Set(value string) error {
+	return labels.UnmarshalText([]byte(value))
+}
+
+// Processes Группы процессов для сборщика process: имя группы и регулярное выражение для имени
+// или командной строки процесса либо pidfile:<путь>.
+// В переменной окружения и аргументах командной строки задаются в формате: <name>=<selector>,<name>=<selector>
+type Processes map[string]string
+
+// UnmarshalText Разбор групп процессов из строки формата <name>=<selector>,<name>=<selector>
+func (processes *Processes) UnmarshalText(text []byte) error {
+	return (*Labels)(processes).UnmarshalText(text)
+}
+
+// UnmarshalJSON Разбор групп процессов из JSON объекта или строки формата <name>=<selector>,<name>=<selector>
+func (processes *Processes) UnmarshalJSON(b []byte) error {
+	return (*Labels)(processes).UnmarshalJSON(b)
+}
+
+func (processes Processes) String() string {
+	return Labels(processes).String()
+}
+
+// Set Реализация интерфейса flag.Value
+func (processes *Processes) Set(value string) error {
+	return processes.UnmarshalText([]byte(value))
+}
+
+// ExecCommand Команда сборщика exec, метрики которой читаются из стандартного вывода
+// В переменной окружения и аргументах командной строки задается в формате <name>=<command>,
+// интервал, ограничение времени и формат вывода задаются только в JSON конфигурации.
+type ExecCommand struct {
+	Name     string   `json:"name"`
+	Command  string   `json:"command"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+	Format   string   `json:"format"`
+}
+
+// UnmarshalText Разбор команды из строки формата <name>=<command>
+func (command *ExecCommand) UnmarshalText(text []byte) error {
+
+	parts := strings.SplitN(string(text), "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+		return fmt.Errorf("invalid exec command %q: need format name=command", text)
+	}
+
+	*command = ExecCommand{Name: strings.TrimSpace(parts[0]), Command: strings.TrimSpace(parts[1])}
+	return nil
+}
+
+// UnmarshalJSON Разбор команды из JSON объекта или строки формата <name>=<command>
+func (command *ExecCommand) UnmarshalJSON(b []byte) error {
+
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		return command.UnmarshalText([]byte(text))
+	}
+
+	type plain ExecCommand
+
+	var parsed plain
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
 	}
+
+	*command = ExecCommand(parsed)
+	return nil
+}
+
+// splitNames Разбор списка имен через запятую, например сборщиков метрик: runtime,workload
+func splitNames(text string) []string {
+
+	names := make([]string, 0)
+	for _, name := range strings.Split(text, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	return names
 }
 
 type Duration struct {
@@ -72,9 +263,42 @@ func (cfg *Config) ParseFlags() error {
 	flag.DurationVar(&cfg.PollInterval.Duration, "p", cfg.PollInterval.Duration, "poll interval (duration)")
 	flag.StringVar(&cfg.SecretKey, "k", cfg.SecretKey, "string - secret key for sign metrics")
 	flag.StringVar(&cryptoPath, "crypto-key", cfg.CryptoKey, "string - path to file with public crypto key")
+	flag.StringVar(&cfg.Encryption, "encryption", cfg.Encryption, fmt.Sprint("string - payload encryption scheme: ",
+		envelope.SchemeEnvelope, "|", envelope.SchemeLegacy))
 	flag.StringVar(&cfg.ReportType, "rt", cfg.ReportType, fmt.Sprint("support types: ",
 		reporter.ReportAsURL, "|", reporter.ReportAsJSON, "|", reporter.ReportAsBatchJSON, "|", reporter.ReportAsGRPC))
 	flag.StringVar(&cfg.ConfigFile, "c", cfg.ConfigFile, "string - path to config in JSON format")
+	flag.StringVar(&cfg.InstanceID, "id", cfg.InstanceID, "string - agent instance id")
+	flag.Var(&cfg.Labels, "l", "string - static labels: name=value,name=value")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", cfg.TLSCA, "string - path to CA certificate for server verification (HTTP and gRPC)")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "string - path to agent TLS certificate for mTLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "string - path to agent TLS private key for mTLS")
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", cfg.SpoolDir, "string - directory for unsent batches, empty for in-memory spool")
+	flag.IntVar(&cfg.SpoolSize, "spool-size", cfg.SpoolSize, "int - max unsent batches in spool, oldest are dropped")
+	flag.IntVar(&cfg.Retries, "retries", cfg.Retries, "int - retries of batch sending per report")
+	flag.DurationVar(&cfg.Backoff.Duration, "backoff", cfg.Backoff.Duration, "initial delay between retries (duration)")
+	flag.DurationVar(&cfg.BackoffMax.Duration, "backoff-max", cfg.BackoffMax.Duration, "max delay between retries (duration)")
+	flag.Func("collectors", "string - enabled collectors, empty for all: name,name", func(value string) error {
+		cfg.Collectors = splitNames(value)
+		return nil
+	})
+	flag.Func("disable-collectors", "string - disabled collectors: name,name", func(value string) error {
+		cfg.DisableCollectors = splitNames(value)
+		return nil
+	})
+	flag.DurationVar(&cfg.CollectTimeout.Duration, "collect-timeout", cfg.CollectTimeout.Duration, "timeout of one collector run (duration)")
+	flag.Var(&cfg.Processes, "processes", "string - process groups for process collector: name=regexp,name=pidfile:path")
+	flag.Func("exec", "string - command for exec collector: name=command (repeatable)", func(value string) error {
+		var command ExecCommand
+		if err := command.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+
+		cfg.Exec = append(cfg.Exec, command)
+		return nil
+	})
+	flag.IntVar(&cfg.ExecConcurrency, "exec-concurrency", cfg.ExecConcurrency, "int - max commands of exec collector running at once")
+	flag.StringVar(&cfg.HostRoot, "host-root", cfg.HostRoot, "string - host filesystem root with /proc and /sys")
 	addr := flag.String("a", "", "ip address: ip:port")
 	flag.Parse()
 
@@ -147,6 +371,10 @@ func (cfg *Config) ReadEnvironment() {
 
 	// Удаление пробелов из адреса
 	cfg.Addr = strings.TrimSpace(cfg.Addr)
+
+	// Удаление пробелов и пустых имен из списков сборщиков
+	cfg.Collectors = splitNames(strings.Join(cfg.Collectors, ","))
+	cfg.DisableCollectors = splitNames(strings.Join(cfg.DisableCollectors, ","))
 }
 
 func (cfg Config) String() string {
@@ -159,9 +387,29 @@ func (cfg Config) String() string {
 	builder.WriteString(fmt.Sprintf("\t POLL_INTERVAL: %s\n", cfg.PollInterval.String()))
 	builder.WriteString(fmt.Sprintf("\t REPORT_TYPE: %s\n", cfg.ReportType))
 	builder.WriteString(fmt.Sprintf("\t KEY: %s\n", cfg.SecretKey))
+	builder.WriteString(fmt.Sprintf("\t INSTANCE_ID: %s\n", cfg.InstanceID))
+	builder.WriteString(fmt.Sprintf("\t LABELS: %s\n", cfg.Labels.String()))
+	builder.WriteString(fmt.Sprintf("\t TLS_CA: %s\n", cfg.TLSCA))
+	builder.WriteString(fmt.Sprintf("\t TLS_CERT: %s\n", cfg.TLSCert))
+	builder.WriteString(fmt.Sprintf("\t TLS_KEY: %s\n", cfg.TLSKey))
+	builder.WriteString(fmt.Sprintf("\t SPOOL_DIR: %s\n", cfg.SpoolDir))
+	builder.WriteString(fmt.Sprintf("\t SPOOL_SIZE: %d\n", cfg.SpoolSize))
+	builder.WriteString(fmt.Sprintf("\t REPORT_RETRIES: %d\n", cfg.Retries))
+	builder.WriteString(fmt.Sprintf("\t REPORT_BACKOFF: %s\n", cfg.Backoff.String()))
+	builder.WriteString(fmt.Sprintf("\t REPORT_BACKOFF_MAX: %s\n", cfg.BackoffMax.String()))
+	builder.WriteString(fmt.Sprintf("\t COLLECTORS: %s\n", strings.Join(cfg.Collectors, ",")))
+	builder.WriteString(fmt.Sprintf("\t DISABLE_COLLECTORS: %s\n", strings.Join(cfg.DisableCollectors, ",")))
+	builder.WriteString(fmt.Sprintf("\t COLLECT_TIMEOUT: %s\n", cfg.CollectTimeout.String()))
+	builder.WriteString(fmt.Sprintf("\t HOST_ROOT: %s\n", cfg.HostRoot))
+	builder.WriteString(fmt.Sprintf("\t PROCESSES: %s\n", cfg.Processes.String()))
+	for _, command := range cfg.Exec {
+		builder.WriteString(fmt.Sprintf("\t EXEC: %s=%s\n", command.Name, command.Command))
+	}
+	builder.WriteString(fmt.Sprintf("\t EXEC_CONCURRENCY: %d\n", cfg.ExecConcurrency))
 
 	if len(cfg.CryptoKey) != 0 {
 		builder.WriteString("\t CRYPTO_KEY: USE\n")
+		builder.WriteString(fmt.Sprintf("\t ENCRYPTION: %s\n", cfg.Encryption))
 	}
 
 	return builder.String()
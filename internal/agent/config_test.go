@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels_Unmarshal(t *testing.T) {
+
+	var fromText Labels
+	require.NoError(t, fromText.UnmarshalText([]byte("dc=eu, rack = r1,")))
+	assert.Equal(t, Labels{"dc": "eu", "rack": "r1"}, fromText)
+	assert.Equal(t, "dc=eu,rack=r1", fromText.String())
+
+	assert.Error(t, fromText.UnmarshalText([]byte("dc")))
+
+	var cfg Config
+	require.NoError(t, json.Unmarshal([]byte(`{"labels": {"dc": "us"}}`), &cfg))
+	assert.Equal(t, Labels{"dc": "us"}, cfg.Labels)
+}
+
+func TestSplitNames(t *testing.T) {
+	assert.Equal(t, []string{"runtime", "workload"}, splitNames(" runtime, ,workload,"))
+	assert.Empty(t, splitNames(""))
+}
+
+func TestProcesses_Unmarshal(t *testing.T) {
+
+	var fromText Processes
+	require.NoError(t, fromText.Set("web=^nginx$, db=pidfile:/run/postgres.pid"))
+	assert.Equal(t, Processes{"web": "^nginx$", "db": "pidfile:/run/postgres.pid"}, fromText)
+
+	var cfg Config
+	require.NoError(t, json.Unmarshal([]byte(`{"processes": {"billing": "java .*billing\\.jar"}}`), &cfg))
+	assert.Equal(t, Processes{"billing": `java .*billing\.jar`}, cfg.Processes)
+}
+
+func TestExecCommand_Unmarshal(t *testing.T) {
+
+	var cfg Config
+	require.NoError(t, json.Unmarshal([]byte(`{"exec_commands": [
+		"disk=/usr/local/bin/check_disk.sh",
+		{"name": "queue", "command": "curl -s localhost:9100/metrics", "interval": "30s", "timeout": "5s", "format": "prometheus"}
+	]}`), &cfg))
+
+	require.Len(t, cfg.Exec, 2)
+	assert.Equal(t, ExecCommand{Name: "disk", Command: "/usr/local/bin/check_disk.sh"}, cfg.Exec[0])
+	assert.Equal(t, "queue", cfg.Exec[1].Name)
+	assert.Equal(t, 30*time.Second, cfg.Exec[1].Interval.Duration)
+	assert.Equal(t, 5*time.Second, cfg.Exec[1].Timeout.Duration)
+	assert.Equal(t, "prometheus", cfg.Exec[1].Format)
+
+	t.Setenv("EXEC_COMMANDS", "a=echo gauge A 1,b=/bin/check")
+	fromEnv := Config{}
+	fromEnv.ReadEnvironment()
+	assert.Equal(t, []ExecCommand{{Name: "a", Command: "echo gauge A 1"}, {Name: "b", Command: "/bin/check"}}, fromEnv.Exec)
+
+	var invalid ExecCommand
+	assert.Error(t, invalid.UnmarshalText([]byte("no-command")))
+}
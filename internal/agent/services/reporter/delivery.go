@@ -0,0 +1,253 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"metrics-and-alerting/internal/agent/services/spool"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+)
+
+type (
+	OptionsDelivery func(*Delivery)
+
+	// SendFunc Отправка пакета метрик на сервер
+	SendFunc func(ctx context.Context, metrics []metric.Metric) error
+
+	// DeliveryStats Статистика доставки пакетов метрик
+	DeliveryStats struct {
+		Sent        int64     // отправленные пакеты
+		SentMetrics int64     // метрики в отправленных пакетах
+		Failed      int64     // неудачные попытки отправки
+		Rejected    int64     // пакеты, отклоненные сервером или не прочитанные из очереди
+		Dropped     int64     // пакеты, удаленные при переполнении очереди
+		Pending     int       // пакеты в очереди
+		LastError   string    // последняя ошибка отправки
+		LastSuccess time.Time // время последней успешной отправки
+	}
+
+	// Delivery Доставка пакетов метрик через очередь неотправленных пакетов.
+	// Пакеты отправляются в порядке добавления; при ошибке отправка повторяется с экспоненциальной
+	// задержкой со случайной составляющей, а пакет остается в очереди до следующей попытки доставки.
+	// Если пакет отправлен частично (PartialError), в очереди остаются только неотправленные метрики.
+	// Доставка выполняется не менее одного раза: пакет, принятый сервером без ответа агенту, будет отправлен повторно.
+	Delivery struct {
+		send    SendFunc
+		queue   *spool.Spool
+		logger  *logpack.LogPack
+		retries int
+		initial time.Duration
+		max     time.Duration
+
+		mu    sync.Mutex // защищает stats и rnd
+		stats DeliveryStats
+		rnd   *rand.Rand
+	}
+)
+
+func NewDelivery(send SendFunc, queue *spool.Spool, logger *logpack.LogPack, opts ...OptionsDelivery) *Delivery {
+
+	d := &Delivery{
+		send:    send,
+		queue:   queue,
+		logger:  logger,
+		retries: 3,
+		initial: time.Second,
+		max:     30 * time.Second,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// WithRetry Число повторов отправки пакета за одну попытку доставки и границы задержки между повторами:
+// задержка начинается с initial и удваивается после каждого повтора, но не превышает max
+func WithRetry(retries int, initial, max time.Duration) OptionsDelivery {
+	return func(d *Delivery) {
+		if retries >= 0 {
+			d.retries = retries
+		}
+
+		if initial > 0 {
+			d.initial = initial
+		}
+
+		if max >= d.initial {
+			d.max = max
+		} else {
+			d.max = d.initial
+		}
+	}
+}
+
+// Deliver Добавление пакета в очередь и отправка всех пакетов очереди
+func (d *Delivery) Deliver(ctx context.Context, batch []metric.Metric) error {
+
+	if len(batch) > 0 {
+		if err := d.queue.Push(batch); err != nil {
+			return err
+		}
+	}
+
+	return d.Flush(ctx)
+}
+
+// Flush Отправка пакетов очереди, начиная с самого старого.
+// Отправка прекращается на первом пакете, который не удалось отправить после всех повторов.
+func (d *Delivery) Flush(ctx context.Context) error {
+
+	for {
+		batch, ok, err := d.queue.Front()
+		if err != nil {
+			d.logger.Err.Printf("drop unreadable spooled batch: %v\n", err)
+			d.count(func(stats *DeliveryStats) { stats.Rejected++ })
+
+			if err = d.queue.Pop(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !ok {
+			return nil
+		}
+
+		err = d.sendWithRetry(ctx, batch)
+
+		if errors.Is(err, ErrRejected) {
+			d.logger.Err.Printf("drop batch rejected by server: %v\n", err)
+			d.count(func(stats *DeliveryStats) { stats.Rejected++ })
+		} else if err != nil {
+			return err
+		} else {
+			d.count(func(stats *DeliveryStats) {
+				stats.Sent++
+				stats.LastSuccess = time.Now()
+			})
+		}
+
+		if err = d.queue.Pop(); err != nil {
+			return err
+		}
+	}
+}
+
+// Stats Текущая статистика доставки
+func (d *Delivery) Stats() DeliveryStats {
+
+	d.mu.Lock()
+	stats := d.stats
+	d.mu.Unlock()
+
+	stats.Pending = d.queue.Len()
+	stats.Dropped = d.queue.Dropped()
+
+	return stats
+}
+
+// Metrics Статистика доставки в виде метрик агента
+func (d *Delivery) Metrics() []metric.Metric {
+
+	stats := d.Stats()
+
+	values := []struct {
+		name  string
+		value int64
+	}{
+		{name: "DeliverySentBatches", value: stats.Sent},
+		{name: "DeliverySentMetrics", value: stats.SentMetrics},
+		{name: "DeliveryFailedAttempts", value: stats.Failed},
+		{name: "DeliveryRejectedBatches", value: stats.Rejected},
+		{name: "DeliveryDroppedBatches", value: stats.Dropped},
+		{name: "DeliveryPendingBatches", value: int64(stats.Pending)},
+	}
+
+	metrics := make([]metric.Metric, 0, len(values))
+	for _, v := range values {
+		m, _ := metric.CreateMetric(metric.GaugeType, v.name, metric.WithValueInt(v.value))
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+// sendWithRetry Отправка пакета с повторами. Отклоненный сервером пакет не отправляется повторно.
+// После частичной отправки повторяется только неотправленная часть пакета, она же сохраняется в очереди.
+func (d *Delivery) sendWithRetry(ctx context.Context, batch []metric.Metric) error {
+
+	for attempt := 0; ; attempt++ {
+
+		err := d.send(ctx, batch)
+		if err == nil {
+			d.count(func(stats *DeliveryStats) { stats.SentMetrics += int64(len(batch)) })
+			return nil
+		}
+
+		d.count(func(stats *DeliveryStats) {
+			stats.Failed++
+			stats.LastError = err.Error()
+		})
+
+		var partial *PartialError
+		if errors.As(err, &partial) && len(partial.Remaining) < len(batch) {
+			sent := len(batch) - len(partial.Remaining) - partial.Rejected
+			batch = partial.Remaining
+
+			d.count(func(stats *DeliveryStats) { stats.SentMetrics += int64(sent) })
+
+			if errReplace := d.queue.ReplaceFront(batch); errReplace != nil {
+				return errReplace
+			}
+		}
+
+		if errors.Is(err, ErrRejected) || attempt >= d.retries {
+			return err
+		}
+
+		timer := time.NewTimer(d.backoff(attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff Задержка перед повтором attempt: initial * 2^attempt, не более max,
+// из которой случайно выбирается значение в интервале [delay/2, delay]
+func (d *Delivery) backoff(attempt int) time.Duration {
+
+	delay := d.initial
+	for i := 0; i < attempt && delay < d.max; i++ {
+		delay *= 2
+	}
+
+	if delay > d.max {
+		delay = d.max
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	half := delay / 2
+	return half + time.Duration(d.rnd.Int63n(int64(delay-half)+1))
+}
+
+func (d *Delivery) count(update func(stats *DeliveryStats)) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	update(&d.stats)
+}
@@ -0,0 +1,229 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/agent/services/spool"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer Сервер, отвечающий status на первые failures запросов, и запоминающий принятые пакеты
+type flakyServer struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	requests int
+	batches  [][]metric.Metric
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(s.status)
+		return
+	}
+
+	var batch []metric.Metric
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.batches = append(s.batches, batch)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *flakyServer) fail(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = n
+	s.status = status
+}
+
+func counterBatch(delta int64) []metric.Metric {
+	m, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(delta))
+	return []metric.Metric{m}
+}
+
+func newTestDelivery(t *testing.T, srv *flakyServer, retries int) (*Delivery, *spool.Spool) {
+
+	httpServer := httptest.NewServer(srv)
+	t.Cleanup(httpServer.Close)
+
+	logger := logpack.NewLogger()
+	queue, err := spool.New(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	r := NewReporter(httpServer.URL, nil, logger)
+	send := func(ctx context.Context, metrics []metric.Metric) error {
+		return r.Send(ctx, ReportAsBatchJSON, metrics)
+	}
+
+	return NewDelivery(send, queue, logger, WithRetry(retries, time.Millisecond, 5*time.Millisecond)), queue
+}
+
+// TestDelivery_ReplayInOrder Пакеты, не отправленные во время недоступности сервера,
+// сохраняются в очереди и отправляются по порядку после восстановления
+func TestDelivery_ReplayInOrder(t *testing.T) {
+
+	srv := &flakyServer{}
+	delivery, queue := newTestDelivery(t, srv, 2)
+	ctx := context.Background()
+
+	srv.fail(6, http.StatusServiceUnavailable)
+	assert.Error(t, delivery.Deliver(ctx, counterBatch(1)))
+	assert.Error(t, delivery.Deliver(ctx, counterBatch(2)))
+	assert.Equal(t, 2, queue.Len())
+
+	stats := delivery.Stats()
+	assert.Equal(t, int64(6), stats.Failed)
+	assert.Equal(t, int64(0), stats.Sent)
+	assert.Equal(t, 2, stats.Pending)
+	assert.Contains(t, stats.LastError, "503")
+
+	require.NoError(t, delivery.Deliver(ctx, counterBatch(3)))
+	assert.Equal(t, 0, queue.Len())
+
+	require.Len(t, srv.batches, 3)
+	var total int64
+	for i, batch := range srv.batches {
+		require.Len(t, batch, 1)
+		assert.Equal(t, int64(i+1), *batch[0].Delta)
+		total += *batch[0].Delta
+	}
+	assert.Equal(t, int64(6), total)
+
+	stats = delivery.Stats()
+	assert.Equal(t, int64(3), stats.Sent)
+	assert.Equal(t, int64(3), stats.SentMetrics)
+	assert.False(t, stats.LastSuccess.IsZero())
+}
+
+// TestDelivery_Retry Временная ошибка сервера устраняется повторами в рамках одной доставки
+func TestDelivery_Retry(t *testing.T) {
+
+	srv := &flakyServer{}
+	delivery, _ := newTestDelivery(t, srv, 3)
+
+	srv.fail(2, http.StatusTooManyRequests)
+	require.NoError(t, delivery.Deliver(context.Background(), counterBatch(5)))
+
+	assert.Equal(t, 3, srv.requests)
+	assert.Len(t, srv.batches, 1)
+	assert.Equal(t, int64(2), delivery.Stats().Failed)
+}
+
+// TestDelivery_Rejected Пакет, отклоненный сервером, не отправляется повторно и не блокирует очередь
+func TestDelivery_Rejected(t *testing.T) {
+
+	srv := &flakyServer{}
+	delivery, queue := newTestDelivery(t, srv, 3)
+
+	srv.fail(1, http.StatusBadRequest)
+	require.NoError(t, delivery.Deliver(context.Background(), counterBatch(1)))
+	require.NoError(t, delivery.Deliver(context.Background(), counterBatch(2)))
+
+	assert.Equal(t, 2, srv.requests)
+	assert.Equal(t, 0, queue.Len())
+
+	stats := delivery.Stats()
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(1), stats.Sent)
+
+	names := make(map[string]bool)
+	for _, m := range delivery.Metrics() {
+		assert.Equal(t, metric.GaugeType, m.MType)
+		names[m.ID] = true
+	}
+	assert.True(t, names["DeliveryRejectedBatches"])
+	assert.True(t, names["DeliveryPendingBatches"])
+}
+
+// TestDelivery_PartialJSON При отправке отдельными запросами повторяются только неотправленные метрики,
+// а метрика, отклоненная сервером, не мешает отправке остальных
+func TestDelivery_PartialJSON(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		requests int
+		received = make(map[string]int)
+	)
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var m metric.Metric
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.ID == "Bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		received[m.ID]++
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	logger := logpack.NewLogger()
+	queue, err := spool.New(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	r := NewReporter(httpServer.URL, nil, logger)
+	send := func(ctx context.Context, metrics []metric.Metric) error {
+		return r.Send(ctx, ReportAsJSON, metrics)
+	}
+	delivery := NewDelivery(send, queue, logger, WithRetry(3, time.Millisecond, 5*time.Millisecond))
+
+	batch := make([]metric.Metric, 0, 4)
+	for _, id := range []string{"First", "Second", "Bad", "Third"} {
+		m, _ := metric.CreateMetric(metric.CounterType, id, metric.WithValueInt(1))
+		batch = append(batch, m)
+	}
+
+	require.NoError(t, delivery.Deliver(context.Background(), batch))
+
+	assert.Equal(t, map[string]int{"First": 1, "Second": 1, "Third": 1}, received)
+	assert.Equal(t, 0, queue.Len())
+
+	stats := delivery.Stats()
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(3), stats.SentMetrics)
+}
+
+// TestDelivery_Backoff Задержка растет экспоненциально, не превышает максимум и не меньше половины расчетной
+func TestDelivery_Backoff(t *testing.T) {
+
+	d := NewDelivery(nil, nil, nil, WithRetry(5, 100*time.Millisecond, time.Second))
+
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			got := d.backoff(attempt)
+			assert.GreaterOrEqual(t, got, want/2)
+			assert.LessOrEqual(t, got, want)
+		}
+	}
+}
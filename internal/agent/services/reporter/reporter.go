@@ -2,18 +2,22 @@ package reporter
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/envelope"
 	"metrics-and-alerting/pkg/logpack"
 	"metrics-and-alerting/pkg/metric"
 	"net/http"
+	"os"
 
 	"github.com/go-resty/resty/v2"
 
@@ -27,25 +31,62 @@ const (
 	ReportAsGRPC      = "GRPC"
 )
 
+// ErrRejected Сервер отклонил пакет метрик, повторная отправка не поможет
+var ErrRejected = errors.New("metrics rejected by server")
+
+// PartialError Ошибка отправки метрик отдельными запросами.
+// Метрики, не вошедшие в Remaining, сервер уже принял или отклонил, повторно их отправлять нельзя:
+// иначе приращения счетчиков будут учтены дважды.
+type PartialError struct {
+	Remaining []metric.Metric // метрики, которые еще не отправлены
+	Rejected  int             // число метрик, отклоненных сервером
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d metrics not sent: %v", len(e.Remaining), e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// Метки, определяющие агент, который отправил метрику
+const (
+	LabelHost     = "host"
+	LabelInstance = "instance"
+)
+
 type (
 	OptionReporter func(*Reporter)
 
 	Reporter struct {
-		addr      string
-		signKey   []byte
-		storage   storage.Repository
-		rpcClient pb.MetricsClient
-		logger    *logpack.LogPack
-		publicKey *rsa.PublicKey
+		addr       string
+		signKey    []byte
+		storage    storage.Repository
+		rpcClient  pb.MetricsClient
+		logger     *logpack.LogPack
+		publicKey  *rsa.PublicKey
+		labels     map[string]string
+		tlsConfig  *tls.Config
+		encryption string
 	}
 )
 
 func NewReporter(addr string, storage storage.Repository, logger *logpack.LogPack, opts ...OptionReporter) *Reporter {
 
 	r := &Reporter{
-		addr:    addr,
-		storage: storage,
-		logger:  logger,
+		addr:       addr,
+		storage:    storage,
+		logger:     logger,
+		labels:     make(map[string]string),
+		encryption: envelope.SchemeEnvelope,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		r.labels[LabelHost] = hostname
+	} else {
+		logger.Err.Printf("could not get hostname: %v\n", err)
 	}
 
 	for _, opt := range opts {
@@ -55,6 +96,24 @@ func NewReporter(addr string, storage storage.Repository, logger *logpack.LogPac
 	return r
 }
 
+// WithInstanceID Идентификатор экземпляра агента, добавляемый к метрикам в метке instance
+func WithInstanceID(id string) OptionReporter {
+	return func(reporter *Reporter) {
+		if len(id) > 0 {
+			reporter.labels[LabelInstance] = id
+		}
+	}
+}
+
+// WithLabels Статические метки, добавляемые ко всем отправляемым метрикам
+func WithLabels(labels map[string]string) OptionReporter {
+	return func(reporter *Reporter) {
+		for name, value := range labels {
+			reporter.labels[name] = value
+		}
+	}
+}
+
 func WithSignKey(key []byte) OptionReporter {
 	return func(reporter *Reporter) {
 		reporter.signKey = key
@@ -89,6 +148,23 @@ func WithKey(key []byte) OptionReporter {
 	}
 }
 
+// WithEncryption Схема шифрования данных: envelope (по умолчанию) или legacy для серверов,
+// не поддерживающих конверт
+func WithEncryption(scheme string) OptionReporter {
+	return func(reporter *Reporter) {
+		if len(scheme) > 0 {
+			reporter.encryption = scheme
+		}
+	}
+}
+
+// WithTLS Настройки TLS для отправки метрик по HTTPS
+func WithTLS(cfg *tls.Config) OptionReporter {
+	return func(reporter *Reporter) {
+		reporter.tlsConfig = cfg
+	}
+}
+
 func WithRPC(conn *grpc.ClientConn) OptionReporter {
 	return func(reporter *Reporter) {
 		if conn != nil {
@@ -97,102 +173,179 @@ func WithRPC(conn *grpc.ClientConn) OptionReporter {
 	}
 }
 
+// Encrypt Шифрование данных открытым ключом сервера по схеме encryption.
+// Если ключ не задан, данные не шифруются.
 func (r Reporter) Encrypt(data []byte) ([]byte, error) {
 	if r.publicKey == nil {
 		return data, nil
 	}
 
-	hashFunc := sha256.New()
-	dataLen := len(data)
-	step := r.publicKey.Size() - hashFunc.Size()*2 - 2
-	var encryptedBytes []byte
-	for start := 0; start < dataLen; start += step {
-		finish := start + step
-		if finish > dataLen {
-			finish = dataLen
-		}
+	if r.encryption == envelope.SchemeLegacy {
+		return envelope.SealLegacy(r.publicKey, data)
+	}
 
-		encryptedBlockBytes, err := rsa.EncryptOAEP(
-			hashFunc,
-			rand.Reader,
-			r.publicKey,
-			data[start:finish],
-			nil)
+	return envelope.Seal(r.publicKey, data)
+}
 
-		if err != nil {
-			return nil, err
-		}
+// encryptionHeaders Заголовок со схемой шифрования тела запроса
+func (r Reporter) encryptionHeaders() map[string]string {
+	if r.publicKey == nil {
+		return nil
+	}
 
-		encryptedBytes = append(encryptedBytes, encryptedBlockBytes...)
+	return map[string]string{envelope.Header: r.encryption}
+}
+
+// client HTTP клиент для отправки метрик
+func (r Reporter) client() *resty.Client {
+
+	client := resty.New()
+	if r.tlsConfig != nil {
+		client.SetTLSClientConfig(r.tlsConfig)
 	}
 
-	return encryptedBytes, nil
+	return client
 }
 
+// withLabels Добавление меток агента к метрике
+// Метки самой метрики имеют приоритет перед метками агента
+func (r Reporter) withLabels(m metric.Metric) metric.Metric {
+
+	if len(r.labels) == 0 {
+		return m
+	}
+
+	labels := make(map[string]string, len(r.labels)+len(m.Labels))
+	for name, value := range r.labels {
+		labels[name] = value
+	}
+
+	for name, value := range m.Labels {
+		labels[name] = value
+	}
+
+	m.Labels = labels
+	return m
+}
+
+// Report Отправка всех метрик хранилища агента
 func (r Reporter) Report(ctx context.Context, reportType string) error {
 
+	metrics, errStorage := r.storage.GetBatch()
+	if errStorage != nil {
+		return fmt.Errorf("could not report metrics: %v", errStorage)
+	}
+
+	return r.Send(ctx, reportType, metrics)
+}
+
+// Send Отправка пакета метрик способом reportType.
+// Ошибки, при которых повторная отправка того же пакета не поможет, содержат ErrRejected.
+func (r Reporter) Send(ctx context.Context, reportType string, metrics []metric.Metric) error {
+
 	switch reportType {
 	case ReportAsURL:
-		if err := r.reportURL(ctx); err != nil {
+		if err := r.reportURL(ctx, metrics); err != nil {
 			return err
 		}
 
 	case ReportAsJSON:
-		if err := r.reportJSON(ctx); err != nil {
+		if err := r.reportJSON(ctx, metrics); err != nil {
 			return err
 		}
 
 	case ReportAsBatchJSON:
-		if err := r.reportBatchJSON(ctx); err != nil {
+		if err := r.reportBatchJSON(ctx, metrics); err != nil {
 			return err
 		}
 	case ReportAsGRPC:
-		if err := r.reportGRPC(ctx); err != nil {
+		if err := r.reportGRPC(ctx, metrics); err != nil {
 			return err
 		}
 
 	default:
-		return fmt.Errorf("could not report metrics: unknown report type")
+		return fmt.Errorf("could not report metrics: unknown report type: %w", ErrRejected)
 	}
 
 	return nil
 }
 
-// reportGRPC Отправка метрик GRPC шлюз
-func (r Reporter) reportGRPC(ctx context.Context) error {
+// checkStatus Проверка кода ответа сервера.
+// Ответы 4xx, кроме 408 и 429, означают, что сервер не примет пакет и при повторной отправке.
+func checkStatus(code int, reportType string) error {
 
-	metrics, errStorage := r.storage.GetBatch()
-	if errStorage != nil {
-		return errStorage
+	if code == http.StatusOK {
+		return nil
+	}
+
+	err := fmt.Errorf("server return no success status on update metrics as %s: %d", reportType, code)
+
+	if code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+		return fmt.Errorf("%v: %w", err, ErrRejected)
 	}
+
+	return err
+}
+
+// reportGRPC Отправка метрик в GRPC шлюз одним запросом
+func (r Reporter) reportGRPC(ctx context.Context, metrics []metric.Metric) error {
+
+	req := &pb.UpsertBatchRequest{Metrics: make([]*pb.Metric, 0, len(metrics))}
+
 	for _, m := range metrics {
 
+		m = r.withLabels(m)
+
 		sign, errSign := m.Sign(r.signKey)
 		if errSign != nil {
 			return fmt.Errorf("could not report metrics: %v", errSign)
 		}
 
 		m.Hash = sign
+		req.Metrics = append(req.Metrics, pb.FromMetric(m))
+	}
+
+	if _, errResp := r.rpcClient.UpsertBatch(ctx, req); errResp != nil {
+		switch status.Code(errResp) {
+		case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented:
+			return fmt.Errorf("failed upsert metrics: %s: %w", errResp, ErrRejected)
+		default:
+			return fmt.Errorf("failed upsert metrics: %s", errResp)
+		}
+	}
+
+	return nil
+}
+
+// reportEach Отправка метрик отдельными запросами.
+// Метрика, отклоненная сервером, пропускается, остальные метрики пакета отправляются.
+// При другой ошибке возвращается PartialError с неотправленными метриками.
+// Если сервер отклонил хотя бы одну метрику и остальные отправлены, возвращается PartialError с ErrRejected.
+func (r Reporter) reportEach(metrics []metric.Metric, send func(m metric.Metric) error) error {
+
+	var rejected int
+	var errRejected error
+
+	for i, m := range metrics {
 
-		var errResp error
-
-		switch m.MType {
-		case metric.CounterType:
-			_, errResp = r.rpcClient.UpsertCounter(ctx, &pb.UpsertCounterRequest{
-				Id:    m.ID,
-				Delta: *m.Delta,
-				Hash:  m.Hash,
-			})
-		case metric.GaugeType:
-			_, errResp = r.rpcClient.UpsertGauge(ctx, &pb.UpsertGaugeRequest{
-				Id:    m.ID,
-				Value: *m.Value,
-				Hash:  m.Hash,
-			})
+		err := send(r.withLabels(m))
+		if err == nil {
+			continue
 		}
 
-		if errResp != nil {
-			return fmt.Errorf("failed upsert metric: %s", errResp)
+		if !errors.Is(err, ErrRejected) {
+			return &PartialError{Remaining: metrics[i:], Rejected: rejected, Err: err}
+		}
+
+		r.logger.Err.Printf("metric %s rejected by server: %v\n", m.ShotString(), err)
+		rejected++
+		errRejected = err
+	}
+
+	if rejected > 0 {
+		return &PartialError{
+			Rejected: rejected,
+			Err:      fmt.Errorf("%d of %d metrics rejected, last error: %w", rejected, len(metrics), errRejected),
 		}
 	}
 
@@ -200,20 +353,16 @@ func (r Reporter) reportGRPC(ctx context.Context) error {
 }
 
 // reportURL Отправка метрик через URL отдельными запросами
-func (r Reporter) reportURL(ctx context.Context) error {
+func (r Reporter) reportURL(ctx context.Context, metrics []metric.Metric) error {
 
-	metrics, errStorage := r.storage.GetBatch()
-	if errStorage != nil {
-		return fmt.Errorf("could not report metrics: %v", errStorage)
-	}
-
-	client := resty.New()
+	client := r.client()
 
-	for _, m := range metrics {
+	return r.reportEach(metrics, func(m metric.Metric) error {
 
 		resp, err := client.R().
 			SetHeader("Content-Type", "text/plain").
 			SetPathParams(m.Map()).
+			SetQueryParams(m.Labels).
 			SetContext(ctx).
 			Post(r.addr + "/update/" + "{type}/{name}/{value}")
 
@@ -221,25 +370,16 @@ func (r Reporter) reportURL(ctx context.Context) error {
 			return fmt.Errorf("could not send metrics as URL: %w", err)
 		}
 
-		if resp.StatusCode() != http.StatusOK {
-			return fmt.Errorf("server return no success status on update metrics as URL: %d", resp.StatusCode())
-		}
-	}
-
-	return nil
+		return checkStatus(resp.StatusCode(), "URL")
+	})
 }
 
 // reportJSON Отправка метрик в виде JSON отдельными запросами
-func (r Reporter) reportJSON(ctx context.Context) error {
+func (r Reporter) reportJSON(ctx context.Context, metrics []metric.Metric) error {
 
-	metrics, errStorage := r.storage.GetBatch()
-	if errStorage != nil {
-		return fmt.Errorf("could not report metrics: %v", errStorage)
-	}
+	client := r.client()
 
-	client := resty.New()
-
-	for _, m := range metrics {
+	return r.reportEach(metrics, func(m metric.Metric) error {
 
 		sign, errSign := m.Sign(r.signKey)
 		if errSign != nil {
@@ -250,7 +390,7 @@ func (r Reporter) reportJSON(ctx context.Context) error {
 
 		data, err := json.Marshal(&m)
 		if err != nil {
-			return fmt.Errorf("error encode metric to JSON: %w", err)
+			return fmt.Errorf("error encode metric to JSON: %v: %w", err, ErrRejected)
 		}
 
 		data, err = r.Encrypt(data)
@@ -260,6 +400,7 @@ func (r Reporter) reportJSON(ctx context.Context) error {
 
 		resp, err := client.R().
 			SetHeader("Content-Type", "application/json").
+			SetHeaders(r.encryptionHeaders()).
 			SetBody(data).
 			SetContext(ctx).
 			Post(r.addr + "/update")
@@ -268,27 +409,20 @@ func (r Reporter) reportJSON(ctx context.Context) error {
 			return fmt.Errorf("could not send metrics as JSON: %w", err)
 		}
 
-		if resp.StatusCode() != http.StatusOK {
-			return fmt.Errorf("server return no success status on update metrics as JSON: %d", resp.StatusCode())
-		}
-	}
-
-	return nil
+		return checkStatus(resp.StatusCode(), "JSON")
+	})
 }
 
 // reportBatchJSON Отправка метрик в виде JSON одним запросом
-func (r Reporter) reportBatchJSON(ctx context.Context) error {
-
-	metrics, errStorage := r.storage.GetBatch()
-	if errStorage != nil {
-		return fmt.Errorf("could not report metrics: %v", errStorage)
-	}
+func (r Reporter) reportBatchJSON(ctx context.Context, metrics []metric.Metric) error {
 
 	// TODO :: Разобраться, как изменять текущий слайс, а не записывать в новый
 	metricsSigned := make([]metric.Metric, len(metrics))
 
 	for i, m := range metrics {
 
+		m = r.withLabels(m)
+
 		sign, errSign := m.Sign(r.signKey)
 		if errSign != nil {
 			return fmt.Errorf("could not report metrics: %v", errSign)
@@ -309,10 +443,11 @@ func (r Reporter) reportBatchJSON(ctx context.Context) error {
 		return fmt.Errorf("error encrypt metric marshaled data: %w", err)
 	}
 
-	client := resty.New()
+	client := r.client()
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
 		SetHeader("X-Real-IP", "125.3.21.1").
+		SetHeaders(r.encryptionHeaders()).
 		SetBody(data).
 		SetContext(ctx).
 		Post(r.addr + "/updates")
@@ -321,9 +456,5 @@ func (r Reporter) reportBatchJSON(ctx context.Context) error {
 		return fmt.Errorf("could not send metrics as Batch-JSON: %w", err)
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("server return no success status on update metrics as Batch-JSON: %d", resp.StatusCode())
-	}
-
-	return nil
+	return checkStatus(resp.StatusCode(), "Batch-JSON")
 }
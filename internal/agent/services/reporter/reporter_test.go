@@ -0,0 +1,211 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/server"
+	handler "metrics-and-alerting/internal/server/handlers"
+	"metrics-and-alerting/internal/storage/memstore"
+	"metrics-and-alerting/pkg/envelope"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+	"metrics-and-alerting/pkg/tlsconfig"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TestReporter_Labels Метки агента передаются серверу во всех режимах отправки
+func TestReporter_Labels(t *testing.T) {
+
+	logger := logpack.NewLogger()
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	for _, reportType := range []string{ReportAsURL, ReportAsJSON, ReportAsBatchJSON, ReportAsGRPC} {
+		t.Run(reportType, func(t *testing.T) {
+
+			serverStore := memstore.New()
+			manager := server.New(serverStore, logger)
+
+			httpServer := httptest.NewServer(server.NewHTTPServer("", handler.New(manager, logger)).HTTP.Handler)
+			defer httpServer.Close()
+
+			gServer, err := server.NewGRPCServer("127.0.0.1:0", manager)
+			require.NoError(t, err)
+			gServer.Start()
+			defer gServer.Stop()
+
+			conn, err := grpc.Dial(gServer.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			agentStore := memstore.New()
+			gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(42))
+			counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(3))
+			require.NoError(t, agentStore.UpsertBatch([]metric.Metric{gauge, counter}))
+
+			r := NewReporter(
+				httpServer.URL,
+				agentStore,
+				logger,
+				WithRPC(conn),
+				WithInstanceID("agent-1"),
+				WithLabels(map[string]string{"dc": "eu"}))
+
+			require.NoError(t, r.Report(context.Background(), reportType))
+
+			labels := map[string]string{
+				LabelHost:     hostname,
+				LabelInstance: "agent-1",
+				"dc":          "eu",
+			}
+
+			got, err := serverStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType, Labels: labels})
+			require.NoError(t, err)
+			assert.Equal(t, 42.0, *got.Value)
+
+			got, err = serverStore.Get(metric.Metric{ID: "PollCount", MType: metric.CounterType, Labels: labels})
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), *got.Delta)
+
+			_, err = serverStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType})
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestReporter_MutualTLS Отправка метрик по HTTPS и gRPC с проверкой сертификатов сервера и агента
+func TestReporter_MutualTLS(t *testing.T) {
+
+	logger := logpack.NewLogger()
+	dir := t.TempDir()
+
+	ca, err := tlsconfig.NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	serverCert, err := tlsconfig.NewServerCert(ca, []string{"localhost", "127.0.0.1"}, time.Hour)
+	require.NoError(t, err)
+	agentCert, err := tlsconfig.NewClientCert(ca, "agent", time.Hour)
+	require.NoError(t, err)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+	require.NoError(t, ca.WriteFiles(path("ca.crt"), path("ca.key")))
+	require.NoError(t, serverCert.WriteFiles(path("server.crt"), path("server.key")))
+	require.NoError(t, agentCert.WriteFiles(path("agent.crt"), path("agent.key")))
+
+	serverTLS, err := tlsconfig.Server(path("server.crt"), path("server.key"), path("ca.crt"))
+	require.NoError(t, err)
+
+	for _, reportType := range []string{ReportAsBatchJSON, ReportAsGRPC} {
+		t.Run(reportType, func(t *testing.T) {
+
+			serverStore := memstore.New()
+			manager := server.New(serverStore, logger)
+
+			httpServer := httptest.NewUnstartedServer(server.NewHTTPServer("", handler.New(manager, logger)).HTTP.Handler)
+			httpServer.TLS = serverTLS.Clone()
+			httpServer.StartTLS()
+			defer httpServer.Close()
+
+			gServer, err := server.NewGRPCServer("127.0.0.1:0", manager, server.WithGRPCTLS(serverTLS))
+			require.NoError(t, err)
+			gServer.Start()
+			defer gServer.Stop()
+
+			agentStore := memstore.New()
+			gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(42))
+			require.NoError(t, agentStore.Upsert(gauge))
+
+			report := func(ca, cert, key string) error {
+				agentTLS, errTLS := tlsconfig.Client(ca, cert, key)
+				require.NoError(t, errTLS)
+
+				clientTLS := agentTLS.Clone()
+				clientTLS.ServerName = "127.0.0.1"
+
+				conn, errConn := grpc.Dial(gServer.Listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+				require.NoError(t, errConn)
+				defer conn.Close()
+
+				r := NewReporter(httpServer.URL, agentStore, logger, WithRPC(conn), WithTLS(agentTLS))
+				return r.Report(context.Background(), reportType)
+			}
+
+			// Без сертификата агента сервер отклоняет соединение
+			assert.Error(t, report(path("ca.crt"), "", ""))
+
+			_, err = serverStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType})
+			assert.Error(t, err)
+
+			require.NoError(t, report(path("ca.crt"), path("agent.crt"), path("agent.key")))
+
+			metrics, err := serverStore.GetBatch()
+			require.NoError(t, err)
+			require.Len(t, metrics, 1)
+			assert.Equal(t, 42.0, *metrics[0].Value)
+		})
+	}
+}
+
+// TestReporter_Encryption Сервер принимает данные в конверте и в прежнем формате
+func TestReporter_Encryption(t *testing.T) {
+
+	logger := logpack.NewLogger()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicDER})
+
+	serverStore := memstore.New()
+	manager := server.New(serverStore, logger)
+
+	httpServer := httptest.NewServer(server.NewHTTPServer("", handler.New(manager, logger, handler.WithKey(string(privatePEM)))).HTTP.Handler)
+	defer httpServer.Close()
+
+	for _, scheme := range []string{envelope.SchemeEnvelope, envelope.SchemeLegacy} {
+		for _, reportType := range []string{ReportAsJSON, ReportAsBatchJSON} {
+			t.Run(scheme+"/"+reportType, func(t *testing.T) {
+
+				agentStore := memstore.New()
+				gauge, _ := metric.CreateMetric(metric.GaugeType, scheme+reportType, metric.WithValueFloat(42))
+				require.NoError(t, agentStore.Upsert(gauge))
+
+				r := NewReporter(httpServer.URL, agentStore, logger, WithKey(publicPEM), WithEncryption(scheme))
+				require.NoError(t, r.Report(context.Background(), reportType))
+
+				got, errGet := serverStore.Get(metric.Metric{ID: gauge.ID, MType: metric.GaugeType, Labels: r.labels})
+				require.NoError(t, errGet)
+				assert.Equal(t, 42.0, *got.Value)
+			})
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/update", bytes.NewReader([]byte("{}")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(envelope.Header, "rot13")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// Collector Источник метрик агента.
+// Collect возвращает метрики для записи в хранилище агента: значения gauge заменяют сохраненные,
+// значения counter прибавляются к накопленным с прошлой отправки, поэтому счетчик возвращает приращение.
+type Collector interface {
+	// Name Уникальное имя сборщика, по которому он включается и отключается в конфигурации
+	Name() string
+	// Interval Интервал сбора метрик; 0 - на каждом проходе сканера
+	Interval() time.Duration
+	// Collect Сбор метрик. Сборщик должен прекращать работу при отмене ctx.
+	Collect(ctx context.Context) ([]metric.Metric, error)
+}
+
+// TimeoutCollector Сборщик с собственным ограничением времени сбора вместо значения сканера по умолчанию
+type TimeoutCollector interface {
+	Collector
+	Timeout() time.Duration
+}
+
+// ClosingCollector Сборщик, работа которого продолжается в фоне между вызовами Collect.
+// Close останавливает ее при завершении агента.
+type ClosingCollector interface {
+	Collector
+	Close() error
+}
+
+// Errors Ошибки сборщиков за один проход сканера
+type Errors []error
+
+func (errs Errors) Error() string {
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// CollectError Ошибка сборщика метрик
+type CollectError struct {
+	Collector string
+	Err       error
+}
+
+func (e CollectError) Error() string {
+	return fmt.Sprintf("collector %s: %v", e.Collector, e.Err)
+}
+
+func (e CollectError) Unwrap() error {
+	return e.Err
+}
+
+// Builtin Встроенные сборщики агента. Сборщики /proc и /sys доступны только в Linux;
+// root - корень файловой системы хоста, в которой они читают /proc и /sys.
+func Builtin(root string) []Collector {
+
+	collectors := []Collector{
+		NewRuntimeCollector(),
+		NewWorkloadCollector(),
+	}
+
+	if runtime.GOOS == "linux" {
+		collectors = append(collectors,
+			NewDiskCollector(root),
+			NewFilesystemCollector(root),
+			NewNetworkCollector(root),
+			NewLoadCollector(root),
+			NewFDCollector(root),
+			NewStatCollector(root),
+		)
+	}
+
+	return collectors
+}
+
+// Select Выбор сборщиков по именам: если enabled не пуст, остаются только перечисленные в нем,
+// затем исключаются перечисленные в disabled. Неизвестное имя считается ошибкой конфигурации.
+func Select(collectors []Collector, enabled, disabled []string) ([]Collector, error) {
+
+	known := make(map[string]bool, len(collectors))
+	for _, c := range collectors {
+		known[c.Name()] = true
+	}
+
+	toSet := func(names []string) (map[string]bool, error) {
+		set := make(map[string]bool, len(names))
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown collector %q", name)
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+
+	enabledSet, err := toSet(enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	disabledSet, err := toSet(disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]Collector, 0, len(collectors))
+	for _, c := range collectors {
+		if len(enabledSet) > 0 && !enabledSet[c.Name()] {
+			continue
+		}
+
+		if disabledSet[c.Name()] {
+			continue
+		}
+
+		selected = append(selected, c)
+	}
+
+	return selected, nil
+}
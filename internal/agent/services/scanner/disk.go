@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// sectorSize Размер сектора в /proc/diskstats, не зависящий от устройства
+const sectorSize = 512
+
+// DiskCollector Метрики ввода-вывода блочных устройств из /proc/diskstats.
+// Учитываются только целые диски из /sys/block, кроме loop и ram устройств, чтобы не считать разделы дважды.
+type DiskCollector struct {
+	fs       procFS
+	counters *counterState
+}
+
+func NewDiskCollector(root string) *DiskCollector {
+	return &DiskCollector{
+		fs:       newProcFS(root),
+		counters: newCounterState(),
+	}
+}
+
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+func (c *DiskCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *DiskCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	lines, err := c.fs.readLines("proc", "diskstats")
+	if err != nil {
+		return nil, err
+	}
+
+	disks := c.disks()
+	result := collected{counters: c.counters}
+
+	for _, line := range lines {
+
+		// major minor name reads merged sectors ms writes merged sectors ms in_progress io_ms weighted_ms ...
+		fields := strings.Fields(line)
+		if len(fields) < 14 {
+			continue
+		}
+
+		device := fields[2]
+		if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
+			continue
+		}
+
+		if disks != nil && !disks[device] {
+			continue
+		}
+
+		values := parseUints(fields)
+		labels := map[string]string{"device": device}
+
+		result.counter("DiskReads", values[3], labels)
+		result.counter("DiskReadBytes", values[5]*sectorSize, labels)
+		result.counter("DiskWrites", values[7], labels)
+		result.counter("DiskWriteBytes", values[9]*sectorSize, labels)
+		result.counter("DiskIOTimeMs", values[12], labels)
+		result.gauge("DiskIOInProgress", float64(values[11]), labels)
+	}
+
+	c.counters.sweep()
+	return result.metrics, nil
+}
+
+// disks Имена целых дисков из /sys/block; nil, если каталог недоступен
+func (c *DiskCollector) disks() map[string]bool {
+
+	entries, err := os.ReadDir(c.fs.path("sys", "block"))
+	if err != nil {
+		return nil
+	}
+
+	disks := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		disks[entry.Name()] = true
+	}
+
+	return disks
+}
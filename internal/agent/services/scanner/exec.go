@@ -0,0 +1,473 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics-and-alerting/pkg/exposition"
+	"metrics-and-alerting/pkg/metric"
+)
+
+// Форматы вывода команд сборщика exec
+const (
+	ExecFormatAuto       = "auto"       // определяется по выводу
+	ExecFormatSimple     = "simple"     // строки <type> <name> <value>
+	ExecFormatPrometheus = "prometheus" // текстовый формат Prometheus
+)
+
+const (
+	execDefaultTimeout     = 10 * time.Second
+	execDefaultConcurrency = 4
+	execMaxOutput          = 1 << 20
+)
+
+// errExecTimeout Команда не завершилась за отведенное время
+var errExecTimeout = errors.New("command timed out")
+
+// ExecCommand Команда, метрики которой читаются из стандартного вывода.
+// Interval 0 - запуск на каждом проходе сканера, Timeout 0 - 10 секунд.
+type ExecCommand struct {
+	Name     string
+	Command  string
+	Interval time.Duration
+	Timeout  time.Duration
+	Format   string
+}
+
+// execState Состояние команды между запусками
+type execState struct {
+	ExecCommand
+	running    bool
+	lastRun    time.Time
+	counters   *counterState
+	histograms *histogramState
+}
+
+// ExecCollector Метрики из вывода внешних команд.
+// Команды выполняются в фоне, каждая со своим интервалом и ограничением времени, одновременно
+// выполняется не более concurrency команд. Метрики завершившихся запусков возвращаются следующим Collect,
+// поэтому долгие команды не задерживают проход сканера. Close прерывает выполняемые команды при остановке агента.
+//
+// В формате simple значение counter - приращение с прошлого запуска, в формате Prometheus - накопленное значение,
+// из которого вычисляется приращение; так же вычисляется приращение гистограмм. Нечисловые значения gauge
+// (NaN, ±Inf) отбрасываются и учитываются как ошибки разбора. Для каждой команды с меткой command=<имя> отправляются
+// ExecExitCode (-1, если команда не запустилась или прервана по времени), ExecDurationSeconds
+// и счетчики ExecRuns, ExecFailures и ExecParseErrors.
+type ExecCollector struct {
+	commands []*execState
+	sem      chan struct{}
+	now      func() time.Time
+
+	ctx    context.Context // отменяется при Close и прерывает выполняемые команды
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // защищает состояние команд и pending
+	pending []metric.Metric
+	wg      sync.WaitGroup // выполняемые команды
+}
+
+func NewExecCollector(commands []ExecCommand, concurrency int) (*ExecCollector, error) {
+
+	if concurrency <= 0 {
+		concurrency = execDefaultConcurrency
+	}
+
+	c := &ExecCollector{
+		commands: make([]*execState, 0, len(commands)),
+		sem:      make(chan struct{}, concurrency),
+		now:      time.Now,
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	names := make(map[string]bool, len(commands))
+
+	for _, command := range commands {
+
+		if len(command.Name) == 0 || len(strings.TrimSpace(command.Command)) == 0 {
+			return nil, fmt.Errorf("exec command must have name and command")
+		}
+
+		if names[command.Name] {
+			return nil, fmt.Errorf("duplicate exec command %q", command.Name)
+		}
+		names[command.Name] = true
+
+		switch command.Format {
+		case "":
+			command.Format = ExecFormatAuto
+		case ExecFormatAuto, ExecFormatSimple, ExecFormatPrometheus:
+		default:
+			return nil, fmt.Errorf("exec command %s has unknown format %q", command.Name, command.Format)
+		}
+
+		if command.Timeout <= 0 {
+			command.Timeout = execDefaultTimeout
+		}
+
+		c.commands = append(c.commands, &execState{
+			ExecCommand: command,
+			counters:    newCounterState(),
+			histograms:  newHistogramState(),
+		})
+	}
+
+	return c, nil
+}
+
+func (c *ExecCollector) Name() string {
+	return "exec"
+}
+
+func (c *ExecCollector) Interval() time.Duration {
+	return 0
+}
+
+// Collect Запуск команд, для которых наступил интервал и которые не выполняются сейчас,
+// и метрики уже завершившихся запусков. Команды выполняются дольше прохода сканера,
+// поэтому прерываются не отменой ctx, а вызовом Close.
+func (c *ExecCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for _, state := range c.commands {
+		if c.ctx.Err() != nil {
+			break
+		}
+
+		if state.running || (!state.lastRun.IsZero() && now.Sub(state.lastRun) < state.Interval) {
+			continue
+		}
+
+		state.running = true
+		state.lastRun = now
+
+		c.wg.Add(1)
+		go c.run(state)
+	}
+
+	metrics := c.pending
+	c.pending = nil
+
+	return metrics, nil
+}
+
+// Close Прерывание выполняемых команд вместе с их дочерними процессами и ожидание их завершения.
+// После Close новые команды не запускаются.
+func (c *ExecCollector) Close() error {
+
+	c.mu.Lock()
+	c.cancel()
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	return nil
+}
+
+// run Выполнение команды и разбор ее вывода
+func (c *ExecCollector) run(state *execState) {
+
+	defer c.wg.Done()
+
+	select {
+	case c.sem <- struct{}{}:
+		defer func() { <-c.sem }()
+	case <-c.ctx.Done():
+		c.mu.Lock()
+		state.running = false
+		c.mu.Unlock()
+		return
+	}
+
+	start := time.Now()
+	output, exitCode := runCommand(c.ctx, state.Command, state.Timeout)
+	duration := time.Since(start)
+
+	metrics, parseErrors := state.parse(output)
+
+	labels := map[string]string{"command": state.Name}
+	failed := int64(0)
+	if exitCode != 0 {
+		failed = 1
+	}
+
+	result := collected{metrics: metrics}
+	result.gauge("ExecExitCode", float64(exitCode), labels)
+	result.gauge("ExecDurationSeconds", duration.Seconds(), labels)
+
+	for _, counter := range []struct {
+		name  string
+		value int64
+	}{
+		{"ExecRuns", 1},
+		{"ExecFailures", failed},
+		{"ExecParseErrors", int64(parseErrors)},
+	} {
+		m, _ := metric.CreateMetric(metric.CounterType, counter.name, metric.WithValueInt(counter.value), metric.WithLabels(labels))
+		result.metrics = append(result.metrics, m)
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, result.metrics...)
+	state.running = false
+	c.mu.Unlock()
+}
+
+// parse Разбор вывода команды, возвращает метрики и число некорректных строк
+func (state *execState) parse(output []byte) ([]metric.Metric, int) {
+
+	format := state.Format
+	if format == ExecFormatAuto {
+		format = detectFormat(output)
+	}
+
+	if format == ExecFormatSimple {
+		return parseSimple(output)
+	}
+
+	parsed, err := exposition.Parse(bytes.NewReader(output))
+
+	parseErrors := 0
+	if err != nil {
+		var parseErrs exposition.ParseErrors
+		if errors.As(err, &parseErrs) {
+			parseErrors = len(parseErrs)
+		} else {
+			parseErrors = 1
+		}
+	}
+
+	// Счетчики и гистограммы Prometheus накопительные, в хранилище агента записываются приращения
+	metrics := make([]metric.Metric, 0, len(parsed))
+	for _, m := range parsed {
+		switch m.MType {
+		case metric.CounterType:
+			if counter, ok := state.counters.counter(m.ID, uint64(*m.Delta), m.Labels); ok {
+				metrics = append(metrics, counter)
+			}
+
+		case metric.HistogramType:
+			if histogram, ok := state.histograms.histogram(m); ok {
+				metrics = append(metrics, histogram)
+			}
+
+		default:
+			metrics = append(metrics, m)
+		}
+	}
+	state.counters.sweep()
+	state.histograms.sweep()
+
+	return metrics, parseErrors
+}
+
+// histogramState Преобразование накопленных гистограмм Prometheus в приращения между запусками команды.
+// Как и в counterState, для первого значения серии метрика не возвращается; если наблюдений в какой-либо
+// корзине стало меньше или изменились границы (перезапуск источника), приращением считается текущая гистограмма.
+type histogramState struct {
+	last map[string]metric.Histogram
+	seen map[string]bool
+}
+
+func newHistogramState() *histogramState {
+	return &histogramState{
+		last: make(map[string]metric.Histogram),
+		seen: make(map[string]bool),
+	}
+}
+
+// histogram Метрика histogram с приращением накопленной гистограммы m
+func (s *histogramState) histogram(m metric.Metric) (metric.Metric, bool) {
+
+	if m.Histogram == nil {
+		return m, false
+	}
+
+	key := m.SeriesKey()
+
+	last, ok := s.last[key]
+	s.last[key] = *m.Histogram.Copy()
+	s.seen[key] = true
+
+	if !ok {
+		return m, false
+	}
+
+	if delta, ok := histogramDelta(*m.Histogram, last); ok {
+		m.Histogram = delta
+	}
+
+	return m, true
+}
+
+// sweep Удаление серий, которые не встречались с прошлого вызова sweep
+func (s *histogramState) sweep() {
+
+	for key := range s.last {
+		if !s.seen[key] {
+			delete(s.last, key)
+		}
+	}
+
+	s.seen = make(map[string]bool, len(s.last))
+}
+
+// histogramDelta Разность накопленных гистограмм current и last; false, если current не продолжает last
+func histogramDelta(current, last metric.Histogram) (*metric.Histogram, bool) {
+
+	if len(current.Bounds) != len(last.Bounds) || len(current.Counts) != len(last.Counts) || current.Count < last.Count {
+		return nil, false
+	}
+
+	for i := range current.Bounds {
+		if current.Bounds[i] != last.Bounds[i] {
+			return nil, false
+		}
+	}
+
+	delta := current.Copy()
+	for i := range current.Counts {
+		if current.Counts[i] < last.Counts[i] {
+			return nil, false
+		}
+		delta.Counts[i] -= last.Counts[i]
+	}
+
+	delta.Sum -= last.Sum
+	delta.Count -= last.Count
+
+	return delta, true
+}
+
+// detectFormat Формат вывода по первой значимой строке: simple, если она начинается с типа метрики
+func detectFormat(output []byte) string {
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], "#") {
+			if len(fields) > 1 && (fields[1] == "TYPE" || fields[1] == "HELP") {
+				return ExecFormatPrometheus
+			}
+			continue
+		}
+
+		if len(fields) == 3 && (fields[0] == metric.GaugeType || fields[0] == metric.CounterType) {
+			return ExecFormatSimple
+		}
+
+		return ExecFormatPrometheus
+	}
+
+	return ExecFormatSimple
+}
+
+// parseSimple Разбор строк <type> <name> <value>; пустые строки и строки, начинающиеся с #, пропускаются
+func parseSimple(output []byte) ([]metric.Metric, int) {
+
+	metrics := make([]metric.Metric, 0)
+	parseErrors := 0
+
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || (fields[0] != metric.GaugeType && fields[0] != metric.CounterType) {
+			parseErrors++
+			continue
+		}
+
+		m, err := metric.CreateMetric(fields[0], fields[1], metric.WithValue(fields[2]))
+		if err != nil || (m.Value != nil && (math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0))) {
+			parseErrors++
+			continue
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return metrics, parseErrors
+}
+
+// runCommand Выполнение команды оболочкой с ограничением времени до отмены ctx.
+// Возвращает стандартный вывод (не более execMaxOutput байт) и код завершения;
+// -1, если команда не запустилась, прервана по времени или отменой ctx.
+func runCommand(ctx context.Context, command string, timeout time.Duration) ([]byte, int) {
+
+	cmd := shellCommand(command)
+
+	output := &limitedBuffer{limit: execMaxOutput}
+	cmd.Stdout = output
+
+	if err := cmd.Start(); err != nil {
+		return nil, -1
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timer.C:
+		// Завершаются и дочерние процессы, иначе они держат открытым стандартный вывод
+		killCommand(cmd)
+		<-done
+		err = errExecTimeout
+	case <-ctx.Done():
+		killCommand(cmd)
+		<-done
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		return output.Bytes(), 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output.Bytes(), exitErr.ExitCode()
+	}
+
+	return output.Bytes(), -1
+}
+
+// limitedBuffer Буфер, отбрасывающий данные сверх limit байт
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+
+	if free := b.limit - b.Len(); free < len(p) {
+		if free > 0 {
+			b.Buffer.Write(p[:free])
+		}
+		return len(p), nil
+	}
+
+	return b.Buffer.Write(p)
+}
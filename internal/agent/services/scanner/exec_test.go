@@ -0,0 +1,216 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExecCollector(t *testing.T, concurrency int, commands ...ExecCommand) *ExecCollector {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("commands use sh syntax")
+	}
+
+	c, err := NewExecCollector(commands, concurrency)
+	require.NoError(t, err)
+
+	return c
+}
+
+// runOnce Запуск команд и ожидание их завершения
+func runOnce(t *testing.T, c *ExecCollector) map[string]metric.Metric {
+
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	c.wg.Wait()
+
+	c.mu.Lock()
+	metrics := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	return bySeries(metrics)
+}
+
+func TestNewExecCollector(t *testing.T) {
+
+	_, err := NewExecCollector([]ExecCommand{{Name: "a", Command: "true"}, {Name: "a", Command: "true"}}, 1)
+	assert.Error(t, err)
+
+	_, err = NewExecCollector([]ExecCommand{{Name: "a"}}, 1)
+	assert.Error(t, err)
+
+	_, err = NewExecCollector([]ExecCommand{{Name: "a", Command: "true", Format: "xml"}}, 1)
+	assert.Error(t, err)
+}
+
+func TestExecCollector_Simple(t *testing.T) {
+
+	c := newExecCollector(t, 1, ExecCommand{
+		Name:    "check",
+		Command: `echo "gauge Temperature 36.6"; echo "counter Jobs 3"; echo "# comment"; echo "oops"; echo "gauge Broken NaN"`,
+	})
+
+	got := runOnce(t, c)
+
+	assert.Equal(t, 36.6, *got["Temperature"].Value)
+	assert.Equal(t, int64(3), *got["Jobs"].Delta)
+	assert.Equal(t, 0.0, *got[`ExecExitCode{command="check"}`].Value)
+	assert.Equal(t, int64(1), *got[`ExecRuns{command="check"}`].Delta)
+	assert.Equal(t, int64(0), *got[`ExecFailures{command="check"}`].Delta)
+	assert.Equal(t, int64(2), *got[`ExecParseErrors{command="check"}`].Delta)
+	assert.NotContains(t, got, "Broken")
+	assert.Contains(t, got, `ExecDurationSeconds{command="check"}`)
+}
+
+func TestExecCollector_Prometheus(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "metrics.txt")
+	write := func(requests int) {
+		text := fmt.Sprintf("# TYPE queue_depth gauge\nqueue_depth{queue=\"mail\"} 12\n"+
+			"# TYPE requests_total counter\nrequests_total %d\nbroken{ 1\n"+
+			"# TYPE latency histogram\nlatency_bucket{le=\"1\"} %d\nlatency_bucket{le=\"+Inf\"} %d\n"+
+			"latency_sum %d\nlatency_count %d\n", requests, requests/2, requests, requests, requests)
+		require.NoError(t, os.WriteFile(file, []byte(text), 0o644))
+	}
+
+	c := newExecCollector(t, 1, ExecCommand{Name: "scrape", Command: "cat " + file})
+
+	write(100)
+	first := runOnce(t, c)
+	assert.Equal(t, 12.0, *first[`queue_depth{queue="mail"}`].Value)
+	assert.NotContains(t, first, "requests_total")
+	assert.NotContains(t, first, "latency")
+	assert.Equal(t, int64(1), *first[`ExecParseErrors{command="scrape"}`].Delta)
+
+	write(130)
+	second := runOnce(t, c)
+	assert.Equal(t, metric.CounterType, second["requests_total"].MType)
+	assert.Equal(t, int64(30), *second["requests_total"].Delta)
+
+	// Гистограмма передается приращением с прошлого запуска
+	assert.Equal(t, []uint64{15, 15}, second["latency"].Histogram.Counts)
+	assert.Equal(t, uint64(30), second["latency"].Histogram.Count)
+	assert.Equal(t, 30.0, second["latency"].Histogram.Sum)
+
+	// После перезапуска источника приращением считается текущая гистограмма
+	write(10)
+	third := runOnce(t, c)
+	assert.Equal(t, []uint64{5, 5}, third["latency"].Histogram.Counts)
+	assert.Equal(t, uint64(10), third["latency"].Histogram.Count)
+}
+
+func TestExecCollector_Failures(t *testing.T) {
+
+	c := newExecCollector(t, 2,
+		ExecCommand{Name: "exit", Command: `echo "gauge Partial 1"; exit 3`, Format: ExecFormatSimple},
+		ExecCommand{Name: "hung", Command: `sleep 10 & sleep 10; echo "gauge Late 1"`, Timeout: 100 * time.Millisecond},
+		ExecCommand{Name: "missing", Command: "/nonexistent/command"},
+	)
+
+	start := time.Now()
+	got := runOnce(t, c)
+
+	// Прерванная по времени команда завершается вместе с дочерними процессами
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	assert.Equal(t, 1.0, *got["Partial"].Value)
+	assert.Equal(t, 3.0, *got[`ExecExitCode{command="exit"}`].Value)
+	assert.Equal(t, int64(1), *got[`ExecFailures{command="exit"}`].Delta)
+
+	assert.Equal(t, -1.0, *got[`ExecExitCode{command="hung"}`].Value)
+	assert.Equal(t, int64(1), *got[`ExecFailures{command="hung"}`].Delta)
+	assert.NotContains(t, got, "Late")
+
+	assert.Equal(t, 127.0, *got[`ExecExitCode{command="missing"}`].Value)
+}
+
+// TestExecCollector_Close Close прерывает выполняемые команды и не дает запускать новые
+func TestExecCollector_Close(t *testing.T) {
+
+	started := filepath.Join(t.TempDir(), "started")
+	c := newExecCollector(t, 1, ExecCommand{
+		Name:    "hung",
+		Command: "touch '" + started + "'; sleep 10 & sleep 10",
+		Timeout: time.Minute,
+	})
+
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, errStat := os.Stat(started)
+		return errStat == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, c.Close())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	got, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, -1.0, *bySeries(got)[`ExecExitCode{command="hung"}`].Value)
+
+	// Новые запуски после Close не выполняются
+	c.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	c.wg.Wait()
+	assert.Empty(t, c.pending)
+}
+
+func TestExecCollector_Concurrency(t *testing.T) {
+
+	commands := make([]ExecCommand, 0, 3)
+	for i := 0; i < 3; i++ {
+		commands = append(commands, ExecCommand{Name: fmt.Sprint("sleep", i), Command: "sleep 0.1"})
+	}
+
+	c := newExecCollector(t, 1, commands...)
+
+	start := time.Now()
+	got := runOnce(t, c)
+
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Len(t, got, 3*5)
+}
+
+func TestExecCollector_Interval(t *testing.T) {
+
+	c := newExecCollector(t, 2,
+		ExecCommand{Name: "every", Command: "true"},
+		ExecCommand{Name: "minute", Command: "true", Interval: time.Minute},
+	)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	runs := map[string]int64{}
+	for i := 0; i < 4; i++ {
+		for key, m := range runOnce(t, c) {
+			if m.ID == "ExecRuns" {
+				runs[key] += *m.Delta
+			}
+		}
+		now = now.Add(30 * time.Second)
+	}
+
+	assert.Equal(t, int64(4), runs[`ExecRuns{command="every"}`])
+	assert.Equal(t, int64(2), runs[`ExecRuns{command="minute"}`])
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, ExecFormatSimple, detectFormat([]byte("\n# note\ngauge A 1\n")))
+	assert.Equal(t, ExecFormatPrometheus, detectFormat([]byte("# HELP a b\na 1\n")))
+	assert.Equal(t, ExecFormatPrometheus, detectFormat([]byte("a{b=\"c\"} 1\n")))
+}
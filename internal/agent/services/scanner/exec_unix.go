@@ -0,0 +1,22 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand Команда оболочки в отдельной группе процессов
+func shellCommand(command string) *exec.Cmd {
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	return cmd
+}
+
+// killCommand Завершение группы процессов команды
+func killCommand(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
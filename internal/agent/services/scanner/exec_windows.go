@@ -0,0 +1,13 @@
+package scanner
+
+import "os/exec"
+
+// shellCommand Команда интерпретатора cmd
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// killCommand Завершение процесса команды
+func killCommand(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
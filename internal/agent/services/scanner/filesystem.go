@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// errStatfsUnsupported Получение размеров файловой системы не поддерживается на этой платформе
+var errStatfsUnsupported = errors.New("statfs is not supported on this platform")
+
+// fsStats Размеры файловой системы
+type fsStats struct {
+	Total      uint64
+	Free       uint64
+	Avail      uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// pseudoFS Виртуальные файловые системы, для которых размеры не имеют смысла
+var pseudoFS = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true, "configfs": true,
+	"debugfs": true, "devpts": true, "devtmpfs": true, "fusectl": true, "hugetlbfs": true, "mqueue": true,
+	"nsfs": true, "proc": true, "pstore": true, "securityfs": true, "squashfs": true,
+	"sysfs": true, "tracefs": true,
+}
+
+// FilesystemCollector Заполненность смонтированных файловых систем.
+// Точки монтирования читаются из /proc/1/mounts, чтобы в контейнере видеть файловые системы хоста.
+type FilesystemCollector struct {
+	fs     procFS
+	statfs func(path string) (fsStats, error)
+}
+
+func NewFilesystemCollector(root string) *FilesystemCollector {
+	return &FilesystemCollector{
+		fs:     newProcFS(root),
+		statfs: statfs,
+	}
+}
+
+func (c *FilesystemCollector) Name() string {
+	return "filesystem"
+}
+
+func (c *FilesystemCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *FilesystemCollector) Collect(ctx context.Context) ([]metric.Metric, error) {
+
+	lines, err := c.fs.readLines("proc", "1", "mounts")
+	if err != nil {
+		return nil, err
+	}
+
+	result := collected{}
+	seen := make(map[string]bool)
+
+	for _, line := range lines {
+
+		if ctx.Err() != nil {
+			return result.metrics, ctx.Err()
+		}
+
+		// <device> <mountpoint> <fstype> <options> 0 0
+		fields := strings.Fields(line)
+		if len(fields) < 3 || pseudoFS[fields[2]] {
+			continue
+		}
+
+		mountpoint := unescapeMount(fields[1])
+		if seen[mountpoint] {
+			continue
+		}
+		seen[mountpoint] = true
+
+		stats, errStat := c.statfs(c.fs.path(mountpoint))
+		if errors.Is(errStat, errStatfsUnsupported) {
+			return nil, errStat
+		}
+
+		// Недоступные точки монтирования (например, отключенные сетевые) пропускаются
+		if errStat != nil || stats.Total == 0 {
+			continue
+		}
+
+		labels := map[string]string{
+			"mountpoint": mountpoint,
+			"device":     fields[0],
+			"fstype":     fields[2],
+		}
+
+		used := stats.Total - stats.Free
+
+		result.gauge("FsTotalBytes", float64(stats.Total), labels)
+		result.gauge("FsFreeBytes", float64(stats.Free), labels)
+		result.gauge("FsAvailBytes", float64(stats.Avail), labels)
+		result.gauge("FsUsedBytes", float64(used), labels)
+		// Без доступных пользователю блоков (все свободные зарезервированы) процент не определен
+		if used+stats.Avail > 0 {
+			result.gauge("FsUsedPercent", 100*float64(used)/float64(used+stats.Avail), labels)
+		}
+		result.gauge("FsInodes", float64(stats.Inodes), labels)
+		result.gauge("FsInodesFree", float64(stats.InodesFree), labels)
+	}
+
+	return result.metrics, nil
+}
+
+// unescapeMount Раскрытие восьмеричных последовательностей (\040 - пробел) в пути точки монтирования
+func unescapeMount(path string) string {
+
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	builder := strings.Builder{}
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if code, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(path[i])
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// LoadCollector Средняя загрузка и число процессов из /proc/loadavg
+type LoadCollector struct {
+	fs procFS
+}
+
+func NewLoadCollector(root string) *LoadCollector {
+	return &LoadCollector{fs: newProcFS(root)}
+}
+
+func (c *LoadCollector) Name() string {
+	return "load"
+}
+
+func (c *LoadCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *LoadCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	// 0.20 0.18 0.12 1/80 11206
+	data, err := c.fs.readString("proc", "loadavg")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(data)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid loadavg format: %q", data)
+	}
+
+	result := collected{}
+
+	for i, name := range []string{"Load1", "Load5", "Load15"} {
+		value, errParse := strconv.ParseFloat(fields[i], 64)
+		if errParse != nil {
+			return nil, fmt.Errorf("invalid loadavg value %q: %w", fields[i], errParse)
+		}
+		result.gauge(name, value, nil)
+	}
+
+	if procs := parseUints(strings.SplitN(fields[3], "/", 2)); len(procs) == 2 {
+		result.gauge("ProcsRunning", float64(procs[0]), nil)
+		result.gauge("ProcsTotal", float64(procs[1]), nil)
+	}
+
+	return result.metrics, nil
+}
+
+// FDCollector Число открытых файловых дескрипторов в системе из /proc/sys/fs/file-nr
+type FDCollector struct {
+	fs procFS
+}
+
+func NewFDCollector(root string) *FDCollector {
+	return &FDCollector{fs: newProcFS(root)}
+}
+
+func (c *FDCollector) Name() string {
+	return "fd"
+}
+
+func (c *FDCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *FDCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	// <выделено> <свободно> <максимум>
+	data, err := c.fs.readString("proc", "sys", "fs", "file-nr")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(data)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid file-nr format: %q", data)
+	}
+
+	values := parseUints(fields)
+
+	result := collected{}
+	result.gauge("OpenFDs", float64(values[0]-values[1]), nil)
+	result.gauge("MaxFDs", float64(values[2]), nil)
+
+	return result.metrics, nil
+}
+
+// StatCollector Переключения контекста, прерывания и созданные процессы из /proc/stat
+type StatCollector struct {
+	fs       procFS
+	counters *counterState
+}
+
+func NewStatCollector(root string) *StatCollector {
+	return &StatCollector{
+		fs:       newProcFS(root),
+		counters: newCounterState(),
+	}
+}
+
+func (c *StatCollector) Name() string {
+	return "stat"
+}
+
+func (c *StatCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *StatCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	lines, err := c.fs.readLines("proc", "stat")
+	if err != nil {
+		return nil, err
+	}
+
+	result := collected{counters: c.counters}
+
+	for _, line := range lines {
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+
+		switch fields[0] {
+		case "ctxt":
+			result.counter("ContextSwitches", value, nil)
+		case "intr":
+			result.counter("Interrupts", value, nil)
+		case "processes":
+			result.counter("ProcessesForked", value, nil)
+		case "procs_blocked":
+			result.gauge("ProcsBlocked", float64(value), nil)
+		}
+	}
+
+	c.counters.sweep()
+	return result.metrics, nil
+}
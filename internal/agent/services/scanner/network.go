@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// NetworkCollector Метрики сетевых интерфейсов из /proc/net/dev и состояние линка из /sys/class/net.
+// Интерфейс lo не учитывается.
+type NetworkCollector struct {
+	fs       procFS
+	counters *counterState
+}
+
+func NewNetworkCollector(root string) *NetworkCollector {
+	return &NetworkCollector{
+		fs:       newProcFS(root),
+		counters: newCounterState(),
+	}
+}
+
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+func (c *NetworkCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *NetworkCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	lines, err := c.fs.readLines("proc", "net", "dev")
+	if err != nil {
+		return nil, err
+	}
+
+	result := collected{counters: c.counters}
+
+	for _, line := range lines {
+
+		// <iface>: bytes packets errs drop fifo frame compressed multicast | bytes packets errs drop ...
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		iface := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if len(fields) < 16 || iface == "lo" {
+			continue
+		}
+
+		values := parseUints(fields)
+		labels := map[string]string{"interface": iface}
+
+		result.counter("NetBytesRecv", values[0], labels)
+		result.counter("NetPacketsRecv", values[1], labels)
+		result.counter("NetErrorsRecv", values[2], labels)
+		result.counter("NetDropRecv", values[3], labels)
+		result.counter("NetBytesSent", values[8], labels)
+		result.counter("NetPacketsSent", values[9], labels)
+		result.counter("NetErrorsSent", values[10], labels)
+		result.counter("NetDropSent", values[11], labels)
+
+		if state, errState := c.fs.readString("sys", "class", "net", iface, "operstate"); errState == nil {
+			up := 0.0
+			if state == "up" {
+				up = 1
+			}
+			result.gauge("NetLinkUp", up, labels)
+		}
+	}
+
+	c.counters.sweep()
+	return result.metrics, nil
+}
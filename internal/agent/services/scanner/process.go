@@ -0,0 +1,361 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// pidFilePrefix Префикс селектора процесса по PID файлу
+const pidFilePrefix = "pidfile:"
+
+// clockTicks Частота тиков процессорного времени в /proc/<pid>/stat (USER_HZ)
+const clockTicks = 100
+
+// ProcessSelector Группа процессов, метрики которых суммируются и отправляются с меткой process=Name.
+// Процессы выбираются по регулярному выражению для имени или командной строки, либо по PID файлу.
+type ProcessSelector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	PIDFile string
+}
+
+// ParseProcessSelectors Разбор групп процессов из пар <имя>: <селектор>.
+// Селектор pidfile:<путь> выбирает процесс из PID файла, иначе селектор - регулярное выражение.
+func ParseProcessSelectors(processes map[string]string) ([]ProcessSelector, error) {
+
+	selectors := make([]ProcessSelector, 0, len(processes))
+
+	for name, selector := range processes {
+
+		if strings.HasPrefix(selector, pidFilePrefix) {
+			selectors = append(selectors, ProcessSelector{Name: name, PIDFile: strings.TrimPrefix(selector, pidFilePrefix)})
+			continue
+		}
+
+		pattern, err := regexp.Compile(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid process selector %s: %w", name, err)
+		}
+
+		selectors = append(selectors, ProcessSelector{Name: name, Pattern: pattern})
+	}
+
+	sort.Slice(selectors, func(i, j int) bool { return selectors[i].Name < selectors[j].Name })
+	return selectors, nil
+}
+
+type (
+	// procKey Процесс, идентифицированный PID и временем запуска, чтобы не спутать его с новым процессом с тем же PID
+	procKey struct {
+		pid   int
+		start uint64
+	}
+
+	// procCounters Накопленные счетчики процесса
+	procCounters struct {
+		cpuMs      uint64
+		readBytes  uint64
+		writeBytes uint64
+	}
+
+	// procSample Значения процесса за один опрос
+	procSample struct {
+		key      procKey
+		rss      uint64
+		threads  uint64
+		fds      uint64
+		counters procCounters
+	}
+)
+
+// ProcessCollector Метрики групп процессов из /proc/<pid>.
+// Счетчики группы - сумма приращений процессов группы, поэтому завершение и запуск процессов
+// между опросами не приводят к скачкам: процесс, запущенный после предыдущего опроса, учитывается
+// с начала его работы, а завершившийся процесс просто перестает учитываться.
+// Процесс, запущенный раньше, но не найденный при предыдущем опросе (например, из-за ошибки чтения
+// или отсутствия PID файла), учитывается со следующего опроса.
+type ProcessCollector struct {
+	fs        procFS
+	selectors []ProcessSelector
+	pageSize  uint64
+	now       func() time.Time
+
+	mu     sync.Mutex
+	polled time.Time // время предыдущего опроса, нулевое до первого опроса
+	last   map[string]map[procKey]procCounters
+}
+
+func NewProcessCollector(root string, selectors []ProcessSelector) *ProcessCollector {
+	return &ProcessCollector{
+		fs:        newProcFS(root),
+		selectors: selectors,
+		pageSize:  uint64(os.Getpagesize()),
+		now:       time.Now,
+		last:      make(map[string]map[procKey]procCounters),
+	}
+}
+
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+func (c *ProcessCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *ProcessCollector) Collect(ctx context.Context) ([]metric.Metric, error) {
+
+	now := c.now()
+
+	groups, err := c.match(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Без времени загрузки нельзя определить, запущен ли процесс после предыдущего опроса
+	boot, _ := c.bootTime()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := collected{}
+
+	for _, selector := range c.selectors {
+
+		labels := map[string]string{"process": selector.Name}
+		last := c.last[selector.Name]
+		current := make(map[procKey]procCounters)
+
+		var rss, threads, fds uint64
+		var delta procCounters
+
+		for _, pid := range groups[selector.Name] {
+
+			sample, ok := c.sample(pid)
+			if !ok {
+				// Процесс завершился между поиском и чтением
+				continue
+			}
+
+			rss += sample.rss
+			threads += sample.threads
+			fds += sample.fds
+			current[sample.key] = sample.counters
+
+			prev, seen := last[sample.key]
+			if !seen && !c.startedSincePoll(sample.key.start, boot) {
+				continue
+			}
+
+			delta.cpuMs += increase(prev.cpuMs, sample.counters.cpuMs)
+			delta.readBytes += increase(prev.readBytes, sample.counters.readBytes)
+			delta.writeBytes += increase(prev.writeBytes, sample.counters.writeBytes)
+		}
+
+		c.last[selector.Name] = current
+
+		result.gauge("ProcessCount", float64(len(current)), labels)
+		if len(current) == 0 {
+			continue
+		}
+
+		result.gauge("ProcessRSSBytes", float64(rss), labels)
+		result.gauge("ProcessThreads", float64(threads), labels)
+		result.gauge("ProcessOpenFDs", float64(fds), labels)
+
+		if !c.polled.IsZero() {
+			for _, counter := range []struct {
+				name  string
+				value uint64
+			}{
+				{"ProcessCPUTimeMs", delta.cpuMs},
+				{"ProcessReadBytes", delta.readBytes},
+				{"ProcessWriteBytes", delta.writeBytes},
+			} {
+				m, _ := metric.CreateMetric(metric.CounterType, counter.name,
+					metric.WithValueInt(int64(counter.value)), metric.WithLabels(labels))
+				result.metrics = append(result.metrics, m)
+			}
+		}
+	}
+
+	c.polled = now
+	return result.metrics, nil
+}
+
+// startedSincePoll Запущен ли процесс после предыдущего опроса; start - время запуска в тиках от загрузки.
+// До первого опроса и при неизвестном времени загрузки процесс считается запущенным раньше.
+func (c *ProcessCollector) startedSincePoll(start uint64, boot time.Time) bool {
+
+	if c.polled.IsZero() || boot.IsZero() {
+		return false
+	}
+
+	started := boot.Add(time.Duration(start) * time.Second / clockTicks)
+	return !started.Before(c.polled)
+}
+
+// bootTime Время загрузки системы из строки btime файла /proc/stat
+func (c *ProcessCollector) bootTime() (time.Time, error) {
+
+	lines, err := c.fs.readLines("proc", "stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+
+		seconds, errParse := strconv.ParseInt(fields[1], 10, 64)
+		if errParse != nil {
+			return time.Time{}, fmt.Errorf("invalid btime in /proc/stat: %w", errParse)
+		}
+
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
+}
+
+// match PID процессов каждой группы
+func (c *ProcessCollector) match(ctx context.Context) (map[string][]int, error) {
+
+	groups := make(map[string][]int, len(c.selectors))
+	patterns := false
+
+	for _, selector := range c.selectors {
+		if selector.Pattern != nil {
+			patterns = true
+			continue
+		}
+
+		// Отсутствующий или устаревший PID файл означает, что процесс не запущен
+		data, err := c.fs.readString(selector.PIDFile)
+		if err != nil {
+			continue
+		}
+
+		if pid, errPID := strconv.Atoi(data); errPID == nil {
+			groups[selector.Name] = append(groups[selector.Name], pid)
+		}
+	}
+
+	if !patterns {
+		return groups, nil
+	}
+
+	entries, err := os.ReadDir(c.fs.path("proc"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		pid, errPID := strconv.Atoi(entry.Name())
+		if errPID != nil {
+			continue
+		}
+
+		comm, errComm := c.fs.readString("proc", entry.Name(), "comm")
+		if errComm != nil {
+			continue
+		}
+
+		cmdline, _ := os.ReadFile(c.fs.path("proc", entry.Name(), "cmdline"))
+		command := strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+
+		for _, selector := range c.selectors {
+			if selector.Pattern != nil && (selector.Pattern.MatchString(comm) || selector.Pattern.MatchString(command)) {
+				groups[selector.Name] = append(groups[selector.Name], pid)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// sample Чтение метрик процесса pid; false, если процесс не существует
+func (c *ProcessCollector) sample(pid int) (procSample, bool) {
+
+	dir := strconv.Itoa(pid)
+
+	stat, err := c.fs.readString("proc", dir, "stat")
+	if err != nil {
+		return procSample{}, false
+	}
+
+	// Имя процесса в скобках может содержать пробелы, поля считаются после последней скобки:
+	// state(3) ... utime(14) stime(15) ... num_threads(20) itrealvalue(21) starttime(22) vsize(23) rss(24)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return procSample{}, false
+	}
+
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return procSample{}, false
+	}
+
+	values := parseUints(fields)
+	field := func(n int) uint64 { return values[n-3] }
+
+	sample := procSample{
+		key:     procKey{pid: pid, start: field(22)},
+		rss:     field(24) * c.pageSize,
+		threads: field(20),
+		counters: procCounters{
+			cpuMs: (field(14) + field(15)) * 1000 / clockTicks,
+		},
+	}
+
+	// Дескрипторы и ввод-вывод чужих процессов могут быть недоступны без прав, тогда они не учитываются
+	if entries, errFD := os.ReadDir(c.fs.path("proc", dir, "fd")); errFD == nil {
+		sample.fds = uint64(len(entries))
+	}
+
+	if lines, errIO := c.fs.readLines("proc", dir, "io"); errIO == nil {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+
+			value, _ := strconv.ParseUint(fields[1], 10, 64)
+
+			switch fields[0] {
+			case "read_bytes:":
+				sample.counters.readBytes = value
+			case "write_bytes:":
+				sample.counters.writeBytes = value
+			}
+		}
+	}
+
+	return sample, true
+}
+
+// increase Приращение счетчика; значение могло стать меньше, если в прошлый раз оно было недоступно
+func increase(prev, current uint64) uint64 {
+	if current < prev {
+		return 0
+	}
+
+	return current - prev
+}
@@ -0,0 +1,208 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProcess Процесс в тестовом дереве /proc
+type fakeProcess struct {
+	pid     int
+	comm    string
+	cmdline []string
+	ticks   uint64 // utime + stime
+	threads int
+	start   uint64
+	pages   uint64
+	fds     int
+	read    uint64
+	write   uint64
+}
+
+func writeProcess(t *testing.T, root string, p fakeProcess) {
+
+	dir := filepath.Join(root, "proc", fmt.Sprint(p.pid))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0o755))
+
+	// pid (comm) state ppid pgrp session tty tpgid flags minflt cminflt majflt cmajflt utime stime
+	// cutime cstime priority nice num_threads itrealvalue starttime vsize rss ...
+	stat := fmt.Sprintf("%d (%s) S 1 1 1 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 %d 0 %d 1000000 %d 0 0 0",
+		p.pid, p.comm, p.ticks/2, p.ticks-p.ticks/2, p.threads, p.start, p.pages)
+	io := fmt.Sprintf("rchar: 1\nwchar: 1\nsyscr: 1\nsyscw: 1\nread_bytes: %d\nwrite_bytes: %d\ncancelled_write_bytes: 0\n",
+		p.read, p.write)
+
+	files := map[string]string{
+		"stat":    stat,
+		"comm":    p.comm + "\n",
+		"cmdline": strings.Join(p.cmdline, "\x00") + "\x00",
+		"io":      io,
+	}
+
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	for fd := 0; fd < p.fds; fd++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "fd", fmt.Sprint(fd)), nil, 0o644))
+	}
+}
+
+func TestParseProcessSelectors(t *testing.T) {
+
+	selectors, err := ParseProcessSelectors(map[string]string{
+		"web": "^nginx",
+		"db":  "pidfile:/run/postgres.pid",
+	})
+	require.NoError(t, err)
+	require.Len(t, selectors, 2)
+
+	assert.Equal(t, "db", selectors[0].Name)
+	assert.Equal(t, "/run/postgres.pid", selectors[0].PIDFile)
+	assert.Nil(t, selectors[0].Pattern)
+	assert.True(t, selectors[1].Pattern.MatchString("nginx"))
+
+	_, err = ParseProcessSelectors(map[string]string{"bad": "("})
+	assert.Error(t, err)
+}
+
+func TestProcessCollector(t *testing.T) {
+
+	root := t.TempDir()
+
+	master := fakeProcess{pid: 100, comm: "nginx", cmdline: []string{"nginx: master process"},
+		ticks: 100, threads: 1, start: 10, pages: 10, fds: 3, read: 1000, write: 500}
+	worker := fakeProcess{pid: 101, comm: "nginx", cmdline: []string{"nginx: worker process"},
+		ticks: 300, threads: 4, start: 11, pages: 20, fds: 5, read: 0, write: 100}
+	java := fakeProcess{pid: 300, comm: "java", cmdline: []string{"java", "-jar", "billing.jar"},
+		ticks: 50, threads: 30, start: 12, pages: 100, fds: 2}
+	postgres := fakeProcess{pid: 200, comm: "postgres", cmdline: []string{"postgres", "-D", "/data"},
+		ticks: 1000, threads: 1, start: 5, pages: 1000, fds: 10}
+
+	for _, p := range []fakeProcess{master, worker, java, postgres} {
+		writeProcess(t, root, p)
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "run"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "run", "postgres.pid"), []byte("200\n"), 0o644))
+
+	selectors, err := ParseProcessSelectors(map[string]string{
+		"nginx":   "^nginx$",
+		"billing": "billing\\.jar",
+		"db":      "pidfile:/run/postgres.pid",
+		"absent":  "^redis",
+	})
+	require.NoError(t, err)
+
+	// Время запуска процессов в тиках от загрузки, опросы идут на 4, 6 и 8 секунде после загрузки
+	boot := time.Unix(1666000000, 0)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "stat"), []byte("cpu  1 2 3 4\nbtime 1666000000\n"), 0o644))
+
+	now := boot.Add(4 * time.Second)
+
+	c := NewProcessCollector(root, selectors)
+	c.pageSize = 4096
+	c.now = func() time.Time { return now }
+
+	first := collect(t, c)
+
+	assert.Equal(t, 2.0, *first[`ProcessCount{process="nginx"}`].Value)
+	assert.Equal(t, 30.0*4096, *first[`ProcessRSSBytes{process="nginx"}`].Value)
+	assert.Equal(t, 5.0, *first[`ProcessThreads{process="nginx"}`].Value)
+	assert.Equal(t, 8.0, *first[`ProcessOpenFDs{process="nginx"}`].Value)
+	assert.Equal(t, 1.0, *first[`ProcessCount{process="billing"}`].Value)
+	assert.Equal(t, 1.0, *first[`ProcessCount{process="db"}`].Value)
+	assert.Equal(t, 0.0, *first[`ProcessCount{process="absent"}`].Value)
+	assert.NotContains(t, first, `ProcessRSSBytes{process="absent"}`)
+
+	// Первый опрос только запоминает счетчики
+	assert.NotContains(t, first, `ProcessCPUTimeMs{process="nginx"}`)
+
+	// Воркер перезапускается с тем же PID, мастер работает дальше, postgres остановлен
+	master.ticks += 20
+	master.read += 4096
+	writeProcess(t, root, master)
+
+	restarted := worker
+	restarted.start = 500
+	restarted.ticks = 10
+	restarted.write = 8
+	writeProcess(t, root, restarted)
+
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "proc", "200")))
+
+	// Процесс billing временно не прочитан
+	require.NoError(t, os.Rename(filepath.Join(root, "proc", "300"), filepath.Join(root, "hidden")))
+
+	now = boot.Add(6 * time.Second)
+	second := collect(t, c)
+
+	assert.Equal(t, int64((20+10)*1000/clockTicks), *second[`ProcessCPUTimeMs{process="nginx"}`].Delta)
+	assert.Equal(t, int64(4096), *second[`ProcessReadBytes{process="nginx"}`].Delta)
+	assert.Equal(t, int64(8), *second[`ProcessWriteBytes{process="nginx"}`].Delta)
+	assert.Equal(t, 0.0, *second[`ProcessCount{process="billing"}`].Value)
+
+	assert.Equal(t, 0.0, *second[`ProcessCount{process="db"}`].Value)
+	assert.NotContains(t, second, `ProcessCPUTimeMs{process="db"}`)
+
+	// Процесс снова запущен под новым PID
+	postgres.pid = 210
+	postgres.start = 700
+	writeProcess(t, root, postgres)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "run", "postgres.pid"), []byte("210"), 0o644))
+
+	// Процесс billing снова прочитан: он запущен до предыдущего опроса, поэтому его накопленное
+	// процессорное время не считается приращением
+	require.NoError(t, os.Rename(filepath.Join(root, "hidden"), filepath.Join(root, "proc", "300")))
+
+	now = boot.Add(8 * time.Second)
+	third := collect(t, c)
+	assert.Equal(t, 1.0, *third[`ProcessCount{process="db"}`].Value)
+	assert.Equal(t, int64(1000*1000/clockTicks), *third[`ProcessCPUTimeMs{process="db"}`].Delta)
+	assert.Equal(t, 1.0, *third[`ProcessCount{process="billing"}`].Value)
+	assert.Equal(t, int64(0), *third[`ProcessCPUTimeMs{process="billing"}`].Delta)
+
+	java.ticks += 30
+	writeProcess(t, root, java)
+
+	now = boot.Add(10 * time.Second)
+	fourth := collect(t, c)
+	assert.Equal(t, int64(30*1000/clockTicks), *fourth[`ProcessCPUTimeMs{process="billing"}`].Delta)
+}
+
+func TestProcessCollector_Self(t *testing.T) {
+
+	selectors, err := ParseProcessSelectors(map[string]string{
+		"self": fmt.Sprintf("pidfile:%s", writePIDFile(t)),
+	})
+	require.NoError(t, err)
+
+	c := NewProcessCollector("/", selectors)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := bySeries(metrics)
+	assert.Equal(t, 1.0, *got[`ProcessCount{process="self"}`].Value)
+	assert.Greater(t, *got[`ProcessRSSBytes{process="self"}`].Value, 0.0)
+	assert.Greater(t, *got[`ProcessOpenFDs{process="self"}`].Value, 0.0)
+}
+
+func writePIDFile(t *testing.T) string {
+
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc is not available")
+	}
+
+	path := filepath.Join(t.TempDir(), "self.pid")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprint(os.Getpid())), 0o644))
+
+	return path
+}
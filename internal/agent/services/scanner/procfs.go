@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// procFS Чтение файлов /proc и /sys относительно корня файловой системы хоста.
+// Корень отличается от "/", когда агент работает в контейнере с примонтированной файловой системой хоста.
+type procFS struct {
+	root string
+}
+
+func newProcFS(root string) procFS {
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	return procFS{root: root}
+}
+
+func (fs procFS) path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// readLines Строки файла без завершающих пробелов
+func (fs procFS) readLines(elem ...string) ([]string, error) {
+
+	file, err := os.Open(fs.path(elem...))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0)
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		lines = append(lines, strings.TrimSpace(scan.Text()))
+	}
+
+	return lines, scan.Err()
+}
+
+// readString Содержимое файла без завершающих пробелов
+func (fs procFS) readString(elem ...string) (string, error) {
+
+	data, err := os.ReadFile(fs.path(elem...))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseUints Разбор полей-чисел; неразобранные поля равны 0
+func parseUints(fields []string) []uint64 {
+
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		values[i], _ = strconv.ParseUint(field, 10, 64)
+	}
+
+	return values
+}
+
+// counterState Преобразование накопленных значений счетчиков ядра в приращения между опросами.
+// Для первого значения серии приращение неизвестно, поэтому метрика не возвращается;
+// если значение уменьшилось (сброс счетчика), приращением считается текущее значение.
+type counterState struct {
+	mu   sync.Mutex
+	last map[string]uint64
+	seen map[string]bool
+}
+
+func newCounterState() *counterState {
+	return &counterState{
+		last: make(map[string]uint64),
+		seen: make(map[string]bool),
+	}
+}
+
+// counter Метрика counter с приращением значения value серии name с метками labels
+func (s *counterState) counter(name string, value uint64, labels map[string]string) (metric.Metric, bool) {
+
+	m, err := metric.CreateMetric(metric.CounterType, name, metric.WithLabels(labels))
+	if err != nil {
+		return m, false
+	}
+
+	key := m.SeriesKey()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.last[key]
+	s.last[key] = value
+	s.seen[key] = true
+
+	if !ok {
+		return m, false
+	}
+
+	delta := value - last
+	if value < last {
+		delta = value
+	}
+
+	d := int64(delta)
+	m.Delta = &d
+	return m, true
+}
+
+// sweep Удаление серий, которые не встречались с прошлого вызова sweep, например исчезнувших устройств
+func (s *counterState) sweep() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.last {
+		if !s.seen[key] {
+			delete(s.last, key)
+		}
+	}
+
+	s.seen = make(map[string]bool, len(s.last))
+}
+
+// collected Накопление метрик сборщика
+type collected struct {
+	metrics  []metric.Metric
+	counters *counterState
+}
+
+func (c *collected) gauge(name string, value float64, labels map[string]string) {
+	m, err := metric.CreateMetric(metric.GaugeType, name, metric.WithValueFloat(value), metric.WithLabels(labels))
+	if err == nil {
+		c.metrics = append(c.metrics, m)
+	}
+}
+
+func (c *collected) counter(name string, value uint64, labels map[string]string) {
+	if m, ok := c.counters.counter(name, value, labels); ok {
+		c.metrics = append(c.metrics, m)
+	}
+}
@@ -0,0 +1,231 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureRoot Копия тестового дерева /proc и /sys, которую тест может изменять между опросами
+func fixtureRoot(t *testing.T) string {
+
+	root := t.TempDir()
+
+	err := filepath.Walk("testdata/root", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, strings.TrimPrefix(path, "testdata/root"))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(target, data, 0o644)
+	})
+	require.NoError(t, err)
+
+	return root
+}
+
+// replaceInFixture Замена текста в файле тестового дерева
+func replaceInFixture(t *testing.T, root, file, old, new string) {
+
+	path := filepath.Join(root, file)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), old)
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o644))
+}
+
+func bySeries(metrics []metric.Metric) map[string]metric.Metric {
+
+	series := make(map[string]metric.Metric, len(metrics))
+	for _, m := range metrics {
+		series[m.SeriesKey()] = m
+	}
+
+	return series
+}
+
+func collect(t *testing.T, c Collector) map[string]metric.Metric {
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	return bySeries(metrics)
+}
+
+func TestDiskCollector(t *testing.T) {
+
+	root := fixtureRoot(t)
+	c := NewDiskCollector(root)
+
+	// Первый опрос запоминает значения счетчиков ядра, приращения еще неизвестны
+	first := collect(t, c)
+	assert.Len(t, first, 2)
+	assert.Equal(t, 1.0, *first[`DiskIOInProgress{device="sda"}`].Value)
+	assert.Contains(t, first, `DiskIOInProgress{device="nvme0n1"}`)
+
+	replaceInFixture(t, root, "proc/diskstats",
+		"sda 1000 10 20000 500 2000 20 40000 900 1 1500",
+		"sda 1010 10 20100 500 2004 20 40008 900 0 1600")
+
+	second := collect(t, c)
+
+	want := map[string]int64{
+		"DiskReads":      10,
+		"DiskReadBytes":  100 * sectorSize,
+		"DiskWrites":     4,
+		"DiskWriteBytes": 8 * sectorSize,
+		"DiskIOTimeMs":   100,
+	}
+
+	for name, delta := range want {
+		m, ok := second[name+`{device="sda"}`]
+		require.True(t, ok, name)
+		assert.Equal(t, metric.CounterType, m.MType, name)
+		assert.Equal(t, delta, *m.Delta, name)
+		assert.Equal(t, int64(0), *second[name+`{device="nvme0n1"}`].Delta, name)
+	}
+
+	for key := range second {
+		assert.NotContains(t, key, "loop0")
+		assert.NotContains(t, key, "sda1")
+	}
+}
+
+func TestNetworkCollector(t *testing.T) {
+
+	root := fixtureRoot(t)
+	c := NewNetworkCollector(root)
+
+	first := collect(t, c)
+	assert.Equal(t, 1.0, *first[`NetLinkUp{interface="eth0"}`].Value)
+	assert.Equal(t, 0.0, *first[`NetLinkUp{interface="wlan0"}`].Value)
+	assert.NotContains(t, first, `NetLinkUp{interface="lo"}`)
+
+	replaceInFixture(t, root, "proc/net/dev",
+		"eth0: 100000    1000    1    2    0     0          0         0    50000     500",
+		"eth0: 101500    1010    1    2    0     0          0         0    50700     507")
+
+	second := collect(t, c)
+	assert.Equal(t, int64(1500), *second[`NetBytesRecv{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(10), *second[`NetPacketsRecv{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(700), *second[`NetBytesSent{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(7), *second[`NetPacketsSent{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(0), *second[`NetErrorsSent{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(0), *second[`NetDropRecv{interface="wlan0"}`].Delta)
+}
+
+func TestLoadCollector(t *testing.T) {
+
+	got := collect(t, NewLoadCollector(fixtureRoot(t)))
+
+	assert.Equal(t, 0.5, *got["Load1"].Value)
+	assert.Equal(t, 0.75, *got["Load5"].Value)
+	assert.Equal(t, 1.25, *got["Load15"].Value)
+	assert.Equal(t, 2.0, *got["ProcsRunning"].Value)
+	assert.Equal(t, 300.0, *got["ProcsTotal"].Value)
+}
+
+func TestFDCollector(t *testing.T) {
+
+	got := collect(t, NewFDCollector(fixtureRoot(t)))
+
+	assert.Equal(t, 2000.0, *got["OpenFDs"].Value)
+	assert.Equal(t, metric.GaugeType, got["MaxFDs"].MType)
+}
+
+func TestStatCollector(t *testing.T) {
+
+	root := fixtureRoot(t)
+	c := NewStatCollector(root)
+
+	first := collect(t, c)
+	assert.Equal(t, 1.0, *first["ProcsBlocked"].Value)
+	assert.NotContains(t, first, "ContextSwitches")
+
+	replaceInFixture(t, root, "proc/stat", "ctxt 100000", "ctxt 100250")
+	replaceInFixture(t, root, "proc/stat", "processes 5000", "processes 5003")
+
+	second := collect(t, c)
+	assert.Equal(t, int64(250), *second["ContextSwitches"].Delta)
+	assert.Equal(t, int64(3), *second["ProcessesForked"].Delta)
+	assert.Equal(t, int64(0), *second["Interrupts"].Delta)
+
+	// После перезагрузки счетчики ядра начинаются заново
+	replaceInFixture(t, root, "proc/stat", "ctxt 100250", "ctxt 40")
+
+	third := collect(t, c)
+	assert.Equal(t, int64(40), *third["ContextSwitches"].Delta)
+}
+
+func TestFilesystemCollector(t *testing.T) {
+
+	root := fixtureRoot(t)
+	c := NewFilesystemCollector(root)
+
+	var paths []string
+	c.statfs = func(path string) (fsStats, error) {
+		paths = append(paths, path)
+
+		if strings.HasSuffix(path, "nfs") {
+			return fsStats{}, errors.New("stale file handle")
+		}
+
+		// Все свободные блоки зарезервированы, занятых нет
+		if strings.HasSuffix(path, "my data") {
+			return fsStats{Total: 1000, Free: 1000, Avail: 0}, nil
+		}
+
+		return fsStats{Total: 1000, Free: 400, Avail: 300, Inodes: 100, InodesFree: 60}, nil
+	}
+
+	got := collect(t, c)
+
+	// proc и sysfs пропускаются, повторная точка монтирования учитывается один раз
+	assert.Equal(t, []string{root, filepath.Join(root, "mnt/my data"), filepath.Join(root, "mnt/nfs")}, paths)
+
+	rootFS := `{device="/dev/sda1",fstype="ext4",mountpoint="/"}`
+	assert.Equal(t, 1000.0, *got["FsTotalBytes"+rootFS].Value)
+	assert.Equal(t, 600.0, *got["FsUsedBytes"+rootFS].Value)
+	assert.Equal(t, 300.0, *got["FsAvailBytes"+rootFS].Value)
+	assert.InDelta(t, 66.67, *got["FsUsedPercent"+rootFS].Value, 0.01)
+	assert.Equal(t, 60.0, *got["FsInodesFree"+rootFS].Value)
+
+	myData := `{device="/dev/sda2",fstype="xfs",mountpoint="/mnt/my data"}`
+	assert.Equal(t, 0.0, *got["FsUsedBytes"+myData].Value)
+	assert.NotContains(t, got, "FsUsedPercent"+myData)
+	assert.Len(t, got, 13)
+}
+
+func TestCounterState_Sweep(t *testing.T) {
+
+	state := newCounterState()
+	labels := map[string]string{"interface": "eth1"}
+
+	_, ok := state.counter("NetBytesRecv", 10, labels)
+	assert.False(t, ok)
+	state.sweep()
+
+	// Интерфейс пропал на один опрос: после появления приращение считается заново
+	state.sweep()
+
+	_, ok = state.counter("NetBytesRecv", 500, labels)
+	assert.False(t, ok)
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// RuntimeCollector Метрики runtime.MemStats, случайное значение и счетчик опросов PollCount
+type RuntimeCollector struct {
+	generator *rand.Rand
+}
+
+func NewRuntimeCollector() *RuntimeCollector {
+	return &RuntimeCollector{
+		generator: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (c *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+func (c *RuntimeCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *RuntimeCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	gauges := []struct {
+		name  string
+		value uint64
+	}{
+		{"Alloc", ms.Alloc},
+		{"BuckHashSys", ms.BuckHashSys},
+		{"Frees", ms.Frees},
+		{"GCSys", ms.GCSys},
+		{"HeapAlloc", ms.HeapAlloc},
+		{"HeapIdle", ms.HeapIdle},
+		{"HeapInuse", ms.HeapInuse},
+		{"HeapObjects", ms.HeapObjects},
+		{"HeapReleased", ms.HeapReleased},
+		{"HeapSys", ms.HeapSys},
+		{"LastGC", ms.LastGC},
+		{"Lookups", ms.Lookups},
+		{"MCacheInuse", ms.MCacheInuse},
+		{"MCacheSys", ms.MCacheSys},
+		{"MSpanInuse", ms.MSpanInuse},
+		{"MSpanSys", ms.MSpanSys},
+		{"Mallocs", ms.Mallocs},
+		{"NextGC", ms.NextGC},
+		{"NumForcedGC", uint64(ms.NumForcedGC)},
+		{"NumGC", uint64(ms.NumGC)},
+		{"OtherSys", ms.OtherSys},
+		{"PauseTotalNs", ms.PauseTotalNs},
+		{"StackInuse", ms.StackInuse},
+		{"StackSys", ms.StackSys},
+		{"Sys", ms.Sys},
+		{"TotalAlloc", ms.TotalAlloc},
+	}
+
+	metrics := make([]metric.Metric, 0, len(gauges)+3)
+
+	for _, g := range gauges {
+		m, _ := metric.CreateMetric(metric.GaugeType, g.name, metric.WithValueInt(int64(g.value)))
+		metrics = append(metrics, m)
+	}
+
+	GCCPUFraction, _ := metric.CreateMetric(metric.GaugeType, "GCCPUFraction", metric.WithValueFloat(ms.GCCPUFraction))
+	RandomValue, _ := metric.CreateMetric(metric.GaugeType, "RandomValue", metric.WithValueFloat(c.generator.Float64()))
+	PollCount, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(1))
+
+	return append(metrics, GCCPUFraction, RandomValue, PollCount), nil
+}
@@ -1,141 +1,201 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
-	"runtime"
+	"sync"
 	"time"
 
 	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/pkg/metric"
+)
+
+type (
+	OptionsScanner func(*Scanner)
+
+	// Scanner Запуск сборщиков метрик и запись собранных метрик в хранилище агента
+	Scanner struct {
+		storage    storage.Repository
+		collectors []Collector
+		timeout    time.Duration
+		now        func() time.Time
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
+		mu      sync.Mutex // защищает lastRun
+		lastRun map[string]time.Time
+	}
 )
 
-type Scanner struct {
-	storage storage.Repository
+func NewScanner(storage storage.Repository, opts ...OptionsScanner) *Scanner {
+
+	scan := &Scanner{
+		storage:    storage,
+		collectors: Builtin("/"),
+		timeout:    10 * time.Second,
+		now:        time.Now,
+		lastRun:    make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(scan)
+	}
+
+	return scan
 }
 
-func NewScanner(storage storage.Repository) *Scanner {
-	return &Scanner{
-		storage: storage,
+// WithCollectors Сборщики метрик вместо встроенных
+func WithCollectors(collectors ...Collector) OptionsScanner {
+	return func(scan *Scanner) {
+		scan.collectors = collectors
+	}
+}
+
+// WithTimeout Ограничение времени работы одного сборщика, если сборщик не задает собственное
+func WithTimeout(timeout time.Duration) OptionsScanner {
+	return func(scan *Scanner) {
+		if timeout > 0 {
+			scan.timeout = timeout
+		}
+	}
+}
+
+// Scan Один проход сканера: сборщики, для которых наступил интервал сбора, запускаются параллельно,
+// их метрики записываются в хранилище. Ошибка одного сборщика не мешает остальным;
+// все ошибки прохода возвращаются вместе в Errors.
+func (scan *Scanner) Scan(ctx context.Context) error {
+
+	due := scan.due()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs Errors
+	)
+
+	for _, c := range due {
+		wg.Add(1)
+
+		go func(c Collector) {
+			defer wg.Done()
+
+			if err := scan.run(ctx, c); err != nil {
+				mu.Lock()
+				errs = append(errs, CollectError{Collector: c.Name(), Err: err})
+				mu.Unlock()
+			}
+		}(c)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
 	}
+
+	return nil
 }
 
-func (scan *Scanner) Scan() error {
+// Close Остановка фоновой работы сборщиков, реализующих ClosingCollector
+func (scan *Scanner) Close() error {
+
+	var errs Errors
 
-	// TODO :: use errGroup
+	for _, c := range scan.collectors {
+		closer, ok := c.(ClosingCollector)
+		if !ok {
+			continue
+		}
 
-	if err := scan.updateRuntime(); err != nil {
-		return err
+		if err := closer.Close(); err != nil {
+			errs = append(errs, CollectError{Collector: c.Name(), Err: err})
+		}
 	}
 
-	if err := scan.updateWorkload(); err != nil {
-		return err
+	if len(errs) > 0 {
+		return errs
 	}
 
 	return nil
 }
 
-// updateRuntime Обновление runtime метрик
-func (scan *Scanner) updateRuntime() error {
-
-	// TODO :: set length slice
-	metrics := make([]metric.Metric, 0)
-
-	var ms runtime.MemStats
-	runtime.ReadMemStats(&ms)
-
-	generator := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	RandomValue, _ := metric.CreateMetric(metric.GaugeType, "RandomValue", metric.WithValueFloat(generator.Float64()))
-	Alloc, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueInt(int64(ms.Alloc)))
-	BuckHashSys, _ := metric.CreateMetric(metric.GaugeType, "BuckHashSys", metric.WithValueInt(int64(ms.BuckHashSys)))
-	Frees, _ := metric.CreateMetric(metric.GaugeType, "Frees", metric.WithValueInt(int64(ms.Frees)))
-	GCCPUFraction, _ := metric.CreateMetric(metric.GaugeType, "GCCPUFraction", metric.WithValueInt(int64(ms.GCCPUFraction)))
-	GCSys, _ := metric.CreateMetric(metric.GaugeType, "GCSys", metric.WithValueInt(int64(ms.GCSys)))
-	HeapAlloc, _ := metric.CreateMetric(metric.GaugeType, "HeapAlloc", metric.WithValueInt(int64(ms.HeapAlloc)))
-	HeapIdle, _ := metric.CreateMetric(metric.GaugeType, "HeapIdle", metric.WithValueInt(int64(ms.HeapIdle)))
-	HeapInuse, _ := metric.CreateMetric(metric.GaugeType, "HeapInuse", metric.WithValueInt(int64(ms.HeapInuse)))
-	HeapObjects, _ := metric.CreateMetric(metric.GaugeType, "HeapObjects", metric.WithValueInt(int64(ms.HeapObjects)))
-	HeapReleased, _ := metric.CreateMetric(metric.GaugeType, "HeapReleased", metric.WithValueInt(int64(ms.HeapReleased)))
-	HeapSys, _ := metric.CreateMetric(metric.GaugeType, "HeapSys", metric.WithValueInt(int64(ms.HeapSys)))
-	LastGC, _ := metric.CreateMetric(metric.GaugeType, "LastGC", metric.WithValueInt(int64(ms.LastGC)))
-	Lookups, _ := metric.CreateMetric(metric.GaugeType, "Lookups", metric.WithValueInt(int64(ms.Lookups)))
-	MCacheInuse, _ := metric.CreateMetric(metric.GaugeType, "MCacheInuse", metric.WithValueInt(int64(ms.MCacheInuse)))
-	MCacheSys, _ := metric.CreateMetric(metric.GaugeType, "MCacheSys", metric.WithValueInt(int64(ms.MCacheSys)))
-	MSpanInuse, _ := metric.CreateMetric(metric.GaugeType, "MSpanInuse", metric.WithValueInt(int64(ms.MSpanInuse)))
-	MSpanSys, _ := metric.CreateMetric(metric.GaugeType, "MSpanSys", metric.WithValueInt(int64(ms.MSpanSys)))
-	Mallocs, _ := metric.CreateMetric(metric.GaugeType, "Mallocs", metric.WithValueInt(int64(ms.Mallocs)))
-	NextGC, _ := metric.CreateMetric(metric.GaugeType, "NextGC", metric.WithValueInt(int64(ms.NextGC)))
-	NumForcedGC, _ := metric.CreateMetric(metric.GaugeType, "NumForcedGC", metric.WithValueInt(int64(ms.NumForcedGC)))
-	NumGC, _ := metric.CreateMetric(metric.GaugeType, "NumGC", metric.WithValueInt(int64(ms.NumGC)))
-	OtherSys, _ := metric.CreateMetric(metric.GaugeType, "OtherSys", metric.WithValueInt(int64(ms.OtherSys)))
-	PauseTotalNs, _ := metric.CreateMetric(metric.GaugeType, "PauseTotalNs", metric.WithValueInt(int64(ms.PauseTotalNs)))
-	StackInuse, _ := metric.CreateMetric(metric.GaugeType, "StackInuse", metric.WithValueInt(int64(ms.StackInuse)))
-	StackSys, _ := metric.CreateMetric(metric.GaugeType, "StackSys", metric.WithValueInt(int64(ms.StackSys)))
-	Sys, _ := metric.CreateMetric(metric.GaugeType, "Sys", metric.WithValueInt(int64(ms.Sys)))
-	TotalAlloc, _ := metric.CreateMetric(metric.GaugeType, "TotalAlloc", metric.WithValueInt(int64(ms.TotalAlloc)))
-	PollCount, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(1))
-
-	metrics = append(metrics, RandomValue)
-	metrics = append(metrics, Alloc)
-	metrics = append(metrics, BuckHashSys)
-	metrics = append(metrics, Frees)
-	metrics = append(metrics, GCCPUFraction)
-	metrics = append(metrics, GCSys)
-	metrics = append(metrics, HeapAlloc)
-	metrics = append(metrics, HeapIdle)
-	metrics = append(metrics, HeapInuse)
-	metrics = append(metrics, HeapObjects)
-	metrics = append(metrics, HeapReleased)
-	metrics = append(metrics, HeapSys)
-	metrics = append(metrics, LastGC)
-	metrics = append(metrics, Lookups)
-	metrics = append(metrics, MCacheInuse)
-	metrics = append(metrics, MCacheSys)
-	metrics = append(metrics, MSpanInuse)
-	metrics = append(metrics, MSpanSys)
-	metrics = append(metrics, Mallocs)
-	metrics = append(metrics, NextGC)
-	metrics = append(metrics, NumForcedGC)
-	metrics = append(metrics, NumGC)
-	metrics = append(metrics, OtherSys)
-	metrics = append(metrics, PauseTotalNs)
-	metrics = append(metrics, StackInuse)
-	metrics = append(metrics, StackSys)
-	metrics = append(metrics, Sys)
-	metrics = append(metrics, TotalAlloc)
-	metrics = append(metrics, PollCount)
-
-	return scan.storage.UpsertBatch(metrics)
+// due Сборщики, для которых наступил интервал сбора
+func (scan *Scanner) due() []Collector {
+
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+
+	now := scan.now()
+	due := make([]Collector, 0, len(scan.collectors))
+
+	for _, c := range scan.collectors {
+		last, ok := scan.lastRun[c.Name()]
+		if ok && now.Sub(last) < c.Interval() {
+			continue
+		}
+
+		scan.lastRun[c.Name()] = now
+		due = append(due, c)
+	}
+
+	return due
 }
 
-// updateRuntime Обновление метрик загрузки памяти и ядер процессора
-func (scan *Scanner) updateWorkload() error {
+// run Сбор метрик одним сборщиком с ограничением времени и запись их в хранилище
+func (scan *Scanner) run(ctx context.Context, c Collector) error {
 
-	vm, errVM := mem.VirtualMemory()
-	if errVM != nil {
-		return errVM
+	timeout := scan.timeout
+	if tc, ok := c.(TimeoutCollector); ok && tc.Timeout() > 0 {
+		timeout = tc.Timeout()
 	}
 
-	// TODO :: set length slice: 2 + cpuN
-	metrics := make([]metric.Metric, 0)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	TotalMemory, _ := metric.CreateMetric(metric.GaugeType, "TotalMemory", metric.WithValueInt(int64(vm.Total)))
-	FreeMemory, _ := metric.CreateMetric(metric.GaugeType, "FreeMemory", metric.WithValueInt(int64(vm.Free)))
+	type result struct {
+		metrics []metric.Metric
+		err     error
+	}
+
+	// Сборщик, не отвечающий на отмену контекста, не должен задерживать проход сканера
+	done := make(chan result, 1)
+	go func() {
+		metrics, err := c.Collect(ctx)
+		done <- result{metrics: metrics, err: err}
+	}()
+
+	var res result
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res = <-done:
+	}
+
+	if errStore := scan.store(res.metrics); errStore != nil {
+		return errStore
+	}
 
-	metrics = append(metrics, TotalMemory)
-	metrics = append(metrics, FreeMemory)
+	return res.err
+}
+
+// store Запись метрик в хранилище: gauge заменяют значения, приращения counter прибавляются,
+// приращения histogram сливаются с накопленными
+func (scan *Scanner) store(metrics []metric.Metric) error {
+
+	gauges := make([]metric.Metric, 0, len(metrics))
 
-	percentage, _ := cpu.Percent(0, true)
-	for cpuID, cpuUtilization := range percentage {
+	for _, m := range metrics {
+		if m.MType != metric.CounterType && m.MType != metric.HistogramType {
+			gauges = append(gauges, m)
+			continue
+		}
+
+		if _, err := scan.storage.Add(m); err != nil {
+			return fmt.Errorf("could not add %s %s: %w", m.MType, m.ShotString(), err)
+		}
+	}
 
-		name := "CPUutilization" + fmt.Sprint(cpuID+1)
-		cpuN, _ := metric.CreateMetric(metric.GaugeType, name, metric.WithValueFloat(cpuUtilization))
-		metrics = append(metrics, cpuN)
+	if len(gauges) == 0 {
+		return nil
 	}
 
-	return scan.storage.UpsertBatch(metrics)
+	return scan.storage.UpsertBatch(gauges)
 }
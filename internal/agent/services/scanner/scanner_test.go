@@ -0,0 +1,201 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage/memstore"
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCollector Сборщик с настраиваемым результатом
+type fakeCollector struct {
+	name     string
+	interval time.Duration
+	timeout  time.Duration
+	collect  func(ctx context.Context) ([]metric.Metric, error)
+}
+
+func (c fakeCollector) Name() string            { return c.name }
+func (c fakeCollector) Interval() time.Duration { return c.interval }
+func (c fakeCollector) Timeout() time.Duration  { return c.timeout }
+func (c fakeCollector) Collect(ctx context.Context) ([]metric.Metric, error) {
+	return c.collect(ctx)
+}
+
+func gauge(name string, value float64) metric.Metric {
+	m, _ := metric.CreateMetric(metric.GaugeType, name, metric.WithValueFloat(value))
+	return m
+}
+
+func counter(name string, delta int64) metric.Metric {
+	m, _ := metric.CreateMetric(metric.CounterType, name, metric.WithValueInt(delta))
+	return m
+}
+
+func TestScanner_Concurrent(t *testing.T) {
+
+	// Оба сборщика ждут друг друга: проход завершится, только если они запущены параллельно
+	var started sync.WaitGroup
+	started.Add(2)
+
+	wait := func(name string) func(ctx context.Context) ([]metric.Metric, error) {
+		return func(ctx context.Context) ([]metric.Metric, error) {
+			started.Done()
+			started.Wait()
+			return []metric.Metric{gauge(name, 1)}, nil
+		}
+	}
+
+	store := memstore.New()
+	scan := NewScanner(store, WithTimeout(time.Second), WithCollectors(
+		fakeCollector{name: "a", collect: wait("A")},
+		fakeCollector{name: "b", collect: wait("B")},
+	))
+
+	require.NoError(t, scan.Scan(context.Background()))
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+func TestScanner_Errors(t *testing.T) {
+
+	errFailed := errors.New("failed")
+
+	store := memstore.New()
+	scan := NewScanner(store, WithTimeout(50*time.Millisecond), WithCollectors(
+		fakeCollector{name: "ok", collect: func(ctx context.Context) ([]metric.Metric, error) {
+			return []metric.Metric{gauge("Ok", 1)}, nil
+		}},
+		fakeCollector{name: "failed", collect: func(ctx context.Context) ([]metric.Metric, error) {
+			return nil, errFailed
+		}},
+		fakeCollector{name: "hung", collect: func(ctx context.Context) ([]metric.Metric, error) {
+			select {} // не отвечает на отмену контекста
+		}},
+		fakeCollector{name: "slow", timeout: time.Second, collect: func(ctx context.Context) ([]metric.Metric, error) {
+			time.Sleep(100 * time.Millisecond)
+			return []metric.Metric{gauge("Slow", 1)}, nil
+		}},
+	))
+
+	err := scan.Scan(context.Background())
+
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+
+	failed := make(map[string]error)
+	for _, e := range errs {
+		var collectErr CollectError
+		require.True(t, errors.As(e, &collectErr))
+		failed[collectErr.Collector] = collectErr.Err
+	}
+
+	assert.ErrorIs(t, failed["failed"], errFailed)
+	assert.ErrorIs(t, failed["hung"], context.DeadlineExceeded)
+
+	for _, name := range []string{"Ok", "Slow"} {
+		_, errGet := store.Get(gauge(name, 0))
+		assert.NoError(t, errGet, name)
+	}
+}
+
+func TestScanner_Counters(t *testing.T) {
+
+	store := memstore.New()
+	scan := NewScanner(store, WithCollectors(
+		fakeCollector{name: "count", collect: func(ctx context.Context) ([]metric.Metric, error) {
+			return []metric.Metric{counter("Events", 2)}, nil
+		}},
+	))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, scan.Scan(context.Background()))
+	}
+
+	got, err := store.Get(counter("Events", 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *got.Delta)
+}
+
+func TestScanner_Interval(t *testing.T) {
+
+	calls := make(map[string]int)
+	var mu sync.Mutex
+
+	collect := func(name string) func(ctx context.Context) ([]metric.Metric, error) {
+		return func(ctx context.Context) ([]metric.Metric, error) {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+			return nil, nil
+		}
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	scan := NewScanner(memstore.New(), WithCollectors(
+		fakeCollector{name: "every", collect: collect("every")},
+		fakeCollector{name: "minute", interval: time.Minute, collect: collect("minute")},
+	))
+	scan.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, scan.Scan(context.Background()))
+		now = now.Add(30 * time.Second)
+	}
+
+	assert.Equal(t, 4, calls["every"])
+	assert.Equal(t, 2, calls["minute"])
+}
+
+func TestSelect(t *testing.T) {
+
+	names := func(collectors []Collector) []string {
+		result := make([]string, 0, len(collectors))
+		for _, c := range collectors {
+			result = append(result, c.Name())
+		}
+		return result
+	}
+
+	all, err := Select(Builtin("/"), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runtime", "workload"}, names(all)[:2])
+
+	onlyRuntime, err := Select(Builtin("/"), []string{"runtime"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runtime"}, names(onlyRuntime))
+
+	withoutRuntime, err := Select(Builtin("/"), nil, []string{"runtime"})
+	require.NoError(t, err)
+	assert.Len(t, withoutRuntime, len(all)-1)
+	assert.NotContains(t, names(withoutRuntime), "runtime")
+
+	_, err = Select(Builtin("/"), []string{"unknown"}, nil)
+	assert.Error(t, err)
+}
+
+func TestRuntimeCollector(t *testing.T) {
+
+	metrics, err := NewRuntimeCollector().Collect(context.Background())
+	require.NoError(t, err)
+
+	byName := make(map[string]metric.Metric)
+	for _, m := range metrics {
+		byName[m.ID] = m
+	}
+
+	assert.Equal(t, metric.CounterType, byName["PollCount"].MType)
+	assert.Equal(t, int64(1), *byName["PollCount"].Delta)
+	assert.Equal(t, metric.GaugeType, byName["Alloc"].MType)
+	assert.Contains(t, byName, "RandomValue")
+}
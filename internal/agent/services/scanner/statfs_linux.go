@@ -0,0 +1,22 @@
+package scanner
+
+import "syscall"
+
+// statfs Размеры файловой системы, содержащей path
+func statfs(path string) (fsStats, error) {
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsStats{}, err
+	}
+
+	size := uint64(st.Bsize)
+
+	return fsStats{
+		Total:      st.Blocks * size,
+		Free:       st.Bfree * size,
+		Avail:      st.Bavail * size,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package scanner
+
+// statfs Размеры файловой системы поддерживаются только в Linux
+func statfs(_ string) (fsStats, error) {
+	return fsStats{}, errStatfsUnsupported
+}
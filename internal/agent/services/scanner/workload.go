@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// WorkloadCollector Метрики загрузки памяти и ядер процессора
+type WorkloadCollector struct{}
+
+func NewWorkloadCollector() *WorkloadCollector {
+	return &WorkloadCollector{}
+}
+
+func (c *WorkloadCollector) Name() string {
+	return "workload"
+}
+
+func (c *WorkloadCollector) Interval() time.Duration {
+	return 0
+}
+
+func (c *WorkloadCollector) Collect(ctx context.Context) ([]metric.Metric, error) {
+
+	vm, errVM := mem.VirtualMemoryWithContext(ctx)
+	if errVM != nil {
+		return nil, errVM
+	}
+
+	percentage, errCPU := cpu.PercentWithContext(ctx, 0, true)
+	if errCPU != nil {
+		return nil, errCPU
+	}
+
+	metrics := make([]metric.Metric, 0, 2+len(percentage))
+
+	TotalMemory, _ := metric.CreateMetric(metric.GaugeType, "TotalMemory", metric.WithValueInt(int64(vm.Total)))
+	FreeMemory, _ := metric.CreateMetric(metric.GaugeType, "FreeMemory", metric.WithValueInt(int64(vm.Free)))
+	metrics = append(metrics, TotalMemory, FreeMemory)
+
+	for cpuID, cpuUtilization := range percentage {
+
+		name := "CPUutilization" + fmt.Sprint(cpuID+1)
+		cpuN, _ := metric.CreateMetric(metric.GaugeType, name, metric.WithValueFloat(cpuUtilization))
+		metrics = append(metrics, cpuN)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,254 @@
+// Package spool Очередь неотправленных пакетов метрик агента
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"metrics-and-alerting/pkg/metric"
+)
+
+// batchExt Расширение файлов пакетов в каталоге очереди
+const batchExt = ".json"
+
+// Spool Ограниченная очередь пакетов метрик в порядке добавления.
+// Если задан каталог, каждый пакет хранится в отдельном файле <номер>.json и очередь
+// восстанавливается после перезапуска агента. Без каталога пакеты хранятся в памяти.
+// При переполнении удаляется самый старый пакет.
+type Spool struct {
+	mu      sync.Mutex
+	dir     string
+	max     int
+	seqs    []uint64                   // номера пакетов от старого к новому
+	batches map[uint64][]metric.Metric // пакеты в памяти, если каталог не задан
+	dropped int64                      // число пакетов, удаленных при переполнении
+}
+
+// New Открытие очереди в каталоге dir не более чем на max пакетов.
+// Пакеты, оставшиеся в каталоге, загружаются в порядке номеров.
+func New(dir string, max int) (*Spool, error) {
+
+	if max < 1 {
+		return nil, fmt.Errorf("spool size must be positive: %d", max)
+	}
+
+	s := &Spool{
+		dir:     dir,
+		max:     max,
+		batches: make(map[uint64][]metric.Metric),
+	}
+
+	if len(dir) == 0 {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create spool directory: %w", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read spool directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, batchExt) {
+			continue
+		}
+
+		seq, errSeq := strconv.ParseUint(strings.TrimSuffix(name, batchExt), 10, 64)
+		if errSeq != nil {
+			continue
+		}
+
+		s.seqs = append(s.seqs, seq)
+	}
+
+	sort.Slice(s.seqs, func(i, j int) bool { return s.seqs[i] < s.seqs[j] })
+
+	// Пакеты сверх max после уменьшения размера очереди
+	for len(s.seqs) > s.max {
+		if err = s.dropOldest(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Push Добавление пакета в конец очереди
+func (s *Spool) Push(batch []metric.Metric) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) == s.max {
+		if err := s.dropOldest(); err != nil {
+			return err
+		}
+	}
+
+	var seq uint64 = 1
+	if len(s.seqs) > 0 {
+		seq = s.seqs[len(s.seqs)-1] + 1
+	}
+
+	if len(s.dir) == 0 {
+		s.batches[seq] = batch
+	} else if err := s.write(seq, batch); err != nil {
+		return err
+	}
+
+	s.seqs = append(s.seqs, seq)
+	return nil
+}
+
+// Front Самый старый пакет очереди. Если очередь пуста, ok = false.
+func (s *Spool) Front() (batch []metric.Metric, ok bool, err error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) == 0 {
+		return nil, false, nil
+	}
+
+	seq := s.seqs[0]
+	if len(s.dir) == 0 {
+		return s.batches[seq], true, nil
+	}
+
+	data, err := ioutil.ReadFile(s.path(seq))
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read spooled batch: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &batch); err != nil {
+		return nil, false, fmt.Errorf("could not decode spooled batch %d: %w", seq, err)
+	}
+
+	return batch, true, nil
+}
+
+// ReplaceFront Замена самого старого пакета, например, оставшейся частью после частичной отправки
+func (s *Spool) ReplaceFront(batch []metric.Metric) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) == 0 {
+		return nil
+	}
+
+	seq := s.seqs[0]
+	if len(s.dir) == 0 {
+		s.batches[seq] = batch
+		return nil
+	}
+
+	return s.write(seq, batch)
+}
+
+// Pop Удаление самого старого пакета после отправки
+func (s *Spool) Pop() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) == 0 {
+		return nil
+	}
+
+	return s.remove()
+}
+
+// Len Число пакетов в очереди
+func (s *Spool) Len() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.seqs)
+}
+
+// Dropped Число пакетов, удаленных при переполнении очереди
+func (s *Spool) Dropped() int64 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// dropOldest Удаление самого старого пакета при переполнении, вызывается под блокировкой
+func (s *Spool) dropOldest() error {
+
+	if err := s.remove(); err != nil {
+		return err
+	}
+
+	s.dropped++
+	return nil
+}
+
+// remove Удаление самого старого пакета, вызывается под блокировкой
+func (s *Spool) remove() error {
+
+	seq := s.seqs[0]
+
+	if len(s.dir) == 0 {
+		delete(s.batches, seq)
+	} else if err := os.Remove(s.path(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove spooled batch: %w", err)
+	}
+
+	s.seqs = s.seqs[1:]
+	return nil
+}
+
+// write Запись пакета во временный файл с последующим переименованием,
+// чтобы при сбое в каталоге не оставалось частично записанных пакетов
+func (s *Spool) write(seq uint64, batch []metric.Metric) error {
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("could not encode batch: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, "batch-*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create spool file: %w", err)
+	}
+
+	_, errWrite := tmp.Write(data)
+	if errWrite == nil {
+		errWrite = tmp.Sync()
+	}
+
+	if errClose := tmp.Close(); errWrite == nil {
+		errWrite = errClose
+	}
+
+	if errWrite == nil {
+		errWrite = os.Rename(tmp.Name(), s.path(seq))
+	}
+
+	if errWrite != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("could not write spool file: %w", errWrite)
+	}
+
+	return nil
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, batchExt))
+}
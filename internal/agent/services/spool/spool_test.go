@@ -0,0 +1,107 @@
+package spool
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(t *testing.T, delta int64) []metric.Metric {
+
+	counter, err := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(delta))
+	require.NoError(t, err)
+
+	return []metric.Metric{counter}
+}
+
+func drain(t *testing.T, s *Spool) []int64 {
+
+	var deltas []int64
+
+	for {
+		b, ok, err := s.Front()
+		require.NoError(t, err)
+
+		if !ok {
+			return deltas
+		}
+
+		deltas = append(deltas, *b[0].Delta)
+		require.NoError(t, s.Pop())
+	}
+}
+
+func TestSpool_Order(t *testing.T) {
+
+	for name, dir := range map[string]string{"memory": "", "disk": t.TempDir()} {
+		t.Run(name, func(t *testing.T) {
+
+			s, err := New(dir, 3)
+			require.NoError(t, err)
+
+			for i := int64(1); i <= 5; i++ {
+				require.NoError(t, s.Push(batch(t, i)))
+			}
+
+			// Самые старые пакеты удалены при переполнении
+			assert.Equal(t, 3, s.Len())
+			assert.Equal(t, int64(2), s.Dropped())
+			assert.Equal(t, []int64{3, 4, 5}, drain(t, s))
+
+			require.NoError(t, s.Push(batch(t, 6)))
+			assert.Equal(t, []int64{6}, drain(t, s))
+		})
+	}
+}
+
+func TestSpool_Reopen(t *testing.T) {
+
+	dir := t.TempDir()
+
+	s, err := New(dir, 10)
+	require.NoError(t, err)
+
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, s.Push(batch(t, i)))
+	}
+	require.NoError(t, s.Pop())
+
+	// Посторонние файлы в каталоге не считаются пакетами
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "batch-1.tmp"), []byte("{"), 0600))
+
+	reopened, err := New(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+
+	require.NoError(t, reopened.Push(batch(t, 5)))
+	assert.Equal(t, []int64{4, 5}, drain(t, reopened))
+
+	_, err = New(dir, 0)
+	assert.Error(t, err)
+}
+
+func TestSpool_ReplaceFront(t *testing.T) {
+
+	for name, dir := range map[string]string{"memory": "", "disk": t.TempDir()} {
+		t.Run(name, func(t *testing.T) {
+
+			s, err := New(dir, 3)
+			require.NoError(t, err)
+
+			require.NoError(t, s.ReplaceFront(batch(t, 9)))
+			assert.Equal(t, 0, s.Len())
+
+			require.NoError(t, s.Push(batch(t, 1)))
+			require.NoError(t, s.Push(batch(t, 2)))
+			require.NoError(t, s.ReplaceFront(batch(t, 10)))
+
+			assert.Equal(t, 2, s.Len())
+			assert.Equal(t, []int64{10, 2}, drain(t, s))
+		})
+	}
+}
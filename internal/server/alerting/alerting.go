@@ -0,0 +1,344 @@
+package alerting
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// State Состояние алерта
+type State string
+
+const (
+	StateInactive State = "inactive"
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert Алерт, сработавший по правилу для конкретной метрики
+type Alert struct {
+	Rule       string            `json:"rule"`        // имя правила
+	Expr       string            `json:"expr"`        // выражение правила
+	MType      string            `json:"type"`        // тип метрики
+	ID         string            `json:"id"`          // имя метрики
+	Series     string            `json:"series"`      // серия метрики: имя и метки
+	Labels     map[string]string `json:"labels"`      // метки алерта
+	State      State             `json:"state"`       // текущее состояние
+	Value      float64           `json:"value"`       // значение метрики при последней проверке
+	ActiveAt   time.Time         `json:"active_at"`   // момент, когда условие начало выполняться
+	FiredAt    time.Time         `json:"fired_at"`    // момент перехода в firing
+	ResolvedAt time.Time         `json:"resolved_at"` // момент перехода в resolved
+}
+
+// Метки, которые движок добавляет каждому алерту
+const (
+	LabelAlertName = "alertname"
+	LabelType      = "type"
+	LabelID        = "id"
+)
+
+// Notifier Получатель уведомлений об алертах.
+// Notify вызывается после каждой проверки правил со всеми алертами в состоянии firing
+// и алертами, которые перешли в resolved при этой проверке.
+type Notifier interface {
+	Notify(now time.Time, alerts []Alert)
+}
+
+type (
+	OptionsEngine func(*Engine)
+
+	// Engine Движок правил алертинга.
+	// При каждом вызове Evaluate проверяет правила по всем метрикам хранилища
+	// и переводит алерты по состояниям pending -> firing -> resolved.
+	Engine struct {
+		mu       sync.Mutex
+		storage  storage.Repository
+		logger   *logpack.LogPack
+		notifier Notifier
+		rules    []Rule
+		alerts   map[string]*Alert
+		previous map[string]float64
+
+		// resolvedRetention Время, в течение которого resolved алерт остается в списке алертов
+		resolvedRetention time.Duration
+	}
+)
+
+// defaultResolvedRetention Время хранения resolved алертов по умолчанию
+const defaultResolvedRetention = 5 * time.Minute
+
+func New(storage storage.Repository, rules []Rule, logger *logpack.LogPack, opts ...OptionsEngine) *Engine {
+
+	engine := &Engine{
+		storage:  storage,
+		logger:   logger,
+		rules:    rules,
+		alerts:   make(map[string]*Alert),
+		previous: make(map[string]float64),
+
+		resolvedRetention: defaultResolvedRetention,
+	}
+
+	for _, opt := range opts {
+		opt(engine)
+	}
+
+	return engine
+}
+
+// WithNotifier Отправка уведомлений о firing и resolved алертах
+func WithNotifier(notifier Notifier) OptionsEngine {
+	return func(engine *Engine) {
+		engine.notifier = notifier
+	}
+}
+
+// WithResolvedRetention Время, в течение которого resolved алерт возвращается в Alerts.
+// При 0 алерт удаляется сразу после уведомления о переходе в resolved.
+func WithResolvedRetention(retention time.Duration) OptionsEngine {
+	return func(engine *Engine) {
+		if retention >= 0 {
+			engine.resolvedRetention = retention
+		}
+	}
+}
+
+// Rules Список правил движка
+func (engine *Engine) Rules() []Rule {
+	return engine.rules
+}
+
+// Evaluate Проверка всех правил на момент now.
+// Возвращает алерты, которые изменили состояние при этой проверке.
+func (engine *Engine) Evaluate(now time.Time) ([]Alert, error) {
+
+	metrics, err := engine.storage.GetBatch()
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate alert rules: %w", err)
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	changed := make([]Alert, 0)
+	seen := make(map[string]struct{}, len(engine.alerts))
+
+	for _, rule := range engine.rules {
+		for _, metric := range metrics {
+
+			if metric.MType != rule.MType || metric.ID != rule.ID {
+				continue
+			}
+
+			value, ok := valueOf(metric)
+			if !ok {
+				continue
+			}
+
+			key := alertKey(rule, metric)
+			seen[key] = struct{}{}
+
+			prev, known := engine.previous[key]
+			engine.previous[key] = value
+
+			alert, exists := engine.alerts[key]
+			if !exists {
+				alert = &Alert{
+					Rule:   rule.Name,
+					Expr:   rule.Expr,
+					MType:  metric.MType,
+					ID:     metric.ID,
+					Series: metric.SeriesKey(),
+					State:  StateInactive,
+					Labels: alertLabels(rule, metric),
+				}
+			}
+
+			alert.Value = value
+
+			if engine.transit(alert, rule, rule.match(value, prev, known), now) {
+				changed = append(changed, *alert)
+			}
+
+			if alert.State == StateInactive {
+				delete(engine.alerts, key)
+				continue
+			}
+
+			engine.alerts[key] = alert
+		}
+	}
+
+	// Метрики, которые пропали из хранилища, больше не удовлетворяют условию
+	for key, alert := range engine.alerts {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		if engine.transit(alert, Rule{}, false, now) {
+			changed = append(changed, *alert)
+		}
+
+		if alert.State == StateInactive {
+			delete(engine.alerts, key)
+		}
+	}
+
+	// Предыдущие значения пропавших серий больше не нужны, в том числе для серий без алертов
+	for key := range engine.previous {
+		if _, ok := seen[key]; !ok {
+			delete(engine.previous, key)
+		}
+	}
+
+	sortAlerts(changed)
+
+	if engine.notifier != nil {
+		engine.notifier.Notify(now, engine.notifiable(changed))
+	}
+
+	engine.expireResolved(now)
+
+	return changed, nil
+}
+
+// expireResolved Удаление resolved алертов, о которых уже уведомили и срок хранения которых истек
+func (engine *Engine) expireResolved(now time.Time) {
+
+	for key, alert := range engine.alerts {
+		if alert.State == StateResolved && now.Sub(alert.ResolvedAt) >= engine.resolvedRetention {
+			delete(engine.alerts, key)
+		}
+	}
+}
+
+// notifiable Алерты для уведомления: все firing и перешедшие в resolved при последней проверке
+func (engine *Engine) notifiable(changed []Alert) []Alert {
+
+	alerts := make([]Alert, 0, len(engine.alerts))
+	for _, alert := range engine.alerts {
+		if alert.State == StateFiring {
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	for _, alert := range changed {
+		if alert.State == StateResolved {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	sortAlerts(alerts)
+	return alerts
+}
+
+// transit Перевод алерта в следующее состояние.
+// Возвращает true, если состояние изменилось.
+func (engine *Engine) transit(alert *Alert, rule Rule, active bool, now time.Time) bool {
+
+	before := alert.State
+
+	switch {
+	case active && (alert.State == StateInactive || alert.State == StateResolved):
+		alert.ActiveAt = now
+		alert.FiredAt = time.Time{}
+		alert.ResolvedAt = time.Time{}
+		alert.State = StatePending
+
+		if rule.For <= 0 {
+			alert.FiredAt = now
+			alert.State = StateFiring
+		}
+
+	case active && alert.State == StatePending:
+		if now.Sub(alert.ActiveAt) >= rule.For {
+			alert.FiredAt = now
+			alert.State = StateFiring
+		}
+
+	case !active && alert.State == StatePending:
+		alert.State = StateInactive
+
+	case !active && alert.State == StateFiring:
+		alert.ResolvedAt = now
+		alert.State = StateResolved
+	}
+
+	if before == alert.State {
+		return false
+	}
+
+	if engine.logger != nil {
+		engine.logger.Info.Printf("alert %s [%s/%s]: %s -> %s\n", alert.Rule, alert.MType, alert.ID, before, alert.State)
+	}
+
+	return true
+}
+
+// Alerts Текущие алерты в состояниях pending, firing и resolved
+func (engine *Engine) Alerts() []Alert {
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(engine.alerts))
+	for _, alert := range engine.alerts {
+		alerts = append(alerts, *alert)
+	}
+
+	sortAlerts(alerts)
+	return alerts
+}
+
+// valueOf Значение метрики в виде числа для сравнения с порогом
+func valueOf(metric metricPkg.Metric) (float64, bool) {
+
+	switch metric.MType {
+	case metricPkg.GaugeType:
+		if metric.Value != nil {
+			return *metric.Value, true
+		}
+
+	case metricPkg.CounterType:
+		if metric.Delta != nil {
+			return float64(*metric.Delta), true
+		}
+	}
+
+	return 0, false
+}
+
+// alertLabels Метки алерта: метки метрики и служебные метки правила
+func alertLabels(rule Rule, metric metricPkg.Metric) map[string]string {
+
+	labels := make(map[string]string, len(metric.Labels)+3)
+	for name, value := range metric.Labels {
+		labels[name] = value
+	}
+
+	labels[LabelAlertName] = rule.Name
+	labels[LabelType] = metric.MType
+	labels[LabelID] = metric.ID
+
+	return labels
+}
+
+func alertKey(rule Rule, metric metricPkg.Metric) string {
+	return rule.Name + "/" + metric.MType + "/" + metric.SeriesKey()
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+
+		return alerts[i].Series < alerts[j].Series
+	})
+}
@@ -0,0 +1,267 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage/memstore"
+	metricPkg "metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		expr     string
+		wantRule Rule
+		wantErr  bool
+	}{
+		{
+			name: "Threshold with size suffix and duration -> OK",
+			expr: "gauge HeapAlloc > 500MB for 2m",
+			wantRule: Rule{
+				Name:      "gauge HeapAlloc > 500MB for 2m",
+				MType:     metricPkg.GaugeType,
+				ID:        "HeapAlloc",
+				Op:        OpGreater,
+				Threshold: 500 * (1 << 20),
+				For:       2 * time.Minute,
+				Expr:      "gauge HeapAlloc > 500MB for 2m",
+			},
+		},
+		{
+			name: "Named rule without duration -> OK",
+			expr: "LowMemory: gauge FreeMemory <= 1024",
+			wantRule: Rule{
+				Name:      "LowMemory",
+				MType:     metricPkg.GaugeType,
+				ID:        "FreeMemory",
+				Op:        OpLessOrEqual,
+				Threshold: 1024,
+				Expr:      "LowMemory: gauge FreeMemory <= 1024",
+			},
+		},
+		{
+			name: "Counter not increasing -> OK",
+			expr: "counter PollCount not increasing for 1m",
+			wantRule: Rule{
+				Name:  "counter PollCount not increasing for 1m",
+				MType: metricPkg.CounterType,
+				ID:    "PollCount",
+				Op:    OpNotIncreasing,
+				For:   time.Minute,
+				Expr:  "counter PollCount not increasing for 1m",
+			},
+		},
+		{
+			name:    "Unknown operator -> ERROR",
+			expr:    "gauge HeapAlloc ~ 10",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown type -> ERROR",
+			expr:    "summary HeapAlloc > 10",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid duration -> ERROR",
+			expr:    "gauge HeapAlloc > 10 for soon",
+			wantErr: true,
+		},
+		{
+			name:    "Missing threshold -> ERROR",
+			expr:    "gauge HeapAlloc >",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRule, rule)
+		})
+	}
+}
+
+func TestEngine_Threshold(t *testing.T) {
+
+	store := memstore.New()
+	rule, err := ParseRule("HighHeap: gauge HeapAlloc > 100 for 2m")
+	require.NoError(t, err)
+
+	engine := New(store, []Rule{rule}, nil)
+	start := time.Now()
+
+	upsertGauge(t, store, "HeapAlloc", 150)
+
+	changed, err := engine.Evaluate(start)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StatePending, changed[0].State)
+
+	// Условие выполняется меньше 2m - алерт остается в pending
+	changed, err = engine.Evaluate(start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	changed, err = engine.Evaluate(start.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.Equal(t, 150.0, changed[0].Value)
+
+	upsertGauge(t, store, "HeapAlloc", 50)
+
+	changed, err = engine.Evaluate(start.Add(3 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+	assert.Equal(t, start.Add(3*time.Minute), changed[0].ResolvedAt)
+
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+}
+
+func TestEngine_PendingReset(t *testing.T) {
+
+	store := memstore.New()
+	rule, err := ParseRule("gauge HeapAlloc > 100 for 2m")
+	require.NoError(t, err)
+
+	engine := New(store, []Rule{rule}, nil)
+	start := time.Now()
+
+	upsertGauge(t, store, "HeapAlloc", 150)
+	_, err = engine.Evaluate(start)
+	require.NoError(t, err)
+
+	// Условие перестало выполняться до истечения 2m - алерт пропадает без resolved
+	upsertGauge(t, store, "HeapAlloc", 10)
+	changed, err := engine.Evaluate(start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateInactive, changed[0].State)
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngine_NotIncreasing(t *testing.T) {
+
+	store := memstore.New()
+	rule, err := ParseRule("counter PollCount not increasing for 1m")
+	require.NoError(t, err)
+
+	engine := New(store, []Rule{rule}, nil)
+	start := time.Now()
+
+	upsertCounter(t, store, "PollCount", 10)
+	changed, err := engine.Evaluate(start)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	changed, err = engine.Evaluate(start.Add(30 * time.Second))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StatePending, changed[0].State)
+
+	changed, err = engine.Evaluate(start.Add(90 * time.Second))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+
+	upsertCounter(t, store, "PollCount", 20)
+	changed, err = engine.Evaluate(start.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+}
+
+func upsertGauge(t *testing.T, store *memstore.Storage, id string, value float64) {
+	m, err := metricPkg.CreateMetric(metricPkg.GaugeType, id, metricPkg.WithValueFloat(value))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(m))
+}
+
+func upsertCounter(t *testing.T, store *memstore.Storage, id string, delta int64) {
+	m, err := metricPkg.CreateMetric(metricPkg.CounterType, id, metricPkg.WithValueInt(delta))
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(m))
+}
+
+// testNotifier Запоминает алерты, переданные в Notify
+type testNotifier struct {
+	calls [][]Alert
+}
+
+func (tn *testNotifier) Notify(_ time.Time, alerts []Alert) {
+	tn.calls = append(tn.calls, alerts)
+}
+
+func TestEngine_Notifier(t *testing.T) {
+
+	store := memstore.New()
+	rule, err := ParseRule("HighHeap: gauge HeapAlloc > 100")
+	require.NoError(t, err)
+
+	tn := &testNotifier{}
+	engine := New(store, []Rule{rule}, nil, WithNotifier(tn))
+	start := time.Now()
+
+	upsertGauge(t, store, "HeapAlloc", 150)
+	_, err = engine.Evaluate(start)
+	require.NoError(t, err)
+
+	upsertGauge(t, store, "HeapAlloc", 50)
+	_, err = engine.Evaluate(start.Add(time.Minute))
+	require.NoError(t, err)
+
+	require.Len(t, tn.calls, 2)
+	require.Len(t, tn.calls[0], 1)
+	assert.Equal(t, StateFiring, tn.calls[0][0].State)
+	assert.Equal(t, "HighHeap", tn.calls[0][0].Labels[LabelAlertName])
+	require.Len(t, tn.calls[1], 1)
+	assert.Equal(t, StateResolved, tn.calls[1][0].State)
+}
+
+func TestEngine_ResolvedRetention(t *testing.T) {
+
+	store := memstore.New()
+	rule, err := ParseRule("HighHeap: gauge HeapAlloc > 100")
+	require.NoError(t, err)
+
+	tn := &testNotifier{}
+	engine := New(store, []Rule{rule}, nil, WithNotifier(tn), WithResolvedRetention(time.Minute))
+	start := time.Now()
+
+	upsertGauge(t, store, "HeapAlloc", 150)
+	upsertGauge(t, store, "Other", 1)
+	_, err = engine.Evaluate(start)
+	require.NoError(t, err)
+	require.Len(t, engine.Alerts(), 1)
+
+	// Серия пропала: алерт переходит в resolved, уведомление отправляется
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "HeapAlloc", metricPkg.WithValueFloat(0))
+	require.NoError(t, store.Delete(gauge))
+
+	changed, err := engine.Evaluate(start.Add(10 * time.Second))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+	require.Len(t, tn.calls[len(tn.calls)-1], 1)
+	assert.Len(t, engine.Alerts(), 1)
+
+	// По истечении срока хранения resolved алерт удаляется, предыдущие значения пропавших серий тоже
+	_, err = engine.Evaluate(start.Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, engine.Alerts())
+	assert.Empty(t, engine.previous)
+}
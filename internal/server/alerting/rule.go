@@ -0,0 +1,183 @@
+package alerting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics-and-alerting/pkg/errs"
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// Операторы сравнения, поддерживаемые правилами
+const (
+	OpGreater        = ">"
+	OpGreaterOrEqual = ">="
+	OpLess           = "<"
+	OpLessOrEqual    = "<="
+	OpEqual          = "=="
+	OpNotEqual       = "!="
+	OpNotIncreasing  = "not increasing"
+)
+
+// Rule Пороговое правило алертинга
+type Rule struct {
+	Name      string        `json:"name"`      // имя правила
+	MType     string        `json:"type"`      // тип метрики
+	ID        string        `json:"id"`        // имя метрики
+	Op        string        `json:"op"`        // оператор сравнения
+	Threshold float64       `json:"threshold"` // пороговое значение
+	For       time.Duration `json:"for"`       // длительность выполнения условия до перехода в firing
+	Expr      string        `json:"expr"`      // исходное выражение правила
+}
+
+// ParseRule Разбор правила из строки.
+// Поддерживаются форматы:
+//
+//	[<name>:] <type> <id> <op> <threshold>[KB|MB|GB|TB] [for <duration>]
+//	[<name>:] counter <id> not increasing [for <duration>]
+//
+// Например: "HighHeap: gauge HeapAlloc > 500MB for 2m", "counter PollCount not increasing for 1m"
+func ParseRule(expr string) (Rule, error) {
+
+	rule := Rule{
+		Expr: strings.TrimSpace(expr),
+	}
+
+	body := rule.Expr
+	if idx := strings.Index(body, ":"); idx >= 0 {
+		rule.Name = strings.TrimSpace(body[:idx])
+		body = strings.TrimSpace(body[idx+1:])
+	}
+
+	fields := strings.Fields(body)
+
+	// Отделяем длительность "for <duration>"
+	if n := len(fields); n >= 2 && strings.EqualFold(fields[n-2], "for") {
+		duration, err := time.ParseDuration(fields[n-1])
+		if err != nil {
+			return Rule{}, fmt.Errorf("%w: invalid duration %q", errs.ErrInvalidRule, fields[n-1])
+		}
+
+		rule.For = duration
+		fields = fields[:n-2]
+	}
+
+	if len(fields) != 4 {
+		return Rule{}, fmt.Errorf("%w: %q", errs.ErrInvalidRule, expr)
+	}
+
+	rule.MType, rule.ID = fields[0], fields[1]
+
+	switch rule.MType {
+	case metricPkg.GaugeType, metricPkg.CounterType:
+	default:
+		return Rule{}, fmt.Errorf("%w: %s", errs.ErrUnknownType, rule.MType)
+	}
+
+	if strings.EqualFold(fields[2], "not") && strings.EqualFold(fields[3], "increasing") {
+		rule.Op = OpNotIncreasing
+	} else {
+		switch fields[2] {
+		case OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual, OpEqual, OpNotEqual:
+			rule.Op = fields[2]
+		default:
+			return Rule{}, fmt.Errorf("%w: unknown operator %q", errs.ErrInvalidRule, fields[2])
+		}
+
+		threshold, err := parseThreshold(fields[3])
+		if err != nil {
+			return Rule{}, err
+		}
+
+		rule.Threshold = threshold
+	}
+
+	if len(rule.Name) == 0 {
+		rule.Name = body
+	}
+
+	return rule, nil
+}
+
+// ParseRules Разбор набора правил
+func ParseRules(exprs []string) ([]Rule, error) {
+
+	rules := make([]Rule, 0, len(exprs))
+
+	for _, expr := range exprs {
+		if len(strings.TrimSpace(expr)) == 0 {
+			continue
+		}
+
+		rule, err := ParseRule(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// parseThreshold Разбор порогового значения с необязательным суффиксом размера (KB, MB, GB, TB)
+func parseThreshold(data string) (float64, error) {
+
+	multipliers := []struct {
+		suffix string
+		value  float64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"TB", 1 << 40},
+	}
+
+	multiplier := 1.0
+	upper := strings.ToUpper(data)
+
+	for _, m := range multipliers {
+		if strings.HasSuffix(upper, m.suffix) {
+			multiplier = m.value
+			data = data[:len(data)-len(m.suffix)]
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(data, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid threshold %q", errs.ErrInvalidRule, data)
+	}
+
+	return value * multiplier, nil
+}
+
+// match Проверка условия правила
+// prev - значение метрики при предыдущей проверке, known - было ли предыдущее значение
+func (rule Rule) match(value, prev float64, known bool) bool {
+
+	switch rule.Op {
+	case OpGreater:
+		return value > rule.Threshold
+	case OpGreaterOrEqual:
+		return value >= rule.Threshold
+	case OpLess:
+		return value < rule.Threshold
+	case OpLessOrEqual:
+		return value <= rule.Threshold
+	case OpEqual:
+		return value == rule.Threshold
+	case OpNotEqual:
+		return value != rule.Threshold
+	case OpNotIncreasing:
+		return known && value <= prev
+	}
+
+	return false
+}
+
+func (rule Rule) String() string {
+	return rule.Expr
+}
@@ -14,6 +14,17 @@ import (
 	"github.com/caarlos0/env"
 )
 
+// Движки хранилища метрик, задаются через STORE_ENGINE или флаг -engine
+const (
+	EngineMemory   = "memory"
+	EngineFile     = "file"
+	EnginePostgres = "postgres"
+	EngineBolt     = "bolt"
+
+	// DefaultBoltFile Файл базы данных bolt по умолчанию
+	DefaultBoltFile = "metrics.db"
+)
+
 type Config struct {
 	Addr          string   `env:"ADDRESS"        json:"address"        `
 	AddrRPC       string   `env:"ADDRESS_RPC"    json:"address_rpc"    `
@@ -21,10 +32,27 @@ type Config struct {
 	Restore       bool     `env:"RESTORE"        json:"restore"        `
 	DatabaseDSN   string   `env:"DATABASE_DSN"   json:"database_dsn"   `
 	StoreFile     string   `env:"STORE_FILE"     json:"store_file"     `
+	StoreSync     bool     `env:"STORE_SYNC"     json:"store_sync"     `
+	StoreEngine   string   `env:"STORE_ENGINE"   json:"store_engine"   `
+	StoreBoltFile string   `env:"STORE_BOLT_FILE" json:"store_bolt_file"`
 	SecretKey     string   `env:"KEY"            json:"secret_key"     `
 	CryptoKey     string   `env:"CRYPTO_KEY"     json:"crypto_key"     `
 	TrustedSubnet string   `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
-	ConfigFile    string   `env:"CONFIG"`
+	TLSCert       string   `env:"TLS_CERT"       json:"tls_cert"       `
+	TLSKey        string   `env:"TLS_KEY"        json:"tls_key"        `
+	TLSClientCA   string   `env:"TLS_CLIENT_CA"  json:"tls_client_ca"  `
+	Retention     Duration `env:"RETENTION"      json:"retention"      `
+	AlertRules    []string `env:"ALERT_RULES"    json:"alert_rules"     envSeparator:";"`
+	AlertInterval Duration `env:"ALERT_INTERVAL" json:"alert_interval" `
+
+	AlertWebhooks       []string `env:"ALERT_WEBHOOKS"        json:"alert_webhooks"       `
+	AlertGroupBy        []string `env:"ALERT_GROUP_BY"        json:"alert_group_by"       `
+	AlertRepeatInterval Duration `env:"ALERT_REPEAT_INTERVAL" json:"alert_repeat_interval"`
+	AlertRetries        int      `env:"ALERT_RETRIES"         json:"alert_retries"        `
+	AlertRetryBackoff   Duration `env:"ALERT_RETRY_BACKOFF"   json:"alert_retry_backoff"  `
+
+	ConfigFile  string `env:"CONFIG"`
+	MigrateOnly bool   `env:"MIGRATE_ONLY"`
 }
 
 type Duration struct {
@@ -40,9 +68,16 @@ func DefaultConfig() *Config {
 		Restore:       true,
 		DatabaseDSN:   "",
 		StoreFile:     "",
+		StoreBoltFile: DefaultBoltFile,
 		SecretKey:     "",
 		CryptoKey:     "",
 		StoreInterval: Duration{Duration: 10 * time.Second},
+		Retention:     Duration{Duration: time.Hour},
+		AlertInterval: Duration{Duration: 10 * time.Second},
+
+		AlertRepeatInterval: Duration{Duration: 4 * time.Hour},
+		AlertRetries:        5,
+		AlertRetryBackoff:   Duration{Duration: time.Second},
 	}
 }
 
@@ -67,6 +102,13 @@ func (duration *Duration) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// UnmarshalText Разбор длительности из переменной окружения
+func (duration *Duration) UnmarshalText(text []byte) error {
+	var err error
+	duration.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
 func (cfg *Config) ReadConfig() error {
 
 	if len(cfg.ConfigFile) == 0 {
@@ -88,6 +130,9 @@ func (cfg *Config) ParseFlags() error {
 
 	flag.BoolVar(&cfg.Restore, "r", cfg.Restore, "bool - restore metrics")
 	flag.StringVar(&cfg.StoreFile, "f", cfg.StoreFile, "string - path to fileStorage storage")
+	flag.StringVar(&cfg.StoreEngine, "engine", cfg.StoreEngine, "string - storage engine: memory, file, postgres or bolt; by default chosen from -d and -f")
+	flag.StringVar(&cfg.StoreBoltFile, "bolt-file", cfg.StoreBoltFile, "string - path to bolt database file")
+	flag.BoolVar(&cfg.StoreSync, "sync", cfg.StoreSync, "bool - fsync file storage wal before acknowledging each update")
 	flag.DurationVar(&cfg.StoreInterval.Duration, "i", cfg.StoreInterval.Duration, "duration - interval store metrics")
 	flag.StringVar(&cfg.SecretKey, "k", cfg.SecretKey, "string - key sign")
 	flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "string - dbstore data source name")
@@ -95,6 +140,11 @@ func (cfg *Config) ParseFlags() error {
 	flag.StringVar(&cfg.ConfigFile, "c", cfg.ConfigFile, "string - path to config in JSON format")
 	flag.StringVar(&trustedSubnet, "t", trustedSubnet, "string - CIDR")
 	flag.StringVar(&cfg.AddrRPC, "rpc", cfg.AddrRPC, "string - address grpc gate")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "string - path to server TLS certificate (HTTP and gRPC)")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "string - path to server TLS private key")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "string - path to CA certificate for client certificate verification (mTLS)")
+	flag.BoolVar(&cfg.MigrateOnly, "migrate-only", cfg.MigrateOnly, "bool - apply database migrations and exit")
+	flag.DurationVar(&cfg.Retention.Duration, "retention", cfg.Retention.Duration, "duration - metrics history retention, 0 - unlimited")
 
 	addr := flag.String("a", "", "string - host:port")
 	flag.Parse()
@@ -164,8 +214,22 @@ func (cfg Config) String() string {
 	builder.WriteString(fmt.Sprintf("\t RESTORE: %v\n", cfg.Restore))
 	builder.WriteString(fmt.Sprintf("\t DATABASE_DSN: %s\n", cfg.DatabaseDSN))
 	builder.WriteString(fmt.Sprintf("\t STORE_FILE: %s\n", cfg.StoreFile))
+	builder.WriteString(fmt.Sprintf("\t STORE_SYNC: %v\n", cfg.StoreSync))
+	builder.WriteString(fmt.Sprintf("\t STORE_ENGINE: %s\n", cfg.StoreEngine))
+	builder.WriteString(fmt.Sprintf("\t STORE_BOLT_FILE: %s\n", cfg.StoreBoltFile))
 	builder.WriteString(fmt.Sprintf("\t KEY: %s\n", cfg.SecretKey))
 	builder.WriteString(fmt.Sprintf("\t TRUSTED_SUBNET: %s\n", cfg.TrustedSubnet))
+	builder.WriteString(fmt.Sprintf("\t TLS_CERT: %s\n", cfg.TLSCert))
+	builder.WriteString(fmt.Sprintf("\t TLS_KEY: %s\n", cfg.TLSKey))
+	builder.WriteString(fmt.Sprintf("\t TLS_CLIENT_CA: %s\n", cfg.TLSClientCA))
+	builder.WriteString(fmt.Sprintf("\t RETENTION: %s\n", cfg.Retention.String()))
+	builder.WriteString(fmt.Sprintf("\t ALERT_RULES: %s\n", strings.Join(cfg.AlertRules, "; ")))
+	builder.WriteString(fmt.Sprintf("\t ALERT_INTERVAL: %s\n", cfg.AlertInterval.String()))
+	builder.WriteString(fmt.Sprintf("\t ALERT_WEBHOOKS: %s\n", strings.Join(cfg.AlertWebhooks, ", ")))
+	builder.WriteString(fmt.Sprintf("\t ALERT_GROUP_BY: %s\n", strings.Join(cfg.AlertGroupBy, ", ")))
+	builder.WriteString(fmt.Sprintf("\t ALERT_REPEAT_INTERVAL: %s\n", cfg.AlertRepeatInterval.String()))
+	builder.WriteString(fmt.Sprintf("\t ALERT_RETRIES: %d\n", cfg.AlertRetries))
+	builder.WriteString(fmt.Sprintf("\t ALERT_RETRY_BACKOFF: %s\n", cfg.AlertRetryBackoff.String()))
 
 	if len(cfg.CryptoKey) != 0 {
 		builder.WriteString("\t CRYPTO_KEY: USE\n")
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"sync"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// subscription Подписка на изменения метрик.
+// Канал закрывается при отписке или если подписчик не успевает читать события.
+type subscription struct {
+	ch     chan metricPkg.Metric
+	closed bool
+}
+
+// broker Рассылка изменений метрик подписчикам
+type broker struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: make(map[*subscription]struct{})}
+}
+
+// subscribe Подписка на изменения с буфером buffer событий.
+// Возвращает канал событий и функцию отписки.
+func (b *broker) subscribe(buffer int) (<-chan metricPkg.Metric, func()) {
+
+	sub := &subscription{ch: make(chan metricPkg.Metric, buffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.remove(sub)
+	}
+}
+
+// publish Отправка события всем подписчикам без ожидания.
+// Подписчик с заполненным буфером отключается, чтобы не задерживать запись метрик.
+func (b *broker) publish(metric metricPkg.Metric) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- metric:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// remove Удаление подписчика, вызывается под блокировкой
+func (b *broker) remove(sub *subscription) {
+
+	if sub.closed {
+		return
+	}
+
+	sub.closed = true
+	delete(b.subs, sub)
+	close(sub.ch)
+}
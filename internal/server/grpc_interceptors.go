@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"metrics-and-alerting/pkg/errs"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataRealIP Ключ метаданных с IP адресом клиента, аналог заголовка X-Real-IP
+const MetadataRealIP = "x-real-ip"
+
+// trustedNets Список адресов и подсетей, от которых принимаются запросы
+type trustedNets []*net.IPNet
+
+// parseTrustedSubnet Разбор списка IP адресов и подсетей в формате CIDR, разделенных запятой
+func parseTrustedSubnet(subnet string) (trustedNets, error) {
+
+	var nets trustedNets
+
+	for _, item := range strings.Split(subnet, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted address: %s", item)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet: %w", err)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// allow Проверка IP адреса клиента. Пустой список разрешает запросы от любого адреса.
+func (nets trustedNets) allow(ctx context.Context) error {
+
+	if len(nets) == 0 {
+		return nil
+	}
+
+	ip := clientIP(ctx, nets)
+	if ip == nil {
+		return status.Error(codes.PermissionDenied, "client address is unknown")
+	}
+
+	if !nets.contains(ip) {
+		return status.Errorf(codes.PermissionDenied, "client address %s is not trusted", ip)
+	}
+
+	return nil
+}
+
+func (nets trustedNets) contains(ip net.IP) bool {
+
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP IP адрес клиента. Метаданные x-real-ip учитываются, только если соединение установлено
+// с доверенного адреса (прокси), иначе клиент мог бы указать в них любой доверенный адрес.
+func clientIP(ctx context.Context, nets trustedNets) net.IP {
+
+	ip := peerIP(ctx)
+	if ip == nil || !nets.contains(ip) {
+		return ip
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataRealIP); len(values) > 0 {
+			return net.ParseIP(strings.TrimSpace(values[0]))
+		}
+	}
+
+	return ip
+}
+
+// peerIP IP адрес соединения
+func peerIP(ctx context.Context) net.IP {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// statusError Преобразование ошибки хранилища в ошибку gRPC с соответствующим кодом.
+// Ошибки, уже имеющие код gRPC, не изменяются.
+func statusError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(errs.ErrorGRPC(err), err.Error())
+}
+
+// unaryInterceptor Проверка адреса клиента и преобразование ошибок для унарных вызовов
+func (nets trustedNets) unaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	if err := nets.allow(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := handler(ctx, req)
+	return resp, statusError(err)
+}
+
+// streamInterceptor Проверка адреса клиента и преобразование ошибок для потоковых вызовов
+func (nets trustedNets) streamInterceptor(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	if err := nets.allow(ss.Context()); err != nil {
+		return err
+	}
+
+	return statusError(handler(srv, ss))
+}
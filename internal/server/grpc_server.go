@@ -2,37 +2,112 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
+	"strings"
 
+	"metrics-and-alerting/pkg/errs"
 	metricPkg "metrics-and-alerting/pkg/metric"
 	pb "metrics-and-alerting/proto"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-type GRPCServer struct {
-	*grpc.Server
-	net.Listener
-}
+const (
+	// streamBatchSize Число метрик из StreamMetrics, сохраняемых одним вызовом UpsertBatch
+	streamBatchSize = 100
+
+	// defaultPageSize, maxPageSize Размер страницы ListMetrics по умолчанию и наибольший размер
+	defaultPageSize = 100
+	maxPageSize     = 1000
+
+	// watchBuffer Число изменений, которые может накопить подписчик WatchMetrics
+	watchBuffer = 256
+)
+
+type (
+	OptionsGRPCServer func(*GRPCServer)
+
+	GRPCServer struct {
+		*grpc.Server
+		net.Listener
+		trustedSubnet string
+		tlsConfig     *tls.Config
+	}
+)
 
 type MetricsServiceRPC struct {
 	pb.UnimplementedMetricsServer
 	m *MetricsManager
 }
 
-func NewGRPCServer(addr string, m *MetricsManager) (*GRPCServer, error) {
+func NewGRPCServer(addr string, m *MetricsManager, opts ...OptionsGRPCServer) (*GRPCServer, error) {
 	listen, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
+	g, err := newGRPCServer(listen, m, opts...)
+	if err != nil {
+		_ = listen.Close()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// WithTrustedSubnet Список IP адресов и подсетей (CIDR) через запятую, от которых принимаются запросы.
+// Адрес клиента берется из адреса соединения, а если соединение установлено с доверенного адреса (прокси) -
+// из метаданных x-real-ip при их наличии.
+func WithTrustedSubnet(subnet string) OptionsGRPCServer {
+	return func(g *GRPCServer) {
+		g.trustedSubnet = subnet
+	}
+}
+
+// WithGRPCTLS Прием соединений TLS с настройками cfg. При cfg = nil соединения не шифруются.
+func WithGRPCTLS(cfg *tls.Config) OptionsGRPCServer {
+	return func(g *GRPCServer) {
+		g.tlsConfig = cfg
+	}
+}
+
+// newGRPCServer Создание сервера, принимающего соединения listen
+func newGRPCServer(listen net.Listener, m *MetricsManager, opts ...OptionsGRPCServer) (*GRPCServer, error) {
+
 	g := GRPCServer{
-		Server:   grpc.NewServer(),
 		Listener: listen,
 	}
 
+	for _, opt := range opts {
+		opt(&g)
+	}
+
+	trusted, err := parseTrustedSubnet(g.trustedSubnet)
+	if err != nil {
+		return nil, err
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(trusted.unaryInterceptor),
+		grpc.StreamInterceptor(trusted.streamInterceptor),
+	}
+
+	if g.tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(g.tlsConfig)))
+	}
+
+	g.Server = grpc.NewServer(serverOpts...)
+
 	service := &MetricsServiceRPC{
 		m: m,
 	}
@@ -57,12 +132,14 @@ func (serv *MetricsServiceRPC) UpsertGauge(ctx context.Context, in *pb.UpsertGau
 		metricPkg.GaugeType,
 		in.Id,
 		metricPkg.WithValueFloat(in.Value),
+		metricPkg.WithLabels(in.Labels),
 	)
 
 	if err != nil {
 		return res, err
 	}
 
+	metric.Hash = in.Hash
 	return res, serv.m.Upsert(metric)
 }
 
@@ -74,11 +151,225 @@ func (serv *MetricsServiceRPC) UpsertCounter(ctx context.Context, in *pb.UpsertC
 		metricPkg.CounterType,
 		in.Id,
 		metricPkg.WithValueInt(in.Delta),
+		metricPkg.WithLabels(in.Labels),
 	)
 
 	if err != nil {
 		return res, err
 	}
 
+	metric.Hash = in.Hash
 	return res, serv.m.Upsert(metric)
 }
+
+// UpsertBatch Сохранение набора метрик любых типов одним вызовом
+func (serv *MetricsServiceRPC) UpsertBatch(ctx context.Context, in *pb.UpsertBatchRequest) (*emptypb.Empty, error) {
+
+	res := &emptypb.Empty{}
+
+	metrics := make([]metricPkg.Metric, 0, len(in.Metrics))
+	for _, m := range in.Metrics {
+		metric, err := pb.ToMetric(m)
+		if err != nil {
+			return res, err
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return res, serv.m.UpsertBatch(metrics)
+}
+
+// StreamMetrics Прием потока метрик от клиента.
+// Метрики сохраняются частями по streamBatchSize, ответ с числом принятых метрик отправляется после закрытия потока клиентом.
+func (serv *MetricsServiceRPC) StreamMetrics(stream pb.Metrics_StreamMetricsServer) error {
+
+	var received int64
+	batch := make([]metricPkg.Metric, 0, streamBatchSize)
+
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		metric, err := pb.ToMetric(in)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, metric)
+		received++
+
+		if len(batch) == streamBatchSize {
+			if err = serv.m.UpsertBatch(batch); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := serv.m.UpsertBatch(batch); err != nil {
+			return err
+		}
+	}
+
+	return stream.SendAndClose(&pb.StreamMetricsResponse{Received: received})
+}
+
+// GetMetric Получение значения метрики по типу, имени и меткам
+func (serv *MetricsServiceRPC) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.Metric, error) {
+
+	m, err := serv.m.Get(metricPkg.Metric{ID: in.Id, MType: in.Type, Labels: in.Labels})
+	if err != nil {
+		return nil, err
+	}
+
+	return pb.FromMetric(m), nil
+}
+
+// ListMetrics Получение метрик, подходящих под фильтр, страницами, упорядоченными по ключу серии.
+// Токен следующей страницы пуст на последней странице.
+func (serv *MetricsServiceRPC) ListMetrics(ctx context.Context, in *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+
+	pageSize := int(in.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, fmt.Errorf("invalid page size %d: %w", pageSize, errs.ErrInvalidQuery)
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	after, err := decodePageToken(in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := serv.m.GetBatch()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := newMetricFilter(in.Filter)
+
+	matched := make([]metricPkg.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if filter.match(m) && listKey(m) > after {
+			matched = append(matched, m)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return listKey(matched[i]) < listKey(matched[j])
+	})
+
+	res := &pb.ListMetricsResponse{}
+
+	if len(matched) > pageSize {
+		matched = matched[:pageSize]
+		res.NextPageToken = encodePageToken(listKey(matched[pageSize-1]))
+	}
+
+	res.Metrics = make([]*pb.Metric, 0, len(matched))
+	for _, m := range matched {
+		res.Metrics = append(res.Metrics, pb.FromMetric(m))
+	}
+
+	return res, nil
+}
+
+// WatchMetrics Отправка клиенту изменений метрик, подходящих под фильтр, до отмены запроса.
+// Если клиент не успевает принимать изменения, поток завершается с кодом ResourceExhausted.
+func (serv *MetricsServiceRPC) WatchMetrics(in *pb.WatchMetricsRequest, stream pb.Metrics_WatchMetricsServer) error {
+
+	filter := newMetricFilter(in.Filter)
+
+	events, unsubscribe := serv.m.Subscribe(watchBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case m, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher is too slow, changes were dropped")
+			}
+
+			if !filter.match(m) {
+				continue
+			}
+
+			if err := stream.Send(pb.FromMetric(m)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// metricFilter Отбор метрик по типу, началу имени и меткам
+type metricFilter struct {
+	mtype      string
+	namePrefix string
+	labels     map[string]string
+}
+
+func newMetricFilter(in *pb.MetricFilter) metricFilter {
+
+	if in == nil {
+		return metricFilter{}
+	}
+
+	return metricFilter{
+		mtype:      in.Type,
+		namePrefix: in.NamePrefix,
+		labels:     in.Labels,
+	}
+}
+
+func (f metricFilter) match(m metricPkg.Metric) bool {
+
+	if len(f.mtype) > 0 && m.MType != f.mtype {
+		return false
+	}
+
+	if !strings.HasPrefix(m.ID, f.namePrefix) {
+		return false
+	}
+
+	for name, value := range f.labels {
+		if known, ok := m.Labels[name]; !ok || known != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listKey Ключ серии, задающий порядок ListMetrics
+func listKey(m metricPkg.Metric) string {
+	return m.MType + ":" + m.SeriesKey()
+}
+
+func encodePageToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodePageToken(token string) (string, error) {
+
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("invalid page token: %w", errs.ErrInvalidQuery)
+	}
+
+	return string(key), nil
+}
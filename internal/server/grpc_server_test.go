@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage/memstore"
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+	pb "metrics-and-alerting/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// peerListener Соединения bufconn с заданным адресом клиента
+type peerListener struct {
+	*bufconn.Listener
+	remote net.Addr
+}
+
+type peerConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return peerConn{Conn: conn, remote: l.remote}, nil
+}
+
+func (c peerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// startGRPC Запуск сервера gRPC в памяти процесса
+func startGRPC(t *testing.T, manager *MetricsManager, opts ...OptionsGRPCServer) pb.MetricsClient {
+	return startGRPCFrom(t, manager, nil, opts...)
+}
+
+// startGRPCFrom Запуск сервера gRPC в памяти процесса, соединения которого приходят с адреса remote.
+// При remote = nil адрес соединения bufconn не является IP адресом.
+func startGRPCFrom(t *testing.T, manager *MetricsManager, remote net.Addr, opts ...OptionsGRPCServer) pb.MetricsClient {
+
+	listen := bufconn.Listen(1 << 20)
+
+	var listener net.Listener = listen
+	if remote != nil {
+		listener = peerListener{Listener: listen, remote: remote}
+	}
+
+	gServer, err := newGRPCServer(listener, manager, opts...)
+	require.NoError(t, err)
+	gServer.Start()
+	t.Cleanup(gServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listen.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return pb.NewMetricsClient(conn)
+}
+
+func TestMetricsServiceRPC_UpsertBatch(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+	client := startGRPC(t, manager)
+
+	h, err := metricPkg.NewHistogram([]float64{1})
+	require.NoError(t, err)
+	h.Observe(0.5)
+
+	histogram, err := metricPkg.CreateMetric(metricPkg.HistogramType, "Latency", metricPkg.WithHistogram(*h))
+	require.NoError(t, err)
+
+	req := &pb.UpsertBatchRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: metricPkg.GaugeType, Value: 1.5, Labels: map[string]string{"host": "web-1"}},
+		{Id: "PollCount", Type: metricPkg.CounterType, Delta: 2},
+		{Id: "PollCount", Type: metricPkg.CounterType, Delta: 3},
+		pb.FromMetric(histogram),
+	}}
+
+	_, err = client.UpsertBatch(context.Background(), req)
+	require.NoError(t, err)
+
+	got, err := manager.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType, Labels: map[string]string{"host": "web-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = manager.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *got.Delta)
+
+	got, err = manager.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), got.Histogram.Count)
+
+	_, err = client.UpsertBatch(context.Background(), &pb.UpsertBatchRequest{Metrics: []*pb.Metric{
+		{Id: "Unknown", Type: "summary"},
+	}})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestMetricsServiceRPC_StreamMetrics(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+	client := startGRPC(t, manager)
+
+	stream, err := client.StreamMetrics(context.Background())
+	require.NoError(t, err)
+
+	// Больше streamBatchSize, чтобы метрики сохранялись несколькими частями
+	const count = streamBatchSize*2 + 10
+
+	for i := 0; i < count; i++ {
+		require.NoError(t, stream.Send(&pb.Metric{Id: "gauge_" + strconv.Itoa(i), Type: metricPkg.GaugeType, Value: float64(i)}))
+		require.NoError(t, stream.Send(&pb.Metric{Id: "PollCount", Type: metricPkg.CounterType, Delta: 1}))
+	}
+
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(count*2), res.Received)
+
+	metrics, err := manager.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, count+1)
+
+	got, err := manager.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(count), *got.Delta)
+}
+
+func TestMetricsServiceRPC_GetMetric(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+	client := startGRPC(t, manager)
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(1.5),
+		metricPkg.WithLabels(map[string]string{"host": "web-1"}))
+	require.NoError(t, manager.Upsert(gauge))
+
+	got, err := client.GetMetric(context.Background(), &pb.GetMetricRequest{
+		Id: "Alloc", Type: metricPkg.GaugeType, Labels: map[string]string{"host": "web-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, got.Value)
+	assert.Equal(t, "web-1", got.Labels["host"])
+
+	_, err = client.GetMetric(context.Background(), &pb.GetMetricRequest{Id: "Alloc", Type: metricPkg.GaugeType})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestMetricsServiceRPC_ListMetrics(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+	client := startGRPC(t, manager)
+
+	for i := 0; i < 25; i++ {
+		host := map[string]string{"host": "web-" + strconv.Itoa(i%2)}
+		gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "gauge_"+strconv.Itoa(i), metricPkg.WithValueFloat(float64(i)), metricPkg.WithLabels(host))
+		counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "counter_"+strconv.Itoa(i), metricPkg.WithValueInt(int64(i)))
+		require.NoError(t, manager.UpsertBatch([]metricPkg.Metric{gauge, counter}))
+	}
+
+	tests := []struct {
+		name   string
+		filter *pb.MetricFilter
+		want   int
+	}{
+		{name: "all", filter: nil, want: 50},
+		{name: "type", filter: &pb.MetricFilter{Type: metricPkg.CounterType}, want: 25},
+		{name: "name prefix", filter: &pb.MetricFilter{NamePrefix: "gauge_1"}, want: 11},
+		{name: "labels", filter: &pb.MetricFilter{Labels: map[string]string{"host": "web-0"}}, want: 13},
+		{name: "no match", filter: &pb.MetricFilter{Type: metricPkg.HistogramType}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			seen := make(map[string]bool)
+			token := ""
+
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 20)
+
+				res, err := client.ListMetrics(context.Background(), &pb.ListMetricsRequest{Filter: tt.filter, PageSize: 10, PageToken: token})
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(res.Metrics), 10)
+
+				for _, m := range res.Metrics {
+					key := m.Type + ":" + m.Id + m.Labels["host"]
+					assert.False(t, seen[key], key)
+					seen[key] = true
+				}
+
+				if token = res.NextPageToken; len(token) == 0 {
+					break
+				}
+			}
+
+			assert.Len(t, seen, tt.want)
+		})
+	}
+
+	_, err := client.ListMetrics(context.Background(), &pb.ListMetricsRequest{PageToken: "!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServiceRPC_WatchMetrics(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+	client := startGRPC(t, manager)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Filter: &pb.MetricFilter{Type: metricPkg.CounterType}})
+	require.NoError(t, err)
+
+	// Подписка создается сервером после начала потока
+	require.Eventually(t, func() bool {
+		manager.events.mu.Lock()
+		defer manager.events.mu.Unlock()
+
+		return len(manager.events.subs) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(1))
+	counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(2))
+
+	require.NoError(t, manager.Upsert(gauge))
+	require.NoError(t, manager.Upsert(counter))
+	require.NoError(t, manager.UpsertBatch([]metricPkg.Metric{gauge, counter}))
+
+	_, err = manager.Add(counter)
+	require.NoError(t, err)
+
+	// Отправляются накопленные значения счетчика
+	for _, want := range []int64{2, 4, 6} {
+		m, errRecv := stream.Recv()
+		require.NoError(t, errRecv)
+		assert.Equal(t, "PollCount", m.Id)
+		assert.Equal(t, want, m.Delta)
+	}
+
+	cancel()
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+// TestMetricsServiceRPC_Sign Подпись метрики передается в менеджер и проверяется ключом сервера
+func TestMetricsServiceRPC_Sign(t *testing.T) {
+
+	key := []byte("secret")
+	manager := New(memstore.New(), logpack.NewLogger(), WithSignKey(key))
+	client := startGRPC(t, manager)
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(1.5))
+	gaugeHash, err := gauge.Sign(key)
+	require.NoError(t, err)
+
+	counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(3))
+	counterHash, err := counter.Sign(key)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = client.UpsertGauge(ctx, &pb.UpsertGaugeRequest{Id: "Alloc", Value: 1.5, Hash: gaugeHash})
+	assert.NoError(t, err)
+
+	_, err = client.UpsertCounter(ctx, &pb.UpsertCounterRequest{Id: "PollCount", Delta: 3, Hash: counterHash})
+	assert.NoError(t, err)
+
+	_, err = client.UpsertGauge(ctx, &pb.UpsertGaugeRequest{Id: "Alloc", Value: 2, Hash: gaugeHash})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.UpsertCounter(ctx, &pb.UpsertCounterRequest{Id: "PollCount", Delta: 3})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.UpsertBatch(ctx, &pb.UpsertBatchRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: metricPkg.GaugeType, Value: 2, Hash: gaugeHash},
+	}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	got, err := manager.Get(gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+}
+
+func TestMetricsServiceRPC_TrustedSubnet(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	tests := []struct {
+		name string
+		peer string
+		ip   string
+		want codes.Code
+	}{
+		{name: "trusted peer", peer: "10.1.2.3:5000", want: codes.OK},
+		{name: "trusted address", peer: "192.168.1.10:5000", want: codes.OK},
+		{name: "untrusted peer", peer: "192.168.1.11:5000", want: codes.PermissionDenied},
+		{name: "proxy forwards trusted client", peer: "10.0.0.1:5000", ip: "192.168.1.10", want: codes.OK},
+		{name: "proxy forwards untrusted client", peer: "10.0.0.1:5000", ip: "192.168.1.11", want: codes.PermissionDenied},
+		// Недоверенный клиент не может подменить свой адрес метаданными
+		{name: "spoofed metadata", peer: "203.0.113.5:5000", ip: "10.1.2.3", want: codes.PermissionDenied},
+		// Адрес соединения bufconn не является IP адресом
+		{name: "unknown peer", ip: "10.1.2.3", want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var remote net.Addr
+			if len(tt.peer) > 0 {
+				addr, err := net.ResolveTCPAddr("tcp", tt.peer)
+				require.NoError(t, err)
+				remote = addr
+			}
+
+			client := startGRPCFrom(t, manager, remote, WithTrustedSubnet("10.0.0.0/8, 192.168.1.10"))
+
+			ctx := context.Background()
+			if len(tt.ip) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, MetadataRealIP, tt.ip)
+			}
+
+			_, err := client.UpsertGauge(ctx, &pb.UpsertGaugeRequest{Id: "Alloc", Value: 1})
+			assert.Equal(t, tt.want, status.Code(err))
+
+			stream, err := client.StreamMetrics(ctx)
+			require.NoError(t, err)
+
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
+
+func TestTrustedNets_PeerAddress(t *testing.T) {
+
+	nets, err := parseTrustedSubnet("127.0.0.1,::1")
+	require.NoError(t, err)
+
+	for addr, allowed := range map[string]bool{
+		"127.0.0.1:5000": true,
+		"[::1]:5000":     true,
+		"127.0.0.2:5000": false,
+	} {
+		tcpAddr, errAddr := net.ResolveTCPAddr("tcp", addr)
+		require.NoError(t, errAddr)
+
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+		assert.Equal(t, allowed, nets.allow(ctx) == nil, addr)
+	}
+
+	_, err = parseTrustedSubnet("10.0.0.0/33")
+	assert.Error(t, err)
+
+	_, err = parseTrustedSubnet("localhost")
+	assert.Error(t, err)
+}
@@ -2,19 +2,24 @@ package handler
 
 import (
 	"compress/gzip"
-	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
 
 	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/envelope"
 	"metrics-and-alerting/pkg/logpack"
 )
 
+// errUnsupportedEncryption Схема шифрования тела запроса не поддерживается
+var errUnsupportedEncryption = errors.New("unsupported encryption scheme")
+
 const (
 	idxType  = 0
 	idxName  = 1
@@ -29,6 +34,7 @@ const (
 	ContentType     = "Content-Type"
 	ContentEncoding = "Content-Encoding"
 	AcceptEncoding  = "Accept-Encoding"
+	Accept          = "Accept"
 
 	TextPlain       = "text/plain"
 	TextHTML        = "text/html"
@@ -85,6 +91,7 @@ func WithKey(key string) OptionsHandler {
 		}
 
 		h.privateKey = privateKey
+		h.logger.Info.Printf("crypto key id: %s\n", envelope.KeyIDString(&privateKey.PublicKey))
 	}
 }
 
@@ -146,7 +153,10 @@ func (h Handler) DecompressRequest(next http.Handler) http.Handler {
 	})
 }
 
-func (h Handler) Decrypt(r io.ReadCloser) ([]byte, error) {
+// Decrypt Чтение и расшифровка тела запроса закрытым ключом сервера.
+// scheme - значение заголовка X-Encryption: envelope - конверт AES-GCM + RSA-OAEP,
+// пустое значение или legacy - прежнее шифрование блоками RSA-OAEP.
+func (h Handler) Decrypt(r io.ReadCloser, scheme string) ([]byte, error) {
 
 	data, errRead := io.ReadAll(r)
 	defer func() {
@@ -155,29 +165,48 @@ func (h Handler) Decrypt(r io.ReadCloser) ([]byte, error) {
 		}
 	}()
 
-	if h.privateKey == nil {
+	if h.privateKey == nil || errRead != nil {
 		return data, errRead
 	}
 
-	dataLen := len(data)
-	step := h.privateKey.PublicKey.Size()
-	var decryptedBytes []byte
+	switch scheme {
+	case envelope.SchemeEnvelope:
+		return envelope.Open(h.privateKey, data)
 
-	for start := 0; start < dataLen; start += step {
-		finish := start + step
-		if finish > dataLen {
-			finish = dataLen
-		}
+	case "", envelope.SchemeLegacy:
+		return envelope.OpenLegacy(h.privateKey, data)
 
-		decryptedBlockBytes, err := h.privateKey.Decrypt(nil, data[start:finish], &rsa.OAEPOptions{Hash: crypto.SHA256})
-		if err != nil {
-			return nil, err
-		}
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncryption, scheme)
+	}
+}
+
+// decryptStatus Код ответа при ошибке расшифровки тела запроса
+func decryptStatus(err error) int {
+
+	if errors.Is(err, errUnsupportedEncryption) || errors.Is(err, envelope.ErrUnsupportedVersion) {
+		return http.StatusUnsupportedMediaType
+	}
+
+	return http.StatusBadRequest
+}
+
+// LabelsFromQuery Метки метрики из параметров запроса
+func LabelsFromQuery(r *http.Request) map[string]string {
 
-		decryptedBytes = append(decryptedBytes, decryptedBlockBytes...)
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(query))
+	for name, values := range query {
+		if len(values) > 0 {
+			labels[name] = values[len(values)-1]
+		}
 	}
 
-	return decryptedBytes, nil
+	return labels
 }
 
 func BodyReader(r *http.Request) (io.ReadCloser, error) {
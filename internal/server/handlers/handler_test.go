@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/internal/storage/memstore"
 	"metrics-and-alerting/pkg/logpack"
 	metricPkg "metrics-and-alerting/pkg/metric"
@@ -559,3 +560,188 @@ func TestUpdateMetricURL(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryRange(t *testing.T) {
+
+	logger := logpack.NewLogger()
+
+	base := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(3),
+		metricPkg.WithLabels(map[string]string{"host": "web-1"}))
+
+	st := memstore.New()
+	require.NoError(t, st.Upsert(gauge))
+
+	st.RestoreHistory([]storage.Series{{
+		Metric: gauge,
+		Points: []storage.Point{
+			{Timestamp: base.Add(5 * time.Second), Value: 1},
+			{Timestamp: base.Add(15 * time.Second), Value: 5},
+			{Timestamp: base.Add(75 * time.Second), Value: 3},
+		},
+	}})
+
+	handler := New(st, logger).QueryRange()
+
+	tests := []struct {
+		name       string
+		query      string
+		wantCode   int
+		wantPoints []storage.Point
+	}{
+		{
+			name:     "TestQueryRange - Max by minute => [OK]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=1m&agg=max",
+			wantCode: http.StatusOK,
+			wantPoints: []storage.Point{
+				{Timestamp: base, Value: 5},
+				{Timestamp: base.Add(time.Minute), Value: 3},
+			},
+		},
+		{
+			name:     "TestQueryRange - Unix time, step in seconds, last by default => [OK]",
+			query:    fmt.Sprintf("name=Alloc&type=gauge&host=web-1&start=%d&end=%d&step=120", base.Unix(), base.Unix()+120),
+			wantCode: http.StatusOK,
+			wantPoints: []storage.Point{
+				{Timestamp: base, Value: 3},
+			},
+		},
+		{
+			name:     "TestQueryRange - Unknown series => [Error]",
+			query:    "name=Alloc&type=gauge&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=1m",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "TestQueryRange - Without step => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - NaN step => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=NaN",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Infinite step => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=Inf",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Zero step => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=0",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Negative step => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=-1m",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - NaN start => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=NaN&end=2022-10-01T12:02:00Z&step=1m",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Infinite end => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=%2BInf&step=1m",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Negative start => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=-1&end=2022-10-01T12:02:00Z&step=1m",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "TestQueryRange - Unknown aggregation => [Error]",
+			query:    "name=Alloc&type=gauge&host=web-1&start=2022-10-01T12:00:00Z&end=2022-10-01T12:02:00Z&step=1m&agg=p99",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+tt.query, nil)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			response := recorder.Result()
+			defer response.Body.Close()
+
+			require.Equal(t, tt.wantCode, response.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var result RangeResponse
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+
+			assert.Equal(t, "Alloc", result.ID)
+			assert.Equal(t, map[string]string{"host": "web-1"}, result.Labels)
+			require.Len(t, result.Points, len(tt.wantPoints))
+
+			for i, p := range tt.wantPoints {
+				assert.True(t, p.Timestamp.Equal(result.Points[i].Timestamp))
+				assert.Equal(t, p.Value, result.Points[i].Value)
+			}
+		})
+	}
+}
+
+func TestGetPrometheus(t *testing.T) {
+
+	logger := logpack.NewLogger()
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(2.5),
+		metricPkg.WithLabels(map[string]string{"host": "web-1"}))
+	counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(3))
+
+	st := memstore.New()
+	require.NoError(t, st.UpsertBatch([]metricPkg.Metric{gauge, counter}))
+
+	handler := New(st, logger).GetPrometheus()
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "TestGetPrometheus - Text format => [OK]",
+			wantContentType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody:        "# TYPE Alloc gauge\nAlloc{host=\"web-1\"} 2.5\n# TYPE PollCount counter\nPollCount 3\n",
+		},
+		{
+			name:            "TestGetPrometheus - OpenMetrics format => [OK]",
+			accept:          "application/openmetrics-text; version=1.0.0",
+			wantContentType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			wantBody:        "# TYPE Alloc gauge\nAlloc{host=\"web-1\"} 2.5\n# TYPE PollCount counter\nPollCount_total 3\n# EOF\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if len(tt.accept) > 0 {
+				request.Header.Set(Accept, tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			response := recorder.Result()
+			defer response.Body.Close()
+
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, tt.wantContentType, response.Header.Get(ContentType))
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
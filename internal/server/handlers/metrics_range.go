@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/errs"
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// maxUnixSeconds Наибольшее время в секундах Unix, представимое в наносекундах int64
+const maxUnixSeconds = math.MaxInt64 / float64(time.Second)
+
+// Параметры запроса истории метрики
+const (
+	paramName  = "name"
+	paramType  = "type"
+	paramStart = "start"
+	paramEnd   = "end"
+	paramStep  = "step"
+	paramAgg   = "agg"
+)
+
+// RangeResponse Ответ на запрос истории метрики
+type RangeResponse struct {
+	ID          string            `json:"id"`               // имя метрики
+	MType       string            `json:"type"`             // тип метрики
+	Labels      map[string]string `json:"labels,omitempty"` // метки серии
+	Step        string            `json:"step"`             // шаг выравнивания
+	Aggregation string            `json:"aggregation"`      // функция агрегации внутри шага
+	Points      []storage.Point   `json:"points"`           // выровненные значения
+}
+
+// QueryRange Получение истории метрики в интервале времени с выравниванием по шагу.
+// GET /api/v1/query_range?name=<имя>&type=<тип>&start=<начало>&end=<конец>&step=<шаг>[&agg=<last|avg|min|max|sum>][&<метка>=<значение>]
+// Время задается в формате RFC3339 или в секундах Unix, шаг - длительностью (10s, 1m) или в секундах.
+func (h Handler) QueryRange() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set(ContentType, ApplicationJSON)
+
+		query := r.URL.Query()
+
+		start, errStart := parseTime(query.Get(paramStart))
+		end, errEnd := parseTime(query.Get(paramEnd))
+		step, errStep := parseStep(query.Get(paramStep))
+
+		for _, err := range []error{errStart, errEnd, errStep} {
+			if err != nil {
+				h.logger.Err.Printf("request query range with invalid parameters: %v\n", err)
+				http.Error(w, err.Error(), errs.ErrorHTTP(err))
+				return
+			}
+		}
+
+		agg := query.Get(paramAgg)
+		if len(agg) == 0 {
+			agg = storage.AggLast
+		}
+
+		// Все остальные параметры запроса - метки серии
+		labels := LabelsFromQuery(r)
+		for _, param := range []string{paramName, paramType, paramStart, paramEnd, paramStep, paramAgg} {
+			delete(labels, param)
+		}
+
+		metric, err := metricPkg.CreateMetric(query.Get(paramType), query.Get(paramName), metricPkg.WithLabels(labels))
+		if err != nil {
+			h.logger.Err.Printf("could not create metric: %v\n", err)
+			http.Error(w, err.Error(), errs.ErrorHTTP(err))
+			return
+		}
+
+		points, err := h.store.GetRange(metric, start, end)
+		if err != nil {
+			h.logger.Err.Printf("could not get metric history from storage: %v\n", err)
+			http.Error(w, err.Error(), errs.ErrorHTTP(err))
+			return
+		}
+
+		aligned, err := storage.Align(points, start, end, step, agg)
+		if err != nil {
+			h.logger.Err.Printf("could not align metric history: %v\n", err)
+			http.Error(w, err.Error(), errs.ErrorHTTP(err))
+			return
+		}
+
+		response := RangeResponse{
+			ID:          metric.ID,
+			MType:       metric.MType,
+			Labels:      metric.Labels,
+			Step:        step.String(),
+			Aggregation: agg,
+			Points:      aligned,
+		}
+
+		encode, errEncode := json.Marshal(&response)
+		if errEncode != nil {
+			h.logger.Err.Printf("error encode metric history to JSON: %v\n", errEncode)
+			http.Error(w, errEncode.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := w.Write(encode); err != nil {
+			h.logger.Err.Printf("error write data in response body: %v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseTime Разбор времени в формате RFC3339 или в секундах Unix
+func parseTime(data string) (time.Time, error) {
+
+	if len(data) == 0 {
+		return time.Time{}, fmt.Errorf("%w: missing time", errs.ErrInvalidQuery)
+	}
+
+	if seconds, err := strconv.ParseFloat(data, 64); err == nil {
+		if math.IsNaN(seconds) || seconds < 0 || seconds > maxUnixSeconds {
+			return time.Time{}, fmt.Errorf("%w: invalid time %q", errs.ErrInvalidQuery, data)
+		}
+
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid time %q", errs.ErrInvalidQuery, data)
+	}
+
+	return ts, nil
+}
+
+// parseStep Разбор шага в формате длительности или в секундах
+func parseStep(data string) (time.Duration, error) {
+
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: missing step", errs.ErrInvalidQuery)
+	}
+
+	if seconds, err := strconv.ParseFloat(data, 64); err == nil {
+		if math.IsNaN(seconds) || seconds*float64(time.Second) >= math.MaxInt64 {
+			return 0, fmt.Errorf("%w: invalid step %q", errs.ErrInvalidQuery, data)
+		}
+
+		return positiveStep(time.Duration(seconds*float64(time.Second)), data)
+	}
+
+	step, err := time.ParseDuration(data)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid step %q", errs.ErrInvalidQuery, data)
+	}
+
+	return positiveStep(step, data)
+}
+
+// positiveStep Проверка, что шаг больше нуля
+func positiveStep(step time.Duration, data string) (time.Duration, error) {
+
+	if step <= 0 {
+		return 0, fmt.Errorf("%w: step must be positive, got %q", errs.ErrInvalidQuery, data)
+	}
+
+	return step, nil
+}
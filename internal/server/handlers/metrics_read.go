@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/exposition"
 	metricPkg "metrics-and-alerting/pkg/metric"
 )
 
@@ -24,7 +25,8 @@ func (h Handler) GetAsText() http.HandlerFunc {
 		// затем разбиваем на массив:
 		// [0] - Тип метрики
 		// [1] - Название метрики
-		dataURL := strings.ReplaceAll(r.URL.String(), "/value/", "")
+		// Метки метрики передаются в параметрах запроса: ?<метка>=<значение>
+		dataURL := strings.ReplaceAll(r.URL.Path, "/value/", "")
 		partsURL := strings.Split(dataURL, "/")
 
 		if len(partsURL) != partsGetURL {
@@ -34,7 +36,7 @@ func (h Handler) GetAsText() http.HandlerFunc {
 			return
 		}
 
-		metric, err := metricPkg.CreateMetric(partsURL[idxType], partsURL[idxName])
+		metric, err := metricPkg.CreateMetric(partsURL[idxType], partsURL[idxName], metricPkg.WithLabels(LabelsFromQuery(r)))
 		if err != nil {
 			h.logger.Err.Printf("could not create metric: %v\n", err)
 			http.Error(w, err.Error(), errs.ErrorHTTP(err))
@@ -142,3 +144,24 @@ func (h Handler) GetMetrics() http.HandlerFunc {
 		}
 	}
 }
+
+// GetPrometheus Все метрики в текстовом формате Prometheus.
+// Формат OpenMetrics выбирается по заголовку Accept: application/openmetrics-text
+func (h Handler) GetPrometheus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		metrics, err := h.store.GetBatch()
+		if err != nil {
+			h.logger.Err.Printf("could not get all metrics from storage: %v\n", err)
+			http.Error(w, err.Error(), errs.ErrorHTTP(err))
+			return
+		}
+
+		format := exposition.Negotiate(r.Header.Get(Accept))
+		w.Header().Set(ContentType, string(format))
+
+		if err := exposition.Encode(w, metrics, format); err != nil {
+			h.logger.Err.Printf("error write metrics in response body: %v\n", err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"metrics-and-alerting/pkg/envelope"
 	"metrics-and-alerting/pkg/errs"
 	metricPkg "metrics-and-alerting/pkg/metric"
 )
@@ -26,7 +27,8 @@ func (h Handler) UpdateURL() http.HandlerFunc {
 		// [0] - Тип метрики
 		// [1] - Название метрики
 		// [2] - Значение метрики
-		dataURL := strings.ReplaceAll(r.URL.String(), "/update/", "")
+		// Метки метрики передаются в параметрах запроса: ?<метка>=<значение>
+		dataURL := strings.ReplaceAll(r.URL.Path, "/update/", "")
 		partsURL := strings.Split(dataURL, "/")
 
 		if len(partsURL) != partsUpdateURL {
@@ -40,6 +42,7 @@ func (h Handler) UpdateURL() http.HandlerFunc {
 			partsURL[idxType],
 			partsURL[idxName],
 			metricPkg.WithValue(partsURL[idxValue]),
+			metricPkg.WithLabels(LabelsFromQuery(r)),
 		)
 
 		if err != nil {
@@ -86,10 +89,10 @@ func (h Handler) UpdateJSON() http.HandlerFunc {
 			return
 		}
 
-		data, err := h.Decrypt(reader)
+		data, err := h.Decrypt(reader, r.Header.Get(envelope.Header))
 		if err != nil {
 			log.Printf("error read body request: %v\n", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), decryptStatus(err))
 			return
 		}
 
@@ -136,10 +139,10 @@ func (h Handler) UpdateDataJSON() http.HandlerFunc {
 			return
 		}
 
-		data, err := h.Decrypt(reader)
+		data, err := h.Decrypt(reader, r.Header.Get(envelope.Header))
 		if err != nil {
 			log.Printf("error read body request: %v\n", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), decryptStatus(err))
 			return
 		}
 
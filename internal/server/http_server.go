@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 
@@ -17,7 +18,7 @@ type MetricsServer struct {
 	privateKey []byte
 }
 
-func NewHTTPServer(addr string, h *handler.Handler) *MetricsServer {
+func NewHTTPServer(addr string, h *handler.Handler, opts ...OptionsServer) *MetricsServer {
 
 	r := chi.NewRouter()
 	r.Use(h.DecompressRequest)
@@ -32,6 +33,9 @@ func NewHTTPServer(addr string, h *handler.Handler) *MetricsServer {
 	r.Post("/value", h.GetAsJSON())
 	r.Post("/value/", h.GetAsJSON())
 
+	r.Get("/api/v1/query_range", h.QueryRange())
+	r.Get("/metrics", h.GetPrometheus())
+
 	r.Post("/update/*", h.UpdateURL())
 	r.Post("/update", h.UpdateJSON())
 	r.Post("/update/", h.UpdateJSON())
@@ -45,12 +49,32 @@ func NewHTTPServer(addr string, h *handler.Handler) *MetricsServer {
 		},
 	}
 
+	for _, opt := range opts {
+		opt(serv)
+	}
+
 	return serv
 }
 
+// WithTLS Прием соединений HTTPS с настройками cfg. При cfg = nil используется HTTP.
+func WithTLS(cfg *tls.Config) OptionsServer {
+	return func(serv *MetricsServer) {
+		serv.HTTP.TLSConfig = cfg
+	}
+}
+
 func (serv *MetricsServer) Start() {
 	go func() {
-		if err := serv.HTTP.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+
+		// Сертификаты берутся из TLSConfig
+		if serv.HTTP.TLSConfig != nil {
+			err = serv.HTTP.ListenAndServeTLS("", "")
+		} else {
+			err = serv.HTTP.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
 			fmt.Printf("HTTP server ListenAndServe: %v\n", err)
 		}
 	}()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"metrics-and-alerting/internal/server/alerting"
 	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/pkg/errs"
 	"metrics-and-alerting/pkg/logpack"
@@ -19,6 +20,9 @@ type MetricsManager struct {
 	intervalFlush time.Duration
 	restore       bool
 	signKey       []byte
+	alerts        *alerting.Engine
+	intervalAlert time.Duration
+	events        *broker
 	ctx           context.Context
 	cancel        context.CancelFunc
 }
@@ -28,6 +32,7 @@ func New(storage storage.Repository, logger *logpack.LogPack, opts ...OptionsMan
 	manager := &MetricsManager{
 		storage: storage,
 		logger:  logger,
+		events:  newBroker(),
 	}
 
 	manager.ctx, manager.cancel = context.WithCancel(context.Background())
@@ -46,6 +51,10 @@ func New(storage storage.Repository, logger *logpack.LogPack, opts ...OptionsMan
 		go manager.flushByTick(manager.ctx)
 	}
 
+	if manager.alerts != nil && manager.intervalAlert > 0 {
+		go manager.evaluateByTick(manager.ctx)
+	}
+
 	return manager
 }
 
@@ -67,6 +76,14 @@ func WithRestore(restore bool) OptionsManager {
 	}
 }
 
+// WithAlerting Проверка правил алертинга с интервалом interval
+func WithAlerting(engine *alerting.Engine, interval time.Duration) OptionsManager {
+	return func(manager *MetricsManager) {
+		manager.alerts = engine
+		manager.intervalAlert = interval
+	}
+}
+
 func (manager MetricsManager) flushByTick(ctx context.Context) {
 
 	ticker := time.NewTicker(manager.intervalFlush)
@@ -84,19 +101,36 @@ func (manager MetricsManager) flushByTick(ctx context.Context) {
 	}
 }
 
-func (manager MetricsManager) accumulateCounter(metric *metricPkg.Metric) {
-	if metric.MType != metricPkg.CounterType {
-		return
+func (manager MetricsManager) evaluateByTick(ctx context.Context) {
+
+	ticker := time.NewTicker(manager.intervalAlert)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := manager.alerts.Evaluate(now); err != nil {
+				manager.logger.Err.Printf("could not evaluate alert rules: %v\n", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	knownCounter, err := manager.storage.Get(*metric)
-	if err != nil {
-		return
+// validate Проверка подписи и значения метрики, полученной от клиента
+func (manager MetricsManager) validate(metric metricPkg.Metric) error {
+
+	if err := manager.verifySign(metric); err != nil {
+		return err
 	}
 
-	accum := *metric.Delta + *knownCounter.Delta
-	metric.Delta = &accum
+	if metric.MType == metricPkg.CounterType || metric.MType == metricPkg.HistogramType {
+		return storage.CheckAccumulate(metric)
+	}
 
+	return nil
 }
 
 // verifySign - Проверка подписи метрики
@@ -119,15 +153,15 @@ func (manager MetricsManager) verifySign(metric metricPkg.Metric) error {
 
 func (manager MetricsManager) Upsert(metric metricPkg.Metric) error {
 
-	if err := manager.verifySign(metric); err != nil {
+	if err := manager.validate(metric); err != nil {
 		return fmt.Errorf("could not upsert metric: %w", err)
 	}
 
-	manager.accumulateCounter(&metric)
-
-	err := manager.storage.Upsert(metric)
+	err := manager.upsert(&metric)
 
 	if err == nil {
+		manager.publish(metric)
+
 		if err = manager.Flush(); err != nil {
 			manager.logger.Err.Printf("Could not flush metrics after upsert: %v\n", err)
 		}
@@ -138,21 +172,29 @@ func (manager MetricsManager) Upsert(metric metricPkg.Metric) error {
 	return err
 }
 
+// UpsertBatch Сохранение набора метрик.
+// Набор проверяется целиком до сохранения: если хотя бы одна метрика не прошла проверку, ничего не сохраняется.
+// Ошибка хранилища прерывает сохранение, и метрики до нее остаются сохраненными,
+// поэтому повторная отправка набора после такой ошибки может учесть приращения счетчиков дважды
+// (доставка не менее одного раза).
 func (manager MetricsManager) UpsertBatch(metrics []metricPkg.Metric) error {
 
-	for i, m := range metrics {
-		if err := manager.verifySign(m); err != nil {
+	for _, m := range metrics {
+		if err := manager.validate(m); err != nil {
 			return fmt.Errorf("could not upsert metrics %s: %w", m, err)
 		}
+	}
 
-		manager.accumulateCounter(&m)
-		metrics[i].Delta = m.Delta
-
-		if err := manager.storage.Upsert(m); err != nil {
+	for i, m := range metrics {
+		if err := manager.upsert(&m); err != nil {
 			err = fmt.Errorf("could not update metric %s: %w", m.ShotString(), err)
 			manager.logger.Err.Println(err)
 			return err
 		}
+		metrics[i].Delta = m.Delta
+		metrics[i].Histogram = m.Histogram
+
+		manager.publish(m)
 	}
 
 	if err := manager.Flush(); err != nil {
@@ -162,6 +204,45 @@ func (manager MetricsManager) UpsertBatch(metrics []metricPkg.Metric) error {
 	return nil
 }
 
+// upsert Сохранение метрики в хранилище.
+// Счетчик и гистограмма прибавляются к сохраненному значению атомарно, в metric записывается накопленное значение.
+func (manager MetricsManager) upsert(metric *metricPkg.Metric) error {
+
+	if metric.MType != metricPkg.CounterType && metric.MType != metricPkg.HistogramType {
+		return manager.storage.Upsert(*metric)
+	}
+
+	accum, err := manager.storage.Add(*metric)
+	if err != nil {
+		return err
+	}
+
+	metric.Delta = accum.Delta
+	metric.Histogram = accum.Histogram
+	return nil
+}
+
+// Add Атомарное прибавление Delta счетчика к сохраненному значению
+func (manager MetricsManager) Add(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	if err := manager.verifySign(metric); err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to counter: %w", err)
+	}
+
+	accum, err := manager.storage.Add(metric)
+	if err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	manager.publish(accum)
+
+	if err = manager.Flush(); err != nil {
+		manager.logger.Err.Printf("Could not flush metrics after add: %v\n", err)
+	}
+
+	return accum, nil
+}
+
 func (manager MetricsManager) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
 
 	m, err := manager.storage.Get(metric)
@@ -169,13 +250,46 @@ func (manager MetricsManager) Get(metric metricPkg.Metric) (metricPkg.Metric, er
 		return metricPkg.Metric{}, err
 	}
 
+	return manager.withHash(m), nil
+}
+
+// withHash Метрика с подписью ключом сервера
+func (manager MetricsManager) withHash(m metricPkg.Metric) metricPkg.Metric {
+
 	if hash, err := m.Sign(manager.signKey); err == nil {
 		m.Hash = hash
 	} else {
 		manager.logger.Err.Printf("could not get hash metric: %v\n", err)
 	}
 
-	return m, nil
+	return m
+}
+
+// Subscribe Подписка на изменения метрик через Upsert, UpsertBatch и Add.
+// В канал передаются сохраненные значения метрик: накопленные значения счетчиков и гистограмм.
+// Если подписчик не успевает читать buffer событий, канал закрывается.
+// Функция отписки должна быть вызвана после окончания чтения.
+func (manager MetricsManager) Subscribe(buffer int) (<-chan metricPkg.Metric, func()) {
+	return manager.events.subscribe(buffer)
+}
+
+// publish Отправка сохраненного значения метрики подписчикам
+func (manager MetricsManager) publish(m metricPkg.Metric) {
+
+	if len(m.Labels) > 0 {
+		labels := make(map[string]string, len(m.Labels))
+		for name, value := range m.Labels {
+			labels[name] = value
+		}
+
+		m.Labels = labels
+	}
+
+	if m.Histogram != nil {
+		m.Histogram = m.Histogram.Copy()
+	}
+
+	manager.events.publish(manager.withHash(m))
 }
 
 func (manager MetricsManager) GetBatch() ([]metricPkg.Metric, error) {
@@ -198,6 +312,11 @@ func (manager MetricsManager) GetBatch() ([]metricPkg.Metric, error) {
 	return metrics, nil
 }
 
+// GetRange Получение значений серии метрики в интервале времени [start, end]
+func (manager MetricsManager) GetRange(metric metricPkg.Metric, start, end time.Time) ([]storage.Point, error) {
+	return manager.storage.GetRange(metric, start, end)
+}
+
 func (manager MetricsManager) Delete(metric metricPkg.Metric) error {
 
 	err := manager.storage.Delete(metric)
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"metrics-and-alerting/internal/storage/memstore"
+	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// TestMetricsManager_ConcurrentCounter Одновременные обновления счетчика через Upsert и UpsertBatch не теряются
+func TestMetricsManager_ConcurrentCounter(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	const (
+		workers    = 8
+		iterations = 500
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(1))
+				assert.NoError(t, manager.Upsert(counter))
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(2))
+				assert.NoError(t, manager.UpsertBatch([]metricPkg.Metric{counter}))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	got, err := manager.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations*3), *got.Delta)
+}
+
+func TestMetricsManager_UpsertBatchAccumulated(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	first, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(5))
+	require.NoError(t, manager.Upsert(first))
+
+	second, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(3))
+	metrics := []metricPkg.Metric{second}
+	require.NoError(t, manager.UpsertBatch(metrics))
+
+	// В переданный набор записывается накопленное значение счетчика
+	assert.Equal(t, int64(8), *metrics[0].Delta)
+
+	accum, err := manager.Add(first)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), *accum.Delta)
+}
+
+// TestMetricsManager_InvalidHistogram Несогласованная гистограмма отклоняется с кодом 400
+func TestMetricsManager_InvalidHistogram(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	invalid := metricPkg.Metric{
+		ID:        "Latency",
+		MType:     metricPkg.HistogramType,
+		Histogram: &metricPkg.Histogram{Bounds: []float64{1, 2, 3}, Counts: []uint64{1}, Count: 1},
+	}
+
+	err := manager.Upsert(invalid)
+	require.ErrorIs(t, err, errs.ErrInvalidValue)
+	assert.Equal(t, http.StatusBadRequest, errs.ErrorHTTP(err))
+	assert.Equal(t, codes.InvalidArgument, errs.ErrorGRPC(err))
+
+	// Набор с некорректной метрикой не сохраняется целиком
+	counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(1))
+	err = manager.UpsertBatch([]metricPkg.Metric{counter, invalid})
+	assert.ErrorIs(t, err, errs.ErrInvalidValue)
+
+	_, err = manager.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	_, err = manager.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+}
+
+// TestMetricsManager_ConcurrentHistogram Одновременные обновления гистограммы не теряют наблюдения
+func TestMetricsManager_ConcurrentHistogram(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	const (
+		workers    = 8
+		iterations = 200
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				h, _ := metricPkg.NewHistogram([]float64{1})
+				h.Observe(0.5)
+
+				histogram, _ := metricPkg.CreateMetric(metricPkg.HistogramType, "Latency", metricPkg.WithHistogram(*h))
+				assert.NoError(t, manager.Upsert(histogram))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	got, err := manager.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(workers*iterations), got.Histogram.Count)
+	assert.Equal(t, []uint64{workers * iterations, 0}, got.Histogram.Counts)
+}
+
+func TestMetricsManager_SlowSubscriber(t *testing.T) {
+
+	manager := New(memstore.New(), logpack.NewLogger())
+
+	events, unsubscribe := manager.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(float64(i)))
+		require.NoError(t, manager.Upsert(gauge))
+	}
+
+	m, ok := <-events
+	require.True(t, ok)
+	assert.Equal(t, 0.0, *m.Value)
+
+	// Подписчик, не успевший прочитать события, отключается
+	_, ok = <-events
+	assert.False(t, ok)
+}
@@ -0,0 +1,363 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics-and-alerting/internal/server/alerting"
+	"metrics-and-alerting/pkg/logpack"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	defaultQueueSize  = 64
+	defaultMaxBackoff = time.Minute
+)
+
+type (
+	OptionsNotifier func(*Notifier)
+
+	// Payload Тело уведомления, отправляемое на webhook
+	Payload struct {
+		Receiver    string            `json:"receiver"`     // URL получателя
+		Status      string            `json:"status"`       // firing, если в группе есть firing алерты, иначе resolved
+		GroupKey    string            `json:"group_key"`    // ключ группы
+		GroupLabels map[string]string `json:"group_labels"` // значения меток, по которым сгруппированы алерты
+		Alerts      []alerting.Alert  `json:"alerts"`       // алерты группы
+	}
+
+	// Notifier Отправка уведомлений об алертах на webhook.
+	// Алерты группируются по меткам groupBy, для каждой группы уведомление отправляется
+	// при появлении новых firing алертов, при переходе алертов в resolved
+	// и повторно с интервалом repeatInterval, пока в группе есть firing алерты.
+	// Каждый получатель обслуживается отдельной горутиной с повторными попытками отправки.
+	Notifier struct {
+		mu             sync.Mutex
+		logger         *logpack.LogPack
+		client         *http.Client
+		groupBy        []string
+		repeatInterval time.Duration
+		retries        int
+		backoff        time.Duration
+		maxBackoff     time.Duration
+		receivers      []*receiver
+		groups         map[string]*group
+		ctx            context.Context
+		cancel         context.CancelFunc
+		wg             sync.WaitGroup
+	}
+
+	// group Состояние группы алертов
+	group struct {
+		fingerprint string
+		lastSent    time.Time
+	}
+
+	// receiver Получатель уведомлений со своей очередью
+	receiver struct {
+		url   string
+		queue chan Payload
+	}
+)
+
+func New(urls []string, logger *logpack.LogPack, opts ...OptionsNotifier) *Notifier {
+
+	n := &Notifier{
+		logger:         logger,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		groupBy:        []string{alerting.LabelAlertName},
+		repeatInterval: 4 * time.Hour,
+		retries:        5,
+		backoff:        time.Second,
+		maxBackoff:     defaultMaxBackoff,
+		groups:         make(map[string]*group),
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if len(url) == 0 {
+			continue
+		}
+
+		r := &receiver{
+			url:   url,
+			queue: make(chan Payload, defaultQueueSize),
+		}
+
+		n.receivers = append(n.receivers, r)
+
+		n.wg.Add(1)
+		go n.serve(r)
+	}
+
+	return n
+}
+
+// WithGroupBy Метки, по которым группируются алерты
+func WithGroupBy(labels []string) OptionsNotifier {
+	return func(n *Notifier) {
+		if len(labels) > 0 {
+			n.groupBy = labels
+		}
+	}
+}
+
+// WithRepeatInterval Интервал повторной отправки уведомления о firing алертах
+func WithRepeatInterval(interval time.Duration) OptionsNotifier {
+	return func(n *Notifier) {
+		n.repeatInterval = interval
+	}
+}
+
+// WithRetry Количество повторных попыток отправки и начальная задержка между ними.
+// Задержка удваивается после каждой неудачной попытки.
+func WithRetry(retries int, backoff time.Duration) OptionsNotifier {
+	return func(n *Notifier) {
+		n.retries = retries
+		n.backoff = backoff
+	}
+}
+
+// WithClient HTTP клиент для отправки уведомлений
+func WithClient(client *http.Client) OptionsNotifier {
+	return func(n *Notifier) {
+		n.client = client
+	}
+}
+
+// Notify Группировка алертов и постановка уведомлений в очереди получателей.
+// Реализация интерфейса alerting.Notifier
+func (n *Notifier) Notify(now time.Time, alerts []alerting.Alert) {
+
+	if len(n.receivers) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	grouped := make(map[string][]alerting.Alert)
+	for _, alert := range alerts {
+		key := n.groupKey(alert)
+		grouped[key] = append(grouped[key], alert)
+	}
+
+	keys := make([]string, 0, len(grouped))
+	for key := range grouped {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		groupAlerts := grouped[key]
+
+		state, ok := n.groups[key]
+		if !ok {
+			state = &group{}
+			n.groups[key] = state
+		}
+
+		fingerprint, firing, resolved := summary(groupAlerts)
+
+		send := resolved ||
+			(firing && fingerprint != state.fingerprint) ||
+			(firing && n.repeatInterval > 0 && now.Sub(state.lastSent) >= n.repeatInterval)
+
+		if !send {
+			continue
+		}
+
+		status := StatusResolved
+		if firing {
+			status = StatusFiring
+		}
+
+		payload := Payload{
+			Status:      status,
+			GroupKey:    key,
+			GroupLabels: n.groupLabels(groupAlerts[0]),
+			Alerts:      groupAlerts,
+		}
+
+		n.enqueue(payload)
+
+		state.lastSent = now
+		state.fingerprint = fingerprint
+
+		if !firing {
+			delete(n.groups, key)
+		}
+	}
+}
+
+// Close Остановка отправки уведомлений.
+// Ожидает завершения горутин получателей, неотправленные уведомления отбрасываются.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+func (n *Notifier) enqueue(payload Payload) {
+
+	for _, r := range n.receivers {
+		payload.Receiver = r.url
+
+		select {
+		case r.queue <- payload:
+		default:
+			n.logger.Err.Printf("notification queue of receiver %s is full, drop group %s\n", r.url, payload.GroupKey)
+		}
+	}
+}
+
+func (n *Notifier) serve(r *receiver) {
+
+	defer n.wg.Done()
+
+	for {
+		select {
+		case payload := <-r.queue:
+			if err := n.deliver(r.url, payload); err != nil {
+				n.logger.Err.Printf("could not notify %s: %v\n", r.url, err)
+			}
+
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver Отправка уведомления с повторными попытками
+func (n *Notifier) deliver(url string, payload Payload) error {
+
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return fmt.Errorf("error encode notification to JSON: %w", err)
+	}
+
+	backoff := n.backoff
+
+	for attempt := 0; ; attempt++ {
+
+		err = n.send(url, data)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= n.retries {
+			return fmt.Errorf("notification failed after %d attempts: %w", attempt+1, err)
+		}
+
+		n.logger.Err.Printf("notification to %s failed, retry in %s: %v\n", url, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > n.maxBackoff {
+			backoff = n.maxBackoff
+		}
+	}
+}
+
+func (n *Notifier) send(url string, data []byte) error {
+
+	request, err := http.NewRequestWithContext(n.ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	if errClose := response.Body.Close(); errClose != nil {
+		n.logger.Err.Printf("could not close notification response body: %v\n", errClose)
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("receiver returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// groupKey Ключ группы алерта по значениям меток groupBy
+func (n *Notifier) groupKey(alert alerting.Alert) string {
+
+	parts := make([]string, 0, len(n.groupBy))
+	for _, label := range n.groupBy {
+		parts = append(parts, label+"="+alert.Labels[label])
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (n *Notifier) groupLabels(alert alerting.Alert) map[string]string {
+
+	labels := make(map[string]string, len(n.groupBy))
+	for _, label := range n.groupBy {
+		labels[label] = alert.Labels[label]
+	}
+
+	return labels
+}
+
+// summary Отпечаток набора firing алертов группы и признаки наличия firing и resolved алертов
+func summary(alerts []alerting.Alert) (string, bool, bool) {
+
+	var (
+		firing   []string
+		resolved bool
+	)
+
+	for _, alert := range alerts {
+		switch alert.State {
+		case alerting.StateFiring:
+			firing = append(firing, labelsKey(alert.Labels))
+		case alerting.StateResolved:
+			resolved = true
+		}
+	}
+
+	sort.Strings(firing)
+	return strings.Join(firing, ";"), len(firing) > 0, resolved
+}
+
+// labelsKey Строковое представление меток, отсортированных по имени
+func labelsKey(labels map[string]string) string {
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+labels[name])
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
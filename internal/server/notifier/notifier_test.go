@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/server/alerting"
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReceiver Webhook получатель, который отвечает ошибкой на первые fails запросов
+type testReceiver struct {
+	mu       sync.Mutex
+	fails    int
+	attempts int
+	payloads []Payload
+}
+
+func (tr *testReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.attempts++
+	if tr.fails > 0 {
+		tr.fails--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var payload Payload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tr.payloads = append(tr.payloads, payload)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (tr *testReceiver) received() []Payload {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return append([]Payload(nil), tr.payloads...)
+}
+
+func newAlert(rule, id string, state alerting.State) alerting.Alert {
+	return alerting.Alert{
+		Rule:  rule,
+		MType: metricPkg.GaugeType,
+		ID:    id,
+		State: state,
+		Labels: map[string]string{
+			alerting.LabelAlertName: rule,
+			alerting.LabelType:      metricPkg.GaugeType,
+			alerting.LabelID:        id,
+		},
+	}
+}
+
+func TestNotifier_RetryWithBackoff(t *testing.T) {
+
+	tr := &testReceiver{fails: 2}
+	server := httptest.NewServer(tr)
+	defer server.Close()
+
+	n := New([]string{server.URL}, logpack.NewLogger(), WithRetry(3, time.Millisecond))
+	defer n.Close()
+
+	n.Notify(time.Now(), []alerting.Alert{newAlert("HighHeap", "HeapAlloc", alerting.StateFiring)})
+
+	require.Eventually(t, func() bool { return len(tr.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	payload := tr.received()[0]
+	assert.Equal(t, StatusFiring, payload.Status)
+	assert.Equal(t, server.URL, payload.Receiver)
+	assert.Equal(t, map[string]string{alerting.LabelAlertName: "HighHeap"}, payload.GroupLabels)
+	require.Len(t, payload.Alerts, 1)
+	assert.Equal(t, "HeapAlloc", payload.Alerts[0].ID)
+
+	tr.mu.Lock()
+	assert.Equal(t, 3, tr.attempts)
+	tr.mu.Unlock()
+}
+
+func TestNotifier_Grouping(t *testing.T) {
+
+	tr := &testReceiver{}
+	server := httptest.NewServer(tr)
+	defer server.Close()
+
+	n := New([]string{server.URL}, logpack.NewLogger(), WithGroupBy([]string{alerting.LabelAlertName}))
+	defer n.Close()
+
+	n.Notify(time.Now(), []alerting.Alert{
+		newAlert("HighHeap", "HeapAlloc", alerting.StateFiring),
+		newAlert("HighHeap", "HeapSys", alerting.StateFiring),
+		newAlert("LowMemory", "FreeMemory", alerting.StateFiring),
+	})
+
+	require.Eventually(t, func() bool { return len(tr.received()) == 2 }, time.Second, 5*time.Millisecond)
+
+	sizes := make(map[string]int)
+	for _, payload := range tr.received() {
+		sizes[payload.GroupLabels[alerting.LabelAlertName]] = len(payload.Alerts)
+	}
+
+	assert.Equal(t, map[string]int{"HighHeap": 2, "LowMemory": 1}, sizes)
+}
+
+func TestNotifier_RepeatAndResolve(t *testing.T) {
+
+	tr := &testReceiver{}
+	server := httptest.NewServer(tr)
+	defer server.Close()
+
+	n := New([]string{server.URL}, logpack.NewLogger(), WithRepeatInterval(time.Hour))
+	defer n.Close()
+
+	start := time.Now()
+	firing := []alerting.Alert{newAlert("HighHeap", "HeapAlloc", alerting.StateFiring)}
+
+	n.Notify(start, firing)
+	require.Eventually(t, func() bool { return len(tr.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Набор firing алертов не изменился и интервал повтора не истек - уведомления нет
+	n.Notify(start.Add(time.Minute), firing)
+
+	// Интервал повтора истек - уведомление отправляется повторно
+	n.Notify(start.Add(time.Hour), firing)
+	require.Eventually(t, func() bool { return len(tr.received()) == 2 }, time.Second, 5*time.Millisecond)
+
+	n.Notify(start.Add(time.Hour+time.Minute), []alerting.Alert{newAlert("HighHeap", "HeapAlloc", alerting.StateResolved)})
+	require.Eventually(t, func() bool { return len(tr.received()) == 3 }, time.Second, 5*time.Millisecond)
+
+	payloads := tr.received()
+	assert.Equal(t, StatusFiring, payloads[1].Status)
+	assert.Equal(t, StatusResolved, payloads[2].Status)
+}
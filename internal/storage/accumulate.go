@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/metric"
+)
+
+// CheckAccumulate Проверка, что метрику можно сложить с сохраненным значением серии
+func CheckAccumulate(m metric.Metric) error {
+
+	switch m.MType {
+	case metric.CounterType:
+		if m.Delta == nil {
+			return errs.ErrInvalidValue
+		}
+	case metric.HistogramType:
+		if m.Histogram == nil {
+			return errs.ErrInvalidValue
+		}
+		return m.Histogram.Validate()
+	default:
+		return errs.ErrInvalidType
+	}
+
+	return nil
+}
+
+// Accumulate Сложение метрики с сохраненным значением серии:
+// Delta счетчика прибавляется, наблюдения гистограммы объединяются.
+// known равен nil, если серия еще не сохранена.
+func Accumulate(known *metric.Metric, m metric.Metric) (metric.Metric, error) {
+
+	if known == nil {
+		return m, nil
+	}
+
+	switch m.MType {
+	case metric.CounterType:
+		if known.Delta != nil {
+			accum := *known.Delta + *m.Delta
+			m.Delta = &accum
+		}
+	case metric.HistogramType:
+		if known.Histogram != nil {
+			merged, err := known.Histogram.Merge(*m.Histogram)
+			if err != nil {
+				return metric.Metric{}, err
+			}
+			m.Histogram = &merged
+		}
+	}
+
+	return m, nil
+}
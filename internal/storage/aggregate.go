@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"metrics-and-alerting/pkg/errs"
+)
+
+// Функции агрегации значений внутри шага
+const (
+	AggLast = "last"
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggSum  = "sum"
+)
+
+// MaxAlignedPoints Максимальное количество шагов в одном запросе
+const MaxAlignedPoints = 11000
+
+// Align Выравнивание точек по шагу step с агрегацией значений внутри шага функцией fn.
+// Шаги выровнены по времени Unix: шаг с меткой t содержит точки из интервала [t, t+step).
+// Учитываются только точки из интервала [start, end], шаги без точек пропускаются.
+func Align(points []Point, start, end time.Time, step time.Duration, fn string) ([]Point, error) {
+
+	if step <= 0 {
+		return nil, fmt.Errorf("%w: step must be positive", errs.ErrInvalidQuery)
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: end must not be before start", errs.ErrInvalidQuery)
+	}
+
+	if int64(end.Sub(start)/step) >= MaxAlignedPoints {
+		return nil, fmt.Errorf("%w: exceeded maximum of %d points, increase step", errs.ErrInvalidQuery, MaxAlignedPoints)
+	}
+
+	reduce, ok := aggregations[fn]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown aggregation %q", errs.ErrInvalidQuery, fn)
+	}
+
+	aligned := make([]Point, 0)
+
+	var (
+		bucket time.Time
+		values []float64
+	)
+
+	flush := func() {
+		if len(values) > 0 {
+			aligned = append(aligned, Point{Timestamp: bucket, Value: reduce(values)})
+		}
+		values = values[:0]
+	}
+
+	for _, p := range points {
+		if p.Timestamp.Before(start) || p.Timestamp.After(end) {
+			continue
+		}
+
+		ts := alignTime(p.Timestamp, step)
+		if !ts.Equal(bucket) {
+			flush()
+			bucket = ts
+		}
+
+		values = append(values, p.Value)
+	}
+
+	flush()
+
+	return aligned, nil
+}
+
+// alignTime Начало шага, которому принадлежит момент ts
+func alignTime(ts time.Time, step time.Duration) time.Time {
+
+	nanos := ts.UnixNano()
+	offset := nanos % int64(step)
+	if offset < 0 {
+		offset += int64(step)
+	}
+
+	return time.Unix(0, nanos-offset).In(ts.Location())
+}
+
+var aggregations = map[string]func([]float64) float64{
+	AggLast: func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+
+	AggAvg: func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		return sum / float64(len(values))
+	},
+
+	AggMin: func(values []float64) float64 {
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+
+		return min
+	},
+
+	AggMax: func(values []float64) float64 {
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+
+		return max
+	},
+
+	AggSum: func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		return sum
+	},
+}
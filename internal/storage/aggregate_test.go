@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics-and-alerting/pkg/errs"
+)
+
+func TestAlign(t *testing.T) {
+
+	base := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	points := []Point{
+		{Timestamp: base.Add(5 * time.Second), Value: 4},
+		{Timestamp: base.Add(15 * time.Second), Value: 1},
+		{Timestamp: base.Add(25 * time.Second), Value: 3},
+		{Timestamp: base.Add(65 * time.Second), Value: 10},
+	}
+
+	tests := []struct {
+		name string
+		fn   string
+		want []float64
+	}{
+		{name: "Last", fn: AggLast, want: []float64{3, 10}},
+		{name: "Avg", fn: AggAvg, want: []float64{8.0 / 3, 10}},
+		{name: "Min", fn: AggMin, want: []float64{1, 10}},
+		{name: "Max", fn: AggMax, want: []float64{4, 10}},
+		{name: "Sum", fn: AggSum, want: []float64{8, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aligned, err := Align(points, base, base.Add(2*time.Minute), time.Minute, tt.fn)
+			require.NoError(t, err)
+			require.Len(t, aligned, len(tt.want))
+
+			for i, p := range aligned {
+				assert.Equal(t, base.Add(time.Duration(i)*time.Minute), p.Timestamp)
+				assert.InDelta(t, tt.want[i], p.Value, 1e-9)
+			}
+		})
+	}
+}
+
+func TestAlign_Window(t *testing.T) {
+
+	base := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	points := []Point{
+		{Timestamp: base, Value: 1},
+		{Timestamp: base.Add(20 * time.Second), Value: 2},
+		{Timestamp: base.Add(40 * time.Second), Value: 3},
+	}
+
+	// Точки за пределами интервала не учитываются, пустые шаги пропускаются
+	aligned, err := Align(points, base.Add(10*time.Second), base.Add(40*time.Second), 10*time.Second, AggSum)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Timestamp: base.Add(20 * time.Second), Value: 2},
+		{Timestamp: base.Add(40 * time.Second), Value: 3},
+	}, aligned)
+
+	_, err = Align(points, base, base.Add(time.Minute), 0, AggLast)
+	assert.ErrorIs(t, err, errs.ErrInvalidQuery)
+
+	_, err = Align(points, base.Add(time.Minute), base, time.Second, AggLast)
+	assert.ErrorIs(t, err, errs.ErrInvalidQuery)
+
+	_, err = Align(points, base, base.Add(time.Hour), time.Millisecond, AggLast)
+	assert.ErrorIs(t, err, errs.ErrInvalidQuery)
+
+	_, err = Align(points, base, base.Add(time.Minute), time.Second, "median")
+	assert.ErrorIs(t, err, errs.ErrInvalidQuery)
+}
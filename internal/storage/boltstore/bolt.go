@@ -0,0 +1,479 @@
+// Package boltstore Хранение метрик во встроенной базе данных bbolt (B+tree в одном файле)
+package boltstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+var (
+	// bucketMetrics Текущие значения метрик в формате JSON по ключу серии
+	bucketMetrics = []byte("metrics")
+
+	// bucketHistory Вложенный bucket для каждой серии: время точки (UnixNano, big-endian) - значение
+	bucketHistory = []byte("history")
+)
+
+var (
+	minTime = time.Unix(0, 0)
+	maxTime = time.Unix(0, math.MaxInt64)
+)
+
+type (
+	OptionsStorage func(*Storage)
+
+	// Storage Хранение метрик в файле базы данных bbolt.
+	// Каждое изменение записывается на диск в отдельной транзакции до возврата из метода,
+	// поэтому Restore не требуется, а Flush только удаляет устаревшие точки истории.
+	Storage struct {
+		db        *bolt.DB
+		logger    *logpack.LogPack
+		keep      bool          // сохранять ли историю значений при обновлении
+		retention time.Duration // сколько хранится история, 0 - без ограничения
+		mu        sync.Mutex
+		swept     time.Time // время последнего удаления устаревших точек всех серий
+		now       func() time.Time
+	}
+)
+
+// sweepInterval Минимальный интервал между удалениями устаревших точек всех серий в Flush,
+// который может вызываться после каждого изменения
+const sweepInterval = time.Minute
+
+// New Открытие (или создание) базы данных в файле path
+func New(path string, logger *logpack.LogPack, opts ...OptionsStorage) (*Storage, error) {
+
+	if len(path) == 0 {
+		return nil, errs.ErrInvalidFilePath
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		// Например, снимок файлового хранилища, указанный вместо файла базы данных
+		if errors.Is(err, bolt.ErrInvalid) || errors.Is(err, bolt.ErrVersionMismatch) || errors.Is(err, bolt.ErrChecksum) {
+			return nil, fmt.Errorf("could not open bolt database: %s is not a bolt database file: %w", path, err)
+		}
+
+		return nil, fmt.Errorf("could not open bolt database: %w", err)
+	}
+
+	store := &Storage{
+		db:     db,
+		logger: logger,
+		now:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	errBuckets := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketMetrics, bucketHistory} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if errBuckets != nil {
+		if errClose := db.Close(); errClose != nil {
+			logger.Err.Printf("could not close bolt database: %v\n", errClose)
+		}
+
+		return nil, fmt.Errorf("could not create buckets: %w", errBuckets)
+	}
+
+	return store, nil
+}
+
+// WithRetention Сохранение истории значений метрик в окне retention, 0 - без ограничения.
+// Без этой опции история значений не сохраняется.
+func WithRetention(retention time.Duration) OptionsStorage {
+	return func(store *Storage) {
+		store.keep = true
+		store.retention = retention
+	}
+}
+
+// Upsert Обновление значения метрики, или добавление метрики, если ранее её не существовало
+func (store *Storage) Upsert(metric metricPkg.Metric) error {
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.put(tx, metric)
+	})
+}
+
+// UpsertBatch Обновление набора метрик в одной транзакции
+func (store *Storage) UpsertBatch(metrics []metricPkg.Metric) error {
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, m := range metrics {
+			if err := store.put(tx, m); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Add Прибавление Delta счетчика или наблюдений гистограммы к сохраненному значению.
+// Чтение и запись выполняются в одной транзакции, транзакции записи bbolt выполняются по очереди.
+func (store *Storage) Add(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	if err := storage.CheckAccumulate(metric); err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+
+		var known *metricPkg.Metric
+		if m, errGet := get(tx, metric); errGet == nil {
+			known = &m
+		}
+
+		accum, errAccum := storage.Accumulate(known, metric)
+		if errAccum != nil {
+			return errAccum
+		}
+
+		metric = accum
+		return store.put(tx, metric)
+	})
+
+	if err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	return metric, nil
+}
+
+// Get - Получение полность заполненной метрики
+func (store *Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	var found metricPkg.Metric
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var errGet error
+		found, errGet = get(tx, metric)
+		return errGet
+	})
+
+	return found, err
+}
+
+// GetBatch Получение всех метрик, упорядоченных по ключу серии
+func (store *Storage) GetBatch() ([]metricPkg.Metric, error) {
+
+	metrics := make([]metricPkg.Metric, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMetrics).ForEach(func(_, data []byte) error {
+			var m metricPkg.Metric
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("could not decode metric: %w", err)
+			}
+
+			metrics = append(metrics, m)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// GetRange Получение значений серии метрики в интервале времени [start, end]
+func (store *Storage) GetRange(metric metricPkg.Metric, start, end time.Time) ([]storage.Point, error) {
+
+	points := make([]storage.Point, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+
+		key := seriesKey(metric)
+		if tx.Bucket(bucketMetrics).Get(key) == nil {
+			return errs.ErrNotFound
+		}
+
+		series := tx.Bucket(bucketHistory).Bucket(key)
+		if series == nil {
+			return nil
+		}
+
+		// Устаревшие точки серий, которые давно не обновлялись, еще могут не быть удалены
+		if deadline, ok := store.deadline(); ok && start.Before(deadline) {
+			start = deadline
+		}
+
+		cursor := series.Cursor()
+		to := encodeTime(end)
+
+		for k, v := cursor.Seek(encodeTime(start)); k != nil && string(k) <= string(to); k, v = cursor.Next() {
+			points = append(points, storage.Point{Timestamp: decodeTime(k), Value: decodeValue(v)})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// Delete - Удаление метрики и её истории
+func (store *Storage) Delete(metric metricPkg.Metric) error {
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+
+		key := seriesKey(metric)
+
+		metrics := tx.Bucket(bucketMetrics)
+		if metrics.Get(key) == nil {
+			return errs.ErrNotFound
+		}
+
+		if err := metrics.Delete(key); err != nil {
+			return err
+		}
+
+		history := tx.Bucket(bucketHistory)
+		if history.Bucket(key) == nil {
+			return nil
+		}
+
+		return history.DeleteBucket(key)
+	})
+}
+
+// Flush Удаление устаревших точек истории всех серий, в том числе переставших обновляться.
+// Данные записываются на диск при каждом изменении, поэтому другой работы Flush не выполняет.
+// Удаление выполняется не чаще sweepInterval.
+func (store *Storage) Flush() error {
+
+	if !store.keep || store.retention <= 0 {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	if now.Sub(store.swept) < sweepInterval {
+		return nil
+	}
+	store.swept = now
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+
+		history := tx.Bucket(bucketHistory)
+
+		var keys [][]byte
+		if err := history.ForEach(func(k, v []byte) error {
+			if v == nil {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			series := history.Bucket(key)
+			if err := store.prune(series); err != nil {
+				return err
+			}
+
+			if k, _ := series.Cursor().First(); k == nil {
+				if err := history.DeleteBucket(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Restore Данные читаются из файла базы данных при каждом запросе
+func (store *Storage) Restore() error {
+	return nil
+}
+
+func (store *Storage) Close() error {
+	return store.db.Close()
+}
+
+func (store *Storage) Health() bool {
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+
+	if err != nil {
+		store.logger.Err.Printf("bolt database is not available: %v\n", err)
+		return false
+	}
+
+	return true
+}
+
+// put Запись метрики и точки её истории в транзакции tx
+func (store *Storage) put(tx *bolt.Tx, metric metricPkg.Metric) error {
+
+	key := seriesKey(metric)
+
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return fmt.Errorf("could not encode metric: %w", err)
+	}
+
+	if err := tx.Bucket(bucketMetrics).Put(key, data); err != nil {
+		return err
+	}
+
+	if !store.keep {
+		return nil
+	}
+
+	value, ok := metric.FloatValue()
+	if !ok {
+		return nil
+	}
+
+	series, err := tx.Bucket(bucketHistory).CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+
+	return store.appendPoint(series, storage.Point{Timestamp: store.now(), Value: value})
+}
+
+// appendPoint Добавление точки в историю серии с удалением устаревших точек
+func (store *Storage) appendPoint(series *bolt.Bucket, point storage.Point) error {
+
+	ts := encodeTime(point.Timestamp)
+
+	// Время точки не может быть меньше времени последней точки серии
+	if last, _ := series.Cursor().Last(); last != nil && string(ts) < string(last) {
+		ts = append([]byte(nil), last...)
+	}
+
+	if err := series.Put(ts, encodeValue(point.Value)); err != nil {
+		return err
+	}
+
+	return store.prune(series)
+}
+
+// prune Удаление точек серии старше окна хранения
+func (store *Storage) prune(series *bolt.Bucket) error {
+
+	limit, ok := store.deadline()
+	if !ok {
+		return nil
+	}
+
+	deadline := encodeTime(limit)
+
+	// Удаление при обходе курсором может пропускать ключи, поэтому ключи сначала собираются
+	var expired [][]byte
+
+	cursor := series.Cursor()
+	for k, _ := cursor.First(); k != nil && string(k) < string(deadline); k, _ = cursor.Next() {
+		expired = append(expired, append([]byte(nil), k...))
+	}
+
+	for _, k := range expired {
+		if err := series.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deadline Время, раньше которого точки истории устарели; false, если окно хранения не ограничено
+func (store *Storage) deadline() (time.Time, bool) {
+
+	if store.retention <= 0 {
+		return time.Time{}, false
+	}
+
+	return store.now().Add(-store.retention), true
+}
+
+func get(tx *bolt.Tx, metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	data := tx.Bucket(bucketMetrics).Get(seriesKey(metric))
+	if data == nil {
+		return metricPkg.Metric{}, errs.ErrNotFound
+	}
+
+	var found metricPkg.Metric
+	if err := json.Unmarshal(data, &found); err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not decode metric: %w", err)
+	}
+
+	return found, nil
+}
+
+// seriesKey Ключ серии метрики
+func seriesKey(metric metricPkg.Metric) []byte {
+	return []byte(metric.MType + ":" + metric.SeriesKey())
+}
+
+// encodeTime Время в виде ключа, порядок ключей совпадает с порядком времени.
+// Время вне диапазона UnixNano (до 1970 и после 2262 года) приводится к границам диапазона.
+func encodeTime(t time.Time) []byte {
+
+	var nano int64
+
+	switch {
+	case t.Before(minTime):
+		nano = 0
+	case t.After(maxTime):
+		nano = math.MaxInt64
+	default:
+		nano = t.UnixNano()
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(nano))
+
+	return key
+}
+
+func decodeTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+func encodeValue(value float64) []byte {
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(value))
+
+	return data
+}
+
+func decodeValue(data []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(data))
+}
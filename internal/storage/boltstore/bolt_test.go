@@ -0,0 +1,170 @@
+package boltstore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Reopen(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	logger := logpack.NewLogger()
+
+	store, err := New(path, logger)
+	require.NoError(t, err)
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1.5),
+		metric.WithLabels(map[string]string{"host": "web-1"}))
+	counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(3))
+	removed, _ := metric.CreateMetric(metric.GaugeType, "Removed", metric.WithValueFloat(1))
+
+	require.NoError(t, store.UpsertBatch([]metric.Metric{gauge, counter, removed}))
+	require.NoError(t, store.Delete(removed))
+	assert.ErrorIs(t, store.Delete(removed), errs.ErrNotFound)
+	require.NoError(t, store.Close())
+
+	// Данные сохраняются без Flush
+	reopened, err := New(path, logger)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	got, err := reopened.Get(gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+	assert.Equal(t, "web-1", got.Labels["host"])
+
+	metrics, err := reopened.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	_, err = reopened.Get(removed)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+}
+
+func TestStorage_GetRange(t *testing.T) {
+
+	store, err := New(filepath.Join(t.TempDir(), "metrics.db"), logpack.NewLogger(), WithRetention(time.Minute))
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueInt(int64(i)))
+		require.NoError(t, store.Upsert(gauge))
+		now = now.Add(20 * time.Second)
+	}
+
+	gauge := metric.Metric{ID: "Alloc", MType: metric.GaugeType}
+
+	// Точки старше минуты удалены при добавлении последней точки и не возвращаются позже
+	points, err := store.GetRange(gauge, time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, 2.0, points[0].Value)
+	assert.Equal(t, 4.0, points[2].Value)
+
+	points, err = store.GetRange(gauge, time.Unix(1700000040, 0), time.Unix(1700000060, 0))
+	require.NoError(t, err)
+	assert.Len(t, points, 2)
+
+	_, err = store.GetRange(metric.Metric{ID: "Unknown", MType: metric.GaugeType}, time.Time{}, now)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+}
+
+// TestStorage_RetentionStale Окно хранения действует и для серий, которые перестали обновляться
+func TestStorage_RetentionStale(t *testing.T) {
+
+	store, err := New(filepath.Join(t.TempDir(), "metrics.db"), logpack.NewLogger(), WithRetention(time.Minute))
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	stale, _ := metric.CreateMetric(metric.GaugeType, "Stale", metric.WithValueFloat(1))
+	require.NoError(t, store.Upsert(stale))
+
+	now = now.Add(2 * time.Minute)
+
+	points, err := store.GetRange(stale, time.Time{}, now)
+	require.NoError(t, err)
+	assert.Empty(t, points)
+
+	require.NoError(t, store.Flush())
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(bucketHistory).Bucket(seriesKey(stale)))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Текущее значение серии сохраняется
+	got, err := store.Get(stale)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *got.Value)
+}
+
+func TestStorage_AddConcurrent(t *testing.T) {
+
+	store, err := New(filepath.Join(t.TempDir(), "metrics.db"), logpack.NewLogger())
+	require.NoError(t, err)
+	defer store.Close()
+
+	const (
+		workers    = 8
+		iterations = 50
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(1))
+				if _, err := store.Add(counter); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	got, err := store.Get(metric.Metric{ID: "PollCount", MType: metric.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *got.Delta)
+}
+
+// TestStorage_NotBoltFile Файл другого формата не открывается как база данных и не изменяется
+func TestStorage_NotBoltFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	snapshot := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+	require.NoError(t, os.WriteFile(path, snapshot, 0o644))
+
+	_, err := New(path, logpack.NewLogger())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a bolt database")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, data)
+}
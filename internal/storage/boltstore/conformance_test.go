@@ -0,0 +1,29 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/internal/storage/storagetest"
+	"metrics-and-alerting/pkg/logpack"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+
+	logger := logpack.NewLogger()
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		path := filepath.Join(t.TempDir(), "metrics.db")
+
+		return func(t *testing.T) storage.Repository {
+			store, err := New(path, logger, WithRetention(time.Hour))
+			require.NoError(t, err)
+
+			return store
+		}
+	}, storagetest.Options{Persistent: true})
+}
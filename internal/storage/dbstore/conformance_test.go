@@ -0,0 +1,53 @@
+package dbstore
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/internal/storage/storagetest"
+	"metrics-and-alerting/pkg/logpack"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorage_Conformance Проверка на PostgreSQL из DATABASE_DSN.
+// Если DATABASE_DSN не задан, используется заменитель базы данных в памяти.
+func TestStorage_Conformance(t *testing.T) {
+
+	logger := logpack.NewLogger()
+	dsn := os.Getenv("DATABASE_DSN")
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+
+		if len(dsn) == 0 {
+			fake, _ := newFakeDB(0)
+
+			return func(t *testing.T) storage.Repository {
+				return newStorage(sql.OpenDB(fake), logger, WithRetention(time.Hour))
+			}
+		}
+
+		clearDatabase(t, dsn)
+
+		return func(t *testing.T) storage.Repository {
+			store, err := New(dsn, logger, WithRetention(time.Hour))
+			require.NoError(t, err)
+
+			return store
+		}
+	}, storagetest.Options{Persistent: true})
+}
+
+// clearDatabase Удаление метрик, оставшихся от предыдущих тестов
+func clearDatabase(t *testing.T, dsn string) {
+
+	store, err := New(dsn, logpack.NewLogger())
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.db.Exec(`TRUNCATE runtimeMetrics, runtimeMetricsSamples;`)
+	require.NoError(t, err)
+}
@@ -0,0 +1,278 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeDB Заменитель PostgreSQL для тестов и бенчмарков.
+// Хранит таблицы runtimeMetrics, runtimeMetricsSamples и schema_migrations в памяти и выполняет
+// только запросы хранилища, распознавая их по началу текста. Транзакции не откатываются.
+// Каждое обращение к базе данных задерживается на latency.
+type fakeDB struct {
+	mu         sync.Mutex
+	latency    time.Duration
+	statements int // число выполненных запросов
+	metricRows int // число строк, записанных в runtimeMetrics
+	sampleRows int // число строк, записанных в runtimeMetricsSamples
+	migrations []int64
+
+	metrics map[string][]driver.Value // name, type, labels, delta, value, histogram по ключу серии
+	samples map[string][]driver.Value // name, type, labels, ts, value по ключу серии и времени
+}
+
+func newFakeDB(latency time.Duration) (*fakeDB, *sql.DB) {
+
+	db := &fakeDB{
+		latency: latency,
+		metrics: make(map[string][]driver.Value),
+		samples: make(map[string][]driver.Value),
+	}
+
+	return db, sql.OpenDB(db)
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return fakeDriver{db: db}
+}
+
+// roundtrip Задержка обращения к базе данных.
+// Используется активное ожидание: time.Sleep на малых интервалах спит заметно дольше заданного.
+func (db *fakeDB) roundtrip() {
+	for start := time.Now(); time.Since(start) < db.latency; {
+	}
+}
+
+func (db *fakeDB) reset() {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.statements, db.metricRows, db.sampleRows = 0, 0, 0
+}
+
+func rowKey(values ...driver.Value) string {
+
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, fmt.Sprint(value))
+	}
+
+	return strings.Join(parts, "|")
+}
+
+func (db *fakeDB) exec(query string, args []driver.Value) error {
+
+	db.roundtrip()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.statements++
+
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations "):
+		db.migrations = append(db.migrations, args[0].(int64))
+
+	case strings.HasPrefix(query, "INSERT INTO runtimeMetricsSamples "):
+		for i := 0; i+5 <= len(args); i += 5 {
+			row := append([]driver.Value(nil), args[i:i+5]...)
+			db.samples[rowKey(row[0], row[1], row[2], row[3])] = row
+			db.sampleRows++
+		}
+
+	case strings.HasPrefix(query, "INSERT INTO runtimeMetrics "):
+		for i := 0; i+6 <= len(args); i += 6 {
+			row := append([]driver.Value(nil), args[i:i+6]...)
+			db.metrics[rowKey(row[0], row[1], row[2])] = row
+			db.metricRows++
+		}
+
+	case strings.HasPrefix(query, "DELETE FROM runtimeMetricsSamples WHERE ts"):
+		deadline := args[0].(time.Time)
+		for key, row := range db.samples {
+			if row[3].(time.Time).Before(deadline) {
+				delete(db.samples, key)
+			}
+		}
+
+	case strings.HasPrefix(query, "DELETE FROM runtimeMetricsSamples "):
+		for key, row := range db.samples {
+			if rowKey(row[0], row[1], row[2]) == rowKey(args...) {
+				delete(db.samples, key)
+			}
+		}
+
+	case strings.HasPrefix(query, "DELETE FROM runtimeMetrics "):
+		delete(db.metrics, rowKey(args...))
+
+	case strings.HasPrefix(query, "SELECT pg_advisory_xact_lock"),
+		strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"),
+		strings.HasPrefix(query, "--"),
+		strings.HasPrefix(query, "SELECT "):
+
+	default:
+		return fmt.Errorf("fake database does not support query: %s", query)
+	}
+
+	return nil
+}
+
+func (db *fakeDB) query(query string, args []driver.Value) (driver.Rows, error) {
+
+	db.roundtrip()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT version FROM schema_migrations"):
+		rows := &fakeRows{columns: []string{"version"}}
+		for _, version := range db.migrations {
+			rows.values = append(rows.values, []driver.Value{version})
+		}
+
+		return rows, nil
+
+	// Прибавление к счетчику: INSERT ... RETURNING delta
+	case strings.HasPrefix(query, "INSERT INTO runtimeMetrics "):
+		key := rowKey(args[0], args[1], args[2])
+
+		delta := args[3].(int64)
+		if row, ok := db.metrics[key]; ok {
+			if known, isInt := row[3].(int64); isInt {
+				delta += known
+			}
+		}
+
+		db.metrics[key] = []driver.Value{args[0], args[1], args[2], delta, nil, nil}
+
+		return &fakeRows{columns: []string{"delta"}, values: [][]driver.Value{{delta}}}, nil
+
+	case strings.HasPrefix(query, "SELECT name,type,labels,delta,value,histogram"):
+		rows := &fakeRows{columns: []string{"name", "type", "labels", "delta", "value", "histogram"}}
+		for _, row := range db.metrics {
+			rows.values = append(rows.values, row)
+		}
+
+		return rows, nil
+
+	case strings.HasPrefix(query, "SELECT name,type,labels,ts,value"):
+		from := args[0].(time.Time)
+
+		rows := &fakeRows{columns: []string{"name", "type", "labels", "ts", "value"}}
+		for _, row := range db.samples {
+			if !row[3].(time.Time).Before(from) {
+				rows.values = append(rows.values, row)
+			}
+		}
+
+		sort.Slice(rows.values, func(i, j int) bool {
+			return rows.values[i][3].(time.Time).Before(rows.values[j][3].(time.Time))
+		})
+
+		return rows, nil
+	}
+
+	return nil, fmt.Errorf("fake database does not support query: %s", query)
+}
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{db: d.db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: strings.TrimSpace(query)}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.roundtrip()
+	return fakeTx{db: c.db}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	tx.db.roundtrip()
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+
+	if err := s.db.exec(s.query, args); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.db.query(s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
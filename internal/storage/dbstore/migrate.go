@@ -0,0 +1,186 @@
+package dbstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"metrics-and-alerting/pkg/logpack"
+)
+
+// migrationLockID Ключ advisory lock, под которым выполняются миграции.
+// Серверы, запущенные одновременно, применяют миграции по очереди.
+const migrationLockID = 72408113
+
+const (
+	queryLockMigrations = `SELECT pg_advisory_xact_lock($1);`
+
+	queryCreateMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+                               version    BIGINT PRIMARY KEY,
+                               name       TEXT NOT NULL,
+                               applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now() );`
+
+	queryGetMigrations = `SELECT version FROM schema_migrations;`
+
+	queryInsertMigration = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration Шаг изменения схемы базы данных из файла <версия>_<название>.sql
+type migration struct {
+	version int64
+	name    string
+	query   string
+}
+
+// Migrate Применение миграций схемы к базе данных dsn без запуска хранилища
+func Migrate(dsn string, logger *logpack.LogPack) error {
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("could not connect to database: %w", err)
+	}
+
+	defer func() {
+		if errClose := db.Close(); errClose != nil {
+			logger.Err.Printf("could not close database connection: %v\n", errClose)
+		}
+	}()
+
+	applied, err := migrate(context.Background(), db, migrationFiles, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Info.Printf("Applied migrations: %d\n", applied)
+	return nil
+}
+
+// loadMigrations Чтение миграций из каталога migrations, упорядоченных по версии
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(files))
+	versions := make(map[int64]string, len(files))
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+
+		parts := strings.SplitN(name, "_", 2)
+		version, errVersion := strconv.ParseInt(parts[0], 10, 64)
+		if errVersion != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration file name must be <version>_<name>.sql: %s", file)
+		}
+
+		if known, ok := versions[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, known, name)
+		}
+		versions[version] = name
+
+		data, errRead := fs.ReadFile(fsys, file)
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, query: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// migrate Применение еще не примененных миграций в одной транзакции под advisory lock.
+// Возвращает число примененных миграций.
+func migrate(ctx context.Context, db *sql.DB, fsys fs.FS, logger *logpack.LogPack) (int, error) {
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return 0, fmt.Errorf("could not load migrations: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin migration: %w", err)
+	}
+	defer func() {
+		if errRollBack := tx.Rollback(); errRollBack != nil && !errors.Is(errRollBack, sql.ErrTxDone) {
+			logger.Err.Printf("error rollback migrations: %v\n", errRollBack)
+		}
+	}()
+
+	// Блокировка снимается при завершении транзакции
+	if _, err = tx.ExecContext(ctx, queryLockMigrations, migrationLockID); err != nil {
+		return 0, fmt.Errorf("could not lock migrations: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queryCreateMigrations); err != nil {
+		return 0, fmt.Errorf("could not create migrations table: %w", err)
+	}
+
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, m.query); err != nil {
+			return 0, fmt.Errorf("could not apply migration %s: %w", m.name, err)
+		}
+
+		if _, err = tx.ExecContext(ctx, queryInsertMigration, m.version, m.name); err != nil {
+			return 0, fmt.Errorf("could not save migration %s: %w", m.name, err)
+		}
+
+		count++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit migrations: %w", err)
+	}
+
+	return count, nil
+}
+
+func appliedVersions(ctx context.Context, tx *sql.Tx) (map[int64]bool, error) {
+
+	rows, err := tx.QueryContext(ctx, queryGetMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("could not read applied migrations: %w", err)
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,59 @@
+package dbstore
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"metrics-and-alerting/pkg/logpack"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.version, m.name)
+		assert.NotEmpty(t, m.query)
+	}
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/0001_first.sql":  {Data: []byte("SELECT 1;")},
+		"migrations/1_duplicate.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/first.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err)
+}
+
+func TestMigrate(t *testing.T) {
+
+	fake, db := newFakeDB(0)
+	logger := logpack.NewLogger()
+
+	fsys := fstest.MapFS{
+		"migrations/0002_second.sql": {Data: []byte("SELECT 2;")},
+		"migrations/0001_first.sql":  {Data: []byte("SELECT 1;")},
+	}
+
+	applied, err := migrate(context.Background(), db, fsys, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, []int64{1, 2}, fake.migrations)
+
+	// Примененные миграции не выполняются повторно
+	fsys["migrations/0003_third.sql"] = &fstest.MapFile{Data: []byte("SELECT 3;")}
+
+	applied, err = migrate(context.Background(), db, fsys, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, []int64{1, 2, 3}, fake.migrations)
+}
@@ -0,0 +1,8 @@
+-- Исходная схема: текущие значения метрик
+CREATE TABLE IF NOT EXISTS runtimeMetrics (
+    id     SERIAL,
+    name   CHARACTER VARYING(50) PRIMARY KEY,
+    type   CHARACTER VARYING(50),
+    delta  BIGINT,
+    value  DOUBLE PRECISION
+);
@@ -0,0 +1,10 @@
+-- Первичный ключ по имени и типу: gauge и counter с одинаковым именем - разные серии.
+-- Серии с одинаковым именем и типом различаются метками.
+ALTER TABLE runtimeMetrics ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '{}';
+
+UPDATE runtimeMetrics SET type = '' WHERE type IS NULL;
+
+ALTER TABLE runtimeMetrics DROP CONSTRAINT IF EXISTS runtimemetrics_pkey;
+DROP INDEX IF EXISTS runtimemetrics_series_idx;
+
+ALTER TABLE runtimeMetrics ADD CONSTRAINT runtimemetrics_pkey PRIMARY KEY (name, type, labels);
@@ -0,0 +1,3 @@
+-- Время создания и последнего изменения серии
+ALTER TABLE runtimeMetrics ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+ALTER TABLE runtimeMetrics ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
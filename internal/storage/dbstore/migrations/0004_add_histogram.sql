@@ -0,0 +1,2 @@
+-- Значение гистограммы хранится в формате JSON
+ALTER TABLE runtimeMetrics ADD COLUMN IF NOT EXISTS histogram TEXT;
@@ -0,0 +1,9 @@
+-- История значений серий метрик
+CREATE TABLE IF NOT EXISTS runtimeMetricsSamples (
+    name   CHARACTER VARYING(50) NOT NULL,
+    type   CHARACTER VARYING(50) NOT NULL,
+    labels TEXT NOT NULL DEFAULT '{}',
+    ts     TIMESTAMP WITH TIME ZONE NOT NULL,
+    value  DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (name, type, labels, ts)
+);
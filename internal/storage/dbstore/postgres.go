@@ -1,41 +1,91 @@
 package dbstore
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
 
+	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/internal/storage/memstore"
 	"metrics-and-alerting/pkg/logpack"
 	metricPkg "metrics-and-alerting/pkg/metric"
 )
 
 const (
-	queryChangeGauge = `INSERT INTO runtimeMetrics (name,type,value)
-                         VALUES ($1,$2,$3)
-                         ON CONFLICT (name)
-                         DO UPDATE
-                         SET name=$1,type=$2,value=$3;`
-
-	queryChangeCounter = `INSERT INTO runtimeMetrics (name,type,delta)
-                           VALUES ($1,$2,$3)
-                           ON CONFLICT (name)
-                           DO UPDATE
-                           SET name=$1,type=$2,delta=$3;`
-
-	queryGetMetrics = `SELECT name,type,delta, value
+	// Многострочная запись текущих значений серий, %s заменяется списком VALUES
+	queryUpsertMetrics = `INSERT INTO runtimeMetrics (name,type,labels,delta,value,histogram)
+                          VALUES %s
+                          ON CONFLICT (name,type,labels)
+                          DO UPDATE
+                          SET delta=EXCLUDED.delta, value=EXCLUDED.value, histogram=EXCLUDED.histogram, updated_at=now();`
+
+	// Прибавление к счетчику выполняется в базе данных, чтобы не потерять одновременные обновления
+	queryAddCounter = `INSERT INTO runtimeMetrics (name,type,labels,delta)
+                        VALUES ($1,$2,$3,$4)
+                        ON CONFLICT (name,type,labels)
+                        DO UPDATE
+                        SET delta=runtimeMetrics.delta+$4, updated_at=now()
+                        RETURNING delta;`
+
+	queryGetMetrics = `SELECT name,type,labels,delta,value,histogram
                        FROM runtimeMetrics`
+
+	queryDeleteMetric = `DELETE FROM runtimeMetrics WHERE name=$1 AND type=$2 AND labels=$3;`
+
+	queryInsertSamples = `INSERT INTO runtimeMetricsSamples (name,type,labels,ts,value)
+                          VALUES %s
+                          ON CONFLICT (name,type,labels,ts)
+                          DO UPDATE
+                          SET value=EXCLUDED.value;`
+
+	queryGetSamples = `SELECT name,type,labels,ts,value
+                       FROM runtimeMetricsSamples
+                       WHERE ts >= $1
+                       ORDER BY ts`
+
+	queryDeleteSamples = `DELETE FROM runtimeMetricsSamples WHERE name=$1 AND type=$2 AND labels=$3;`
+
+	queryDeleteExpiredSamples = `DELETE FROM runtimeMetricsSamples WHERE ts < $1;`
 )
 
-type Storage struct {
-	db     *sql.DB
-	logger *logpack.LogPack
-	memory *memstore.Storage
-}
+// defaultMaxPending Предел очереди значений истории, ожидающих записи в базу данных
+const defaultMaxPending = 100000
+
+// defaultBatchSize Число строк в одном INSERT, ограничено числом параметров запроса PostgreSQL (65535)
+const defaultBatchSize = 500
+
+type (
+	OptionsStorage func(*Storage)
+
+	Storage struct {
+		db         *sql.DB
+		logger     *logpack.LogPack
+		retention  time.Duration
+		memory     *memstore.Storage
+		batchSize  int
+		mu         sync.Mutex                  // защищает dirty, pending и порядок обновления счетчиков в memory
+		dirty      map[string]metricPkg.Metric // серии, измененные после предыдущего Flush
+		pending    []sample                    // значения метрик, еще не записанные в таблицу истории
+		maxPending int                         // предел очереди pending, при переполнении отбрасываются старые значения
+		dropped    int                         // число значений, отброшенных после последнего успешного Flush
+	}
 
-func New(dsn string, logger *logpack.LogPack) (*Storage, error) {
+	sample struct {
+		metric metricPkg.Metric
+		point  storage.Point
+	}
+)
+
+func New(dsn string, logger *logpack.LogPack, opts ...OptionsStorage) (*Storage, error) {
 
 	driver, errConnect := sql.Open("postgres", dsn)
 	if errConnect != nil {
@@ -43,12 +93,26 @@ func New(dsn string, logger *logpack.LogPack) (*Storage, error) {
 		return nil, errConnect
 	}
 
+	return newStorage(driver, logger, opts...), nil
+}
+
+// newStorage Хранилище поверх открытого подключения: применение миграций и загрузка метрик
+func newStorage(driver *sql.DB, logger *logpack.LogPack, opts ...OptionsStorage) *Storage {
+
 	dbStore := &Storage{
-		db:     driver,
-		logger: logger,
-		memory: memstore.New(),
+		db:         driver,
+		logger:     logger,
+		batchSize:  defaultBatchSize,
+		maxPending: defaultMaxPending,
+		dirty:      make(map[string]metricPkg.Metric),
 	}
 
+	for _, opt := range opts {
+		opt(dbStore)
+	}
+
+	dbStore.memory = memstore.New(memstore.WithRetention(dbStore.retention))
+
 	if errMigrate := dbStore.applyMigrations(); errMigrate != nil {
 		logger.Err.Printf("could not apply migration: %v\n", errMigrate)
 
@@ -61,44 +125,212 @@ func New(dsn string, logger *logpack.LogPack) (*Storage, error) {
 		logger.Err.Printf("could not restore metrics from database: %v\n", errRestore)
 	}
 
-	return dbStore, nil
+	return dbStore
+}
+
+// WithRetention Окно хранения истории значений метрик
+func WithRetention(retention time.Duration) OptionsStorage {
+	return func(store *Storage) {
+		store.retention = retention
+	}
+}
+
+// WithBatchSize Число строк в одном многострочном INSERT при записи в базу данных
+func WithBatchSize(size int) OptionsStorage {
+	return func(store *Storage) {
+		store.batchSize = size
+	}
+}
+
+// WithMaxPending Предел числа значений истории, ожидающих записи в базу данных.
+// Пока запись в базу данных не удается, при переполнении отбрасываются самые старые значения.
+func WithMaxPending(size int) OptionsStorage {
+	return func(store *Storage) {
+		store.maxPending = size
+	}
 }
 
 func (store *Storage) Upsert(metric metricPkg.Metric) error {
 
-	return store.memory.Upsert(metric)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.memory.Upsert(metric); err != nil {
+		return err
+	}
+
+	store.markDirty(metric)
+	store.appendSample(metric)
+
+	return nil
+}
+
+// Add Атомарное прибавление Delta счетчика в базе данных.
+// Накопленное значение из базы данных сохраняется в памяти.
+// Если значение серии, заданное Upsert, еще не записано в базу данных, прибавление выполняется в памяти
+// и записывается при следующем Flush.
+// Гистограммы объединяются в памяти под блокировкой хранилища и записываются при следующем Flush.
+func (store *Storage) Add(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	if err := storage.CheckAccumulate(metric); err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	if metric.MType == metricPkg.HistogramType {
+		return store.addHistogram(metric)
+	}
+
+	labels, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to counter in database: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.dirty[seriesKey(metric)]; ok {
+		accum, errAdd := store.memory.Add(metric)
+		if errAdd != nil {
+			return metricPkg.Metric{}, errAdd
+		}
+
+		store.appendSample(accum)
+		return accum, nil
+	}
+
+	var accum int64
+	if err := store.db.QueryRow(queryAddCounter, metric.ID, metric.MType, labels, *metric.Delta).Scan(&accum); err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to counter in database: %w", err)
+	}
+
+	metric.Delta = &accum
+	if err := store.memory.Upsert(metric); err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	store.appendSample(metric)
+
+	return store.memory.Get(metric)
+}
+
+// addHistogram Объединение гистограммы с сохраненной в памяти, серия записывается в базу данных при Flush
+func (store *Storage) addHistogram(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	accum, err := store.memory.Add(metric)
+	if err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	store.markDirty(accum)
+	store.appendSample(accum)
+
+	return accum, nil
+}
+
+// appendSample Добавление последнего значения серии в очередь записи истории, вызывается под блокировкой
+func (store *Storage) appendSample(metric metricPkg.Metric) {
+
+	point, err := store.memory.LastPoint(metric)
+	if err != nil {
+		return
+	}
+
+	if store.maxPending > 0 && len(store.pending) >= store.maxPending {
+		n := len(store.pending) - store.maxPending + 1
+
+		if store.dropped == 0 {
+			store.logger.Err.Printf("history queue is full (%d samples), dropping oldest samples until the next successful flush\n", store.maxPending)
+		}
+
+		copy(store.pending, store.pending[n:])
+		store.pending = store.pending[:len(store.pending)-n]
+		store.dropped += n
+	}
+
+	store.pending = append(store.pending, sample{metric: metric, point: point})
 }
 
 func (store *Storage) UpsertBatch(metrics []metricPkg.Metric) error {
 
-	return store.memory.UpsertBatch(metrics)
+	for _, m := range metrics {
+		if err := store.Upsert(m); err != nil {
+			return fmt.Errorf("can not upsert metrics: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func (store Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
+func (store *Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
 
 	return store.memory.Get(metric)
 }
 
-func (store Storage) GetBatch() ([]metricPkg.Metric, error) {
+func (store *Storage) GetBatch() ([]metricPkg.Metric, error) {
 
 	return store.memory.GetBatch()
 }
 
+// GetRange Получение значений серии метрики в интервале времени [start, end]
+func (store *Storage) GetRange(metric metricPkg.Metric, start, end time.Time) ([]storage.Point, error) {
+
+	return store.memory.GetRange(metric, start, end)
+}
+
 func (store *Storage) Delete(metric metricPkg.Metric) error {
 
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
 	if err := store.memory.Delete(metric); err != nil {
 		return err
 	}
 
-	query := `DELETE FROM runtimeMetrics WHERE name=$1 AND type=$2;`
-	if _, err := store.db.Exec(query, metric.ID, metric.MType); err != nil {
+	key := seriesKey(metric)
+	delete(store.dirty, key)
+
+	pending := store.pending[:0]
+	for _, s := range store.pending {
+		if seriesKey(s.metric) != key {
+			pending = append(pending, s)
+		}
+	}
+	store.pending = pending
+
+	labels, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return fmt.Errorf("could not delete metric from database: %w", err)
+	}
+
+	if _, err := store.db.Exec(queryDeleteMetric, metric.ID, metric.MType, labels); err != nil {
 		return fmt.Errorf("could not delete metric from database: %w", err)
 	}
 
+	if _, err := store.db.Exec(queryDeleteSamples, metric.ID, metric.MType, labels); err != nil {
+		return fmt.Errorf("could not delete metric history from database: %w", err)
+	}
+
 	return nil
 }
 
-func (store Storage) Flush() error {
+// Flush Запись в базу данных серий, измененных после предыдущей записи, и новых значений истории.
+// Если изменений нет, транзакция не открывается.
+func (store *Storage) Flush() error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// История в памяти ограничена тем же окном хранения, что и выборки в базе
+	if err := store.memory.Flush(); err != nil {
+		return err
+	}
+
+	if len(store.dirty) == 0 && len(store.pending) == 0 {
+		return nil
+	}
 
 	tx, err := store.db.Begin()
 	if err != nil {
@@ -112,34 +344,55 @@ func (store Storage) Flush() error {
 		}
 	}()
 
-	stmtGauge, err := tx.Prepare(queryChangeGauge)
-	if err != nil {
-		return fmt.Errorf("error prepare statement 'gauge' : %w", err)
+	if errMetrics := store.flushMetrics(tx); errMetrics != nil {
+		return errMetrics
 	}
-	defer func() {
-		if errClose := stmtGauge.Close(); errClose != nil {
-			store.logger.Err.Printf("error close gauge statement: %v\n", errClose)
-		}
-	}()
 
-	stmtCounter, err := tx.Prepare(queryChangeCounter)
-	if err != nil {
-		return fmt.Errorf("error prepare statement 'counter': %w", err)
+	if errSamples := store.flushSamples(tx); errSamples != nil {
+		return errSamples
 	}
-	defer func() {
-		if errClose := stmtCounter.Close(); errClose != nil {
-			store.logger.Err.Printf("error close counter statement: %v\n", errClose)
-		}
-	}()
 
-	metrics, err := store.memory.GetBatch()
-	if err != nil {
-		return fmt.Errorf("could not flush metrics to database: %w", err)
+	if errCommit := tx.Commit(); errCommit != nil {
+		errCommit = fmt.Errorf("could not commit flush transaction: %w", errCommit)
+		store.logger.Err.Println(errCommit)
+		return errCommit
+	}
+
+	store.dirty = make(map[string]metricPkg.Metric)
+	store.pending = store.pending[:0]
+
+	if store.dropped > 0 {
+		store.logger.Err.Printf("%d history samples were dropped while the database was unavailable\n", store.dropped)
+		store.dropped = 0
 	}
 
-	for _, metric := range metrics {
+	return nil
+}
+
+// flushMetrics Запись текущих значений измененных серий многострочными INSERT ... ON CONFLICT
+func (store *Storage) flushMetrics(tx *sql.Tx) error {
+
+	rows := make([][]interface{}, 0, len(store.dirty))
+
+	for _, key := range sortedKeys(store.dirty) {
+
+		metric, errGet := store.memory.Get(store.dirty[key])
+		if errGet != nil {
+			// Серия удалена после изменения
+			continue
+		}
+
+		labels, errLabels := encodeLabels(metric.Labels)
+		if errLabels != nil {
+			store.logger.Err.Printf("could not flush metric with invalid labels: %s. %v\n", metric.ShotString(), errLabels)
+			continue
+		}
 
-		var errExec error
+		var (
+			delta     sql.NullInt64
+			value     sql.NullFloat64
+			histogram sql.NullString
+		)
 
 		switch metric.MType {
 		case metricPkg.GaugeType:
@@ -148,7 +401,7 @@ func (store Storage) Flush() error {
 				continue
 			}
 
-			_, errExec = stmtGauge.Exec(metric.ID, metric.MType, *metric.Value)
+			value = sql.NullFloat64{Float64: *metric.Value, Valid: true}
 
 		case metricPkg.CounterType:
 			if metric.Delta == nil {
@@ -156,27 +409,157 @@ func (store Storage) Flush() error {
 				continue
 			}
 
-			_, errExec = stmtCounter.Exec(metric.ID, metric.MType, *metric.Delta)
+			delta = sql.NullInt64{Int64: *metric.Delta, Valid: true}
+
+		case metricPkg.HistogramType:
+			if metric.Histogram == nil {
+				store.logger.Err.Printf("could not flush metric without histogram: %s\n", metric.ShotString())
+				continue
+			}
+
+			data, errHistogram := json.Marshal(metric.Histogram)
+			if errHistogram != nil {
+				store.logger.Err.Printf("could not flush metric with invalid histogram: %s. %v\n", metric.ShotString(), errHistogram)
+				continue
+			}
+
+			histogram = sql.NullString{String: string(data), Valid: true}
 
 		default:
 			store.logger.Err.Printf("could not flush metric with unknown type: %s\n", metric.ShotString())
+			continue
 		}
 
-		if errExec != nil {
-			errExec = fmt.Errorf("could not flush metric: %w", errExec)
-			return errExec
+		rows = append(rows, []interface{}{metric.ID, metric.MType, labels, delta, value, histogram})
+	}
+
+	if err := execBatches(tx, queryUpsertMetrics, rows, store.batchSize); err != nil {
+		return fmt.Errorf("could not flush metric: %w", err)
+	}
+
+	return nil
+}
+
+// flushSamples Запись новых значений метрик в таблицу истории и удаление устаревших значений
+func (store *Storage) flushSamples(tx *sql.Tx) error {
+
+	// В одном INSERT ... ON CONFLICT строка не может обновляться дважды,
+	// поэтому из значений серии с одинаковым временем остается последнее
+	index := make(map[string]int, len(store.pending))
+	rows := make([][]interface{}, 0, len(store.pending))
+
+	for _, s := range store.pending {
+
+		labels, errLabels := encodeLabels(s.metric.Labels)
+		if errLabels != nil {
+			store.logger.Err.Printf("could not flush sample with invalid labels: %s. %v\n", s.metric.ShotString(), errLabels)
+			continue
 		}
+
+		row := []interface{}{s.metric.ID, s.metric.MType, labels, s.point.Timestamp, s.point.Value}
+
+		key := seriesKey(s.metric) + "@" + s.point.Timestamp.String()
+		if i, ok := index[key]; ok {
+			rows[i] = row
+			continue
+		}
+
+		index[key] = len(rows)
+		rows = append(rows, row)
 	}
 
-	if errCommit := tx.Commit(); errCommit != nil {
-		errCommit = fmt.Errorf("could not commit flush transaction: %w", errCommit)
-		store.logger.Err.Println(errCommit)
-		return errCommit
+	if err := execBatches(tx, queryInsertSamples, rows, store.batchSize); err != nil {
+		return fmt.Errorf("could not flush sample: %w", err)
+	}
+
+	if store.retention > 0 {
+		if _, errExec := tx.Exec(queryDeleteExpiredSamples, time.Now().Add(-store.retention)); errExec != nil {
+			return fmt.Errorf("could not delete expired samples: %w", errExec)
+		}
 	}
 
 	return nil
 }
 
+// execBatches Выполнение запроса query для строк rows пачками по batchSize строк.
+// query содержит %s на месте списка VALUES, все строки имеют одинаковое число столбцов.
+func execBatches(tx *sql.Tx, query string, rows [][]interface{}, batchSize int) error {
+
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for start := 0; start < len(rows); start += batchSize {
+
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values, args := placeholders(rows[start:end])
+		if _, err := tx.Exec(fmt.Sprintf(query, values), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeholders Список VALUES вида ($1,$2),($3,$4) и аргументы запроса для строк rows
+func placeholders(rows [][]interface{}) (string, []interface{}) {
+
+	var builder strings.Builder
+	args := make([]interface{}, 0, len(rows)*len(rows[0]))
+
+	for i, row := range rows {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+
+		builder.WriteByte('(')
+		for j, arg := range row {
+			if j > 0 {
+				builder.WriteByte(',')
+			}
+
+			args = append(args, arg)
+			builder.WriteByte('$')
+			builder.WriteString(strconv.Itoa(len(args)))
+		}
+		builder.WriteByte(')')
+	}
+
+	return builder.String(), args
+}
+
+// markDirty Отметка серии для записи при следующем Flush, вызывается под блокировкой
+func (store *Storage) markDirty(metric metricPkg.Metric) {
+
+	labels := make(map[string]string, len(metric.Labels))
+	for name, value := range metric.Labels {
+		labels[name] = value
+	}
+
+	store.dirty[seriesKey(metric)] = metricPkg.Metric{ID: metric.ID, MType: metric.MType, Labels: labels}
+}
+
+// seriesKey Ключ серии метрики
+func seriesKey(metric metricPkg.Metric) string {
+	return metric.MType + ":" + metric.SeriesKey()
+}
+
+func sortedKeys(metrics map[string]metricPkg.Metric) []string {
+
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
 func (store *Storage) Restore() error {
 
 	rows, errQuery := store.db.Query(queryGetMetrics)
@@ -190,21 +573,31 @@ func (store *Storage) Restore() error {
 		}
 	}()
 
+	metrics := make([]metricPkg.Metric, 0)
+
 	for rows.Next() {
 
 		var (
-			id    sql.NullString
-			mtype sql.NullString
-			delta sql.NullInt64
-			value sql.NullFloat64
+			id        sql.NullString
+			mtype     sql.NullString
+			labels    sql.NullString
+			delta     sql.NullInt64
+			value     sql.NullFloat64
+			histogram sql.NullString
 		)
 
-		if err := rows.Scan(&id, &mtype, &delta, &value); err != nil {
+		if err := rows.Scan(&id, &mtype, &labels, &delta, &value, &histogram); err != nil {
 			store.logger.Err.Printf("error scan: %v\n", err)
 			continue
 		}
 
-		metric, err := metricPkg.CreateMetric(mtype.String, id.String)
+		labelsMap, errLabels := decodeLabels(labels.String)
+		if errLabels != nil {
+			store.logger.Err.Printf("could not restore metric labels: [type: %s], [id: %s]. %v\n", mtype.String, id.String, errLabels)
+			continue
+		}
+
+		metric, err := metricPkg.CreateMetric(mtype.String, id.String, metricPkg.WithLabels(labelsMap))
 		if err != nil {
 			store.logger.Err.Printf("could not restore metric: [type: %s], [id: %s]\n", mtype.String, id.String)
 			continue
@@ -219,11 +612,19 @@ func (store *Storage) Restore() error {
 			if delta.Valid {
 				metric.Delta = &delta.Int64
 			}
+		case metricPkg.HistogramType:
+			if histogram.Valid {
+				h := &metricPkg.Histogram{}
+				if errHistogram := json.Unmarshal([]byte(histogram.String), h); errHistogram != nil {
+					store.logger.Err.Printf("could not restore metric histogram: [id: %s]. %v\n", id.String, errHistogram)
+					continue
+				}
+
+				metric.Histogram = h
+			}
 		}
 
-		if errMem := store.memory.Upsert(metric); errMem != nil {
-			store.logger.Err.Printf("could not restore metric: %s. %v\n", metric.ShotString(), errMem)
-		}
+		metrics = append(metrics, metric)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -231,6 +632,84 @@ func (store *Storage) Restore() error {
 		return err
 	}
 
+	// Текущие значения загружаются без точек истории, история загружается из таблицы значений
+	store.memory.Load(metrics)
+
+	return store.restoreSamples()
+}
+
+// restoreSamples Загрузка истории значений метрик в пределах окна хранения
+func (store *Storage) restoreSamples() error {
+
+	var from time.Time
+	if store.retention > 0 {
+		from = time.Now().Add(-store.retention)
+	}
+
+	rows, errQuery := store.db.Query(queryGetSamples, from)
+	if errQuery != nil {
+		return fmt.Errorf("could not load metrics history from database: %w", errQuery)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			store.logger.Err.Printf("could not close rows: %v\n", err)
+		}
+	}()
+
+	series := make(map[string]*storage.Series)
+	order := make([]string, 0)
+
+	for rows.Next() {
+
+		var (
+			id     string
+			mtype  string
+			labels string
+			point  storage.Point
+		)
+
+		if err := rows.Scan(&id, &mtype, &labels, &point.Timestamp, &point.Value); err != nil {
+			store.logger.Err.Printf("error scan: %v\n", err)
+			continue
+		}
+
+		key := mtype + ":" + id + ":" + labels
+
+		s, ok := series[key]
+		if !ok {
+			labelsMap, errLabels := decodeLabels(labels)
+			if errLabels != nil {
+				store.logger.Err.Printf("could not restore sample labels: [type: %s], [id: %s]. %v\n", mtype, id, errLabels)
+				continue
+			}
+
+			metric, err := metricPkg.CreateMetric(mtype, id, metricPkg.WithLabels(labelsMap))
+			if err != nil {
+				store.logger.Err.Printf("could not restore sample: [type: %s], [id: %s]\n", mtype, id)
+				continue
+			}
+
+			s = &storage.Series{Metric: metric}
+			series[key] = s
+			order = append(order, key)
+		}
+
+		s.Points = append(s.Points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		store.logger.Err.Printf("could not restore samples: %v\n", err)
+		return err
+	}
+
+	history := make([]storage.Series, 0, len(order))
+	for _, key := range order {
+		history = append(history, *series[key])
+	}
+
+	store.memory.RestoreHistory(history)
+
 	return nil
 }
 
@@ -239,7 +718,7 @@ func (store *Storage) Close() error {
 
 }
 
-func (store Storage) Health() bool {
+func (store *Storage) Health() bool {
 
 	if store.db == nil {
 		store.logger.Err.Println("database driver is nil")
@@ -255,18 +734,47 @@ func (store Storage) Health() bool {
 	return true
 }
 
-func (store Storage) applyMigrations() error {
-
-	query := `CREATE TABLE IF NOT EXISTS runtimeMetrics (
-              id     SERIAL,
-		      name   CHARACTER VARYING(50) PRIMARY KEY,
-		      type   CHARACTER VARYING(50),
-		      delta  BIGINT,
-		      value  DOUBLE PRECISION );`
+// applyMigrations Применение миграций схемы из каталога migrations
+func (store *Storage) applyMigrations() error {
 
-	if _, err := store.db.Exec(query); err != nil {
+	applied, err := migrate(context.Background(), store.db, migrationFiles, store.logger)
+	if err != nil {
 		return err
 	}
 
+	if applied > 0 {
+		store.logger.Info.Printf("Applied migrations: %d\n", applied)
+	}
+
 	return nil
 }
+
+// encodeLabels Преобразование меток в JSON с ключами, отсортированными по имени
+func encodeLabels(labels map[string]string) (string, error) {
+
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// decodeLabels Преобразование меток из JSON
+func decodeLabels(data string) (map[string]string, error) {
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(data), &labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,158 @@
+package dbstore
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/pkg/logpack"
+	metricPkg "metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_FlushDirty(t *testing.T) {
+
+	fake, db := newFakeDB(0)
+	store := newStorage(db, logpack.NewLogger(), WithBatchSize(2))
+
+	for i := 0; i < 5; i++ {
+		gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "metric_"+strconv.Itoa(i), metricPkg.WithValueInt(int64(i)))
+		require.NoError(t, store.Upsert(gauge))
+	}
+
+	fake.reset()
+	require.NoError(t, store.Flush())
+
+	// 5 серий записываются тремя запросами по 2 строки
+	assert.Equal(t, 5, fake.metricRows)
+	assert.Equal(t, 5, fake.sampleRows)
+	assert.Equal(t, 3+3, fake.statements)
+
+	// Без изменений запросы не выполняются
+	fake.reset()
+	require.NoError(t, store.Flush())
+	assert.Equal(t, 0, fake.statements)
+
+	// Записывается только измененная серия, удаленная серия не записывается
+	changed, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "metric_1", metricPkg.WithValueInt(10))
+	require.NoError(t, store.Upsert(changed))
+
+	removed, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "metric_2", metricPkg.WithValueInt(10))
+	require.NoError(t, store.Upsert(removed))
+	require.NoError(t, store.Delete(removed))
+
+	fake.reset()
+	require.NoError(t, store.Flush())
+	assert.Equal(t, 1, fake.metricRows)
+	assert.Equal(t, 1, fake.sampleRows)
+}
+
+// TestStorage_RestoreWithoutHistory Текущие значения восстанавливаются без точек истории со временем восстановления
+func TestStorage_RestoreWithoutHistory(t *testing.T) {
+
+	fake, db := newFakeDB(0)
+	store := newStorage(db, logpack.NewLogger(), WithRetention(time.Hour))
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueFloat(1.5))
+	require.NoError(t, store.Upsert(gauge))
+	require.NoError(t, store.Flush())
+
+	// История серии удалена, например, по окончании окна хранения
+	fake.mu.Lock()
+	fake.samples = make(map[string][]driver.Value)
+	fake.mu.Unlock()
+
+	restored := newStorage(db, logpack.NewLogger(), WithRetention(time.Hour))
+
+	got, err := restored.Get(gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	points, err := restored.GetRange(gauge, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, points)
+}
+
+// TestStorage_MaxPending Пока запись в базу данных не удается, очередь истории ограничена
+func TestStorage_MaxPending(t *testing.T) {
+
+	_, db := newFakeDB(0)
+	store := newStorage(db, logpack.NewLogger(), WithRetention(time.Hour), WithMaxPending(3))
+
+	require.NoError(t, db.Close())
+
+	for i := 0; i < 5; i++ {
+		gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "Alloc", metricPkg.WithValueInt(int64(i)))
+		require.NoError(t, store.Upsert(gauge))
+		assert.Error(t, store.Flush())
+	}
+
+	require.Len(t, store.pending, 3)
+	assert.Equal(t, 2, store.dropped)
+
+	// Отбрасываются самые старые значения
+	assert.Equal(t, 2.0, store.pending[0].point.Value)
+	assert.Equal(t, 4.0, store.pending[2].point.Value)
+}
+
+func TestPlaceholders(t *testing.T) {
+
+	values, args := placeholders([][]interface{}{{"a", 1}, {"b", 2}})
+
+	assert.Equal(t, "($1,$2),($3,$4)", values)
+	assert.Equal(t, []interface{}{"a", 1, "b", 2}, args)
+}
+
+const (
+	benchSeries  = 2000
+	benchLatency = 100 * time.Microsecond
+)
+
+// benchFlush Запись benchSeries серий, из которых после каждой записи изменяется changed серий
+func benchFlush(b *testing.B, batchSize, changed int) {
+
+	_, db := newFakeDB(benchLatency)
+	store := newStorage(db, logpack.NewLogger(), WithBatchSize(batchSize))
+
+	metrics := make([]metricPkg.Metric, 0, benchSeries)
+	for i := 0; i < benchSeries; i++ {
+		m, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "metric_"+strconv.Itoa(i), metricPkg.WithValueInt(int64(i)))
+		metrics = append(metrics, m)
+	}
+
+	if err := store.UpsertBatch(metrics); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if err := store.UpsertBatch(metrics[:changed]); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if err := store.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFlush_AllRowByRow Запись всех серий по одной строке в запросе, как до отслеживания изменений
+func BenchmarkFlush_AllRowByRow(b *testing.B) {
+	benchFlush(b, 1, benchSeries)
+}
+
+// BenchmarkFlush_AllMultiRow Запись всех серий многострочными INSERT
+func BenchmarkFlush_AllMultiRow(b *testing.B) {
+	benchFlush(b, defaultBatchSize, benchSeries)
+}
+
+// BenchmarkFlush_DirtyMultiRow Запись только 1% измененных серий
+func BenchmarkFlush_DirtyMultiRow(b *testing.B) {
+	benchFlush(b, defaultBatchSize, benchSeries/100)
+}
@@ -0,0 +1,24 @@
+package filestorage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/internal/storage/storagetest"
+	"metrics-and-alerting/pkg/logpack"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+
+	logger := logpack.NewLogger()
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		fileName := filepath.Join(t.TempDir(), "metrics.json")
+
+		return func(t *testing.T) storage.Repository {
+			return New(fileName, logger, WithRetention(time.Hour))
+		}
+	}, storagetest.Options{Persistent: true})
+}
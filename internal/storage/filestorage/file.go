@@ -5,53 +5,193 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/internal/storage/memstore"
 	"metrics-and-alerting/pkg/errs"
 	"metrics-and-alerting/pkg/logpack"
 	metricPkg "metrics-and-alerting/pkg/metric"
 )
 
-type Storage struct {
-	fileName string
-	logger   *logpack.LogPack
-	memory   *memstore.Storage
-}
+type (
+	OptionsStorage func(*Storage)
+
+	// Storage Хранение метрик в файле.
+	// Файл снимка содержит JSON массив текущих значений метрик, за которым следуют JSON массив истории серий
+	// и номер снимка. Изменения между снимками записываются в журнал <файл>.wal до подтверждения операции,
+	// после записи снимка журнал очищается.
+	Storage struct {
+		fileName  string
+		logger    *logpack.LogPack
+		retention time.Duration
+		sync      bool
+		walLimit  int64 // размер журнала, начиная с которого Flush записывает снимок, 0 - при каждом Flush
+		memory    *memstore.Storage
+		mu        sync.Mutex // упорядочивает изменения в памяти и записи журнала
+		wal       *wal
+		seq       uint64 // номер последнего записанного или восстановленного снимка
+		now       func() time.Time
+	}
+
+	// snapshotInfo Завершающая часть файла снимка, в файлах предыдущих версий отсутствует
+	snapshotInfo struct {
+		Seq uint64 `json:"seq"`
+	}
+)
+
+// DefaultWALLimit Размер журнала для WithWALLimit, если снимок не записывается по интервалу
+const DefaultWALLimit = 64 << 20
 
-func New(fileName string, logger *logpack.LogPack) *Storage {
+func New(fileName string, logger *logpack.LogPack, opts ...OptionsStorage) *Storage {
 
 	store := &Storage{
 		fileName: fileName,
 		logger:   logger,
-		memory:   memstore.New(),
+		now:      time.Now,
 	}
 
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	store.memory = memstore.New(memstore.WithRetention(store.retention))
+
 	return store
 }
 
-func (store Storage) open(flag int) (*os.File, error) {
+// WithRetention Окно хранения истории значений метрик
+func WithRetention(retention time.Duration) OptionsStorage {
+	return func(store *Storage) {
+		store.retention = retention
+	}
+}
+
+// WithSync Вызов fsync журнала после каждой записи, до подтверждения операции
+func WithSync(sync bool) OptionsStorage {
+	return func(store *Storage) {
+		store.sync = sync
+	}
+}
+
+// WithWALLimit Запись снимка при Flush, только если журнал достиг size байт.
+// Используется, если Flush вызывается после каждого изменения: операция подтверждается записью журнала,
+// и запись снимка со всей историей на каждый запрос не нужна. Снимок также записывается при Close.
+func WithWALLimit(size int64) OptionsStorage {
+	return func(store *Storage) {
+		store.walLimit = size
+	}
+}
+
+func (store *Storage) walName() string {
+	return store.fileName + ".wal"
+}
+
+// Flush Запись снимка метрик во временный файл с атомарной заменой файла снимка и очистка журнала.
+// С WithWALLimit снимок записывается, только если журнал достиг заданного размера.
+func (store *Storage) Flush() error {
+
 	if len(store.fileName) < 1 {
-		return nil, errs.ErrInvalidFilePath
+		return errs.ErrInvalidFilePath
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.memory.Flush(); err != nil {
+		return err
+	}
+
+	if store.walLimit > 0 && (store.wal == nil || store.wal.size < store.walLimit) {
+		return nil
+	}
+
+	return store.snapshot()
+}
+
+// snapshot Запись снимка со следующим номером и очистка журнала, вызывается под блокировкой
+func (store *Storage) snapshot() error {
+
+	if err := store.writeSnapshot(store.seq + 1); err != nil {
+		return err
+	}
+	store.seq++
+
+	if store.wal == nil {
+		return nil
 	}
 
-	return os.OpenFile(store.fileName, flag, 0777)
+	if err := store.wal.reset(store.seq); err != nil {
+		// Записи в журнал, начатый до снимка, не будут восстановлены, поэтому журнал открывается заново
+		// при следующем изменении
+		if errClose := store.wal.close(); errClose != nil {
+			store.logger.Err.Printf("Could not close wal: %v\n", errClose)
+		}
+		store.wal = nil
+
+		return fmt.Errorf("could not reset wal after flush: %w", err)
+	}
+
+	return nil
 }
 
-func (store Storage) Flush() error {
+func (store *Storage) writeSnapshot(seq uint64) error {
+
+	dir := filepath.Dir(store.fileName)
 
-	file, errFile := store.open(os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
+	file, errFile := os.CreateTemp(dir, filepath.Base(store.fileName)+".*.tmp")
 	if errFile != nil {
-		return fmt.Errorf("error open fileStorage fo rewrite: %w", errFile)
+		return fmt.Errorf("error create temp file for snapshot: %w", errFile)
 	}
 
+	tmpName := file.Name()
 	defer func() {
-		if err := file.Close(); err != nil {
-			store.logger.Err.Printf("Could not close file after flush: %v\n", err)
+		// После успешной замены временного файла уже нет
+		if err := os.Remove(tmpName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			store.logger.Err.Printf("Could not remove temp snapshot file: %v\n", err)
 		}
 	}()
 
-	writer := bufio.NewWriter(file)
+	if err := store.encodeSnapshot(file, seq); err != nil {
+		if errClose := file.Close(); errClose != nil {
+			store.logger.Err.Printf("Could not close temp snapshot file: %v\n", errClose)
+		}
+
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not sync snapshot: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not close snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmpName, store.fileName); err != nil {
+		return fmt.Errorf("could not replace snapshot: %w", err)
+	}
+
+	// Сохранение записи о переименовании в каталоге
+	if dirFile, err := os.Open(dir); err == nil {
+		if errSync := dirFile.Sync(); errSync != nil {
+			store.logger.Err.Printf("Could not sync snapshot directory: %v\n", errSync)
+		}
+
+		_ = dirFile.Close()
+	}
+
+	return nil
+}
+
+func (store *Storage) encodeSnapshot(w io.Writer, seq uint64) error {
+
+	writer := bufio.NewWriter(w)
 	metrics, errMemory := store.memory.GetBatch()
 	if errMemory != nil {
 		return fmt.Errorf("could not save metrics. Memory storage returned error: %w", errMemory)
@@ -66,13 +206,91 @@ func (store Storage) Flush() error {
 		return fmt.Errorf("could not save metrics. Can not write in file: %w", errWrite)
 	}
 
+	history, errEncode := json.Marshal(store.memory.History())
+	if errEncode != nil {
+		return fmt.Errorf("could not save metrics history. Marshal history retured error: %w", errEncode)
+	}
+
+	if _, errWrite := writer.WriteString("\n"); errWrite != nil {
+		return fmt.Errorf("could not save metrics history. Can not write in file: %w", errWrite)
+	}
+
+	if _, errWrite := writer.Write(history); errWrite != nil {
+		return fmt.Errorf("could not save metrics history. Can not write in file: %w", errWrite)
+	}
+
+	info, errEncode := json.Marshal(snapshotInfo{Seq: seq})
+	if errEncode != nil {
+		return fmt.Errorf("could not save snapshot number: %w", errEncode)
+	}
+
+	if _, errWrite := writer.WriteString("\n" + string(info)); errWrite != nil {
+		return fmt.Errorf("could not save snapshot number. Can not write in file: %w", errWrite)
+	}
+
 	return writer.Flush()
 }
 
+// Restore Загрузка снимка и применение записей журнала, сделанных после снимка.
+// Неполная последняя запись журнала (прерванная при сбое) отбрасывается.
 func (store *Storage) Restore() error {
 
-	file, err := store.open(os.O_RDONLY)
+	if len(store.fileName) < 1 {
+		return errs.ErrInvalidFilePath
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.restoreSnapshot(); err != nil {
+		return err
+	}
+
+	offset, errReplay := replayWAL(store.walName(), store.seq, store.apply)
+	switch {
+	case errors.Is(errReplay, errStaleWAL):
+		// Сбой между заменой снимка и очисткой журнала: записи журнала уже содержатся в снимке
+		store.logger.Info.Printf("Discard wal written before snapshot %d\n", store.seq)
+
+	case errors.Is(errReplay, errTornRecord):
+		store.logger.Err.Printf("Discard torn wal tail after offset %d\n", offset)
+
+		if err := os.Truncate(store.walName(), offset); err != nil {
+			return fmt.Errorf("could not truncate torn wal: %w", err)
+		}
+
+	case errReplay != nil:
+		return fmt.Errorf("could not restore metrics from wal: %w", errReplay)
+	}
+
+	if store.wal != nil {
+		if err := store.wal.close(); err != nil {
+			store.logger.Err.Printf("Could not close wal: %v\n", err)
+		}
+	}
+
+	var err error
+	if store.wal, err = openWAL(store.walName(), store.sync); err != nil {
+		return err
+	}
+
+	// Пустой или устаревший журнал начинается заново с номером восстановленного снимка
+	if offset == 0 {
+		return store.wal.reset(store.seq)
+	}
+
+	return nil
+}
+
+func (store *Storage) restoreSnapshot() error {
+
+	file, err := os.Open(store.fileName)
 	if err != nil {
+		// Снимок еще не записывался, все изменения находятся в журнале
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
 		return fmt.Errorf("could not restore metrics. Can not open file for read: %w", err)
 	}
 
@@ -82,53 +300,192 @@ func (store *Storage) Restore() error {
 		}
 	}()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		data := scanner.Bytes()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	var metrics []metricPkg.Metric
+
+	if err := decoder.Decode(&metrics); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return fmt.Errorf("could not restore metrics. Can not Unmarshal from file: %w", err)
+	}
+
+	store.memory.Load(metrics)
 
-		var metrics []metricPkg.Metric
+	// История серий отсутствует в файлах, записанных предыдущими версиями
+	var history []storage.Series
 
-		if err := json.Unmarshal(data, &metrics); err != nil {
-			return fmt.Errorf("could not restore metrics. Can not Unmarshal from file: %w", err)
+	if err := decoder.Decode(&history); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
 		}
 
-		if err := store.memory.UpsertBatch(metrics); err != nil {
-			return fmt.Errorf("could not restore metrics. Can not write in memory storage: %w", err)
+		return fmt.Errorf("could not restore metrics history. Can not Unmarshal from file: %w", err)
+	}
+
+	store.memory.RestoreHistory(history)
+
+	var info snapshotInfo
+
+	if err := decoder.Decode(&info); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
 		}
+
+		return fmt.Errorf("could not restore snapshot number. Can not Unmarshal from file: %w", err)
 	}
 
+	store.seq = info.Seq
+
 	return nil
 }
 
+// apply Применение записи журнала к метрикам в памяти
+func (store *Storage) apply(record walRecord) error {
+
+	switch record.Op {
+	case opUpsert:
+		if record.Timestamp.IsZero() {
+			return store.memory.Upsert(record.Metric)
+		}
+
+		return store.memory.UpsertAt(record.Metric, record.Timestamp)
+
+	case opDelete:
+		if err := store.memory.Delete(record.Metric); err != nil && !errors.Is(err, errs.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown wal operation: %s", record.Op)
+}
+
+// log Запись операции в журнал, вызывается под блокировкой.
+// Если журнал еще не открыт (Restore не вызывался), прежнее содержимое журнала отбрасывается.
+func (store *Storage) log(op string, metric metricPkg.Metric, ts time.Time) error {
+
+	if len(store.fileName) < 1 {
+		return errs.ErrInvalidFilePath
+	}
+
+	if store.wal == nil {
+		w, err := openWAL(store.walName(), store.sync)
+		if err != nil {
+			return err
+		}
+
+		if err := w.reset(store.seq); err != nil {
+			_ = w.close()
+			return err
+		}
+
+		store.wal = w
+	}
+
+	return store.wal.append(walRecord{Op: op, Metric: metric, Timestamp: ts})
+}
+
+// Upsert Обновление метрики. Запись журнала сохраняется до изменения метрики в памяти.
 func (store *Storage) Upsert(metric metricPkg.Metric) error {
 
-	if err := store.memory.Upsert(metric); err != nil {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := store.upsert(metric); err != nil {
 		return fmt.Errorf("could not upsert metric: %w", err)
 	}
 
 	return nil
 }
 
+// UpsertBatch Обновление набора метрик.
+// Метрики записываются по одной, при ошибке журнала предыдущие метрики набора остаются сохраненными.
 func (store *Storage) UpsertBatch(metrics []metricPkg.Metric) error {
 
-	if err := store.memory.UpsertBatch(metrics); err != nil {
-		return fmt.Errorf("error update batch metrics in file storage: %w", err)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := store.upsert(m); err != nil {
+			return fmt.Errorf("error update batch metrics in file storage: %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (store Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
+// Add Прибавление Delta счетчика или наблюдений гистограммы к сохраненному значению.
+// В журнал записывается накопленное значение, поэтому повторное применение записи не меняет результат.
+func (store *Storage) Add(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	if err := storage.CheckAccumulate(metric); err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to metric: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Метрики в памяти изменяются только под store.mu, поэтому сохраненное значение не изменится до записи
+	var known *metricPkg.Metric
+	if m, err := store.memory.Get(metric); err == nil {
+		known = &m
+	}
+
+	accum, err := storage.Accumulate(known, metric)
+	if err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to metric: %w", err)
+	}
+
+	if err := store.upsert(accum); err != nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not add to metric: %w", err)
+	}
+
+	return store.memory.Get(accum)
+}
+
+// upsert Запись обновления в журнал и применение его в памяти, вызывается под блокировкой
+func (store *Storage) upsert(metric metricPkg.Metric) error {
+
+	ts := store.now()
+
+	if err := store.log(opUpsert, metric, ts); err != nil {
+		return err
+	}
+
+	return store.memory.UpsertAt(metric, ts)
+}
+
+func (store *Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
 	return store.memory.Get(metric)
 }
 
-func (store Storage) GetBatch() ([]metricPkg.Metric, error) {
+func (store *Storage) GetBatch() ([]metricPkg.Metric, error) {
 	return store.memory.GetBatch()
 }
 
+// GetRange Получение значений серии метрики в интервале времени [start, end]
+func (store *Storage) GetRange(metric metricPkg.Metric, start, end time.Time) ([]storage.Point, error) {
+	return store.memory.GetRange(metric, start, end)
+}
+
 // Delete - Удаление метрики
 func (store *Storage) Delete(metric metricPkg.Metric) error {
 
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := store.memory.Get(metric); err != nil {
+		return fmt.Errorf("could not delete metric: %w", err)
+	}
+
+	if err := store.log(opDelete, metric, time.Time{}); err != nil {
+		return fmt.Errorf("could not delete metric: %w", err)
+	}
+
 	if err := store.memory.Delete(metric); err != nil {
 		return fmt.Errorf("could not delete metric: %w", err)
 	}
@@ -137,10 +494,37 @@ func (store *Storage) Delete(metric metricPkg.Metric) error {
 }
 
 func (store *Storage) Health() bool {
-	_, err := os.Stat(store.fileName)
-	return !errors.Is(err, os.ErrNotExist)
+
+	for _, name := range []string{store.fileName, store.walName()} {
+		if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+			return true
+		}
+	}
+
+	return false
 }
 
+// Close Запись снимка, если хранилище изменялось или восстанавливалось, и закрытие журнала
 func (store *Storage) Close() error {
-	return nil
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.wal == nil {
+		return nil
+	}
+
+	errSnapshot := store.snapshot()
+	if store.wal == nil {
+		return errSnapshot
+	}
+
+	err := store.wal.close()
+	store.wal = nil
+
+	if errSnapshot != nil {
+		return errSnapshot
+	}
+
+	return err
 }
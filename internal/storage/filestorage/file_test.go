@@ -0,0 +1,259 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/pkg/errs"
+	"metrics-and-alerting/pkg/logpack"
+	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_RestoreWAL(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	logger := logpack.NewLogger()
+
+	store := New(fileName, logger, WithSync(true))
+	require.NoError(t, store.Restore())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1.5))
+	require.NoError(t, store.Upsert(gauge))
+
+	// Снимок содержит gauge, дальнейшие изменения находятся только в журнале
+	require.NoError(t, store.Flush())
+
+	counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(2))
+	_, err := store.Add(counter)
+	require.NoError(t, err)
+	_, err = store.Add(counter)
+	require.NoError(t, err)
+
+	removed, _ := metric.CreateMetric(metric.GaugeType, "Removed", metric.WithValueFloat(1))
+	require.NoError(t, store.Upsert(removed))
+	require.NoError(t, store.Delete(removed))
+
+	// Сбой: хранилище не закрывается и снимок не записывается
+	restored := New(fileName, logger)
+	require.NoError(t, restored.Restore())
+
+	got, err := restored.Get(gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = restored.Get(counter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *got.Delta)
+
+	_, err = restored.Get(removed)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+}
+
+func TestStorage_RestoreTornWAL(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	logger := logpack.NewLogger()
+
+	store := New(fileName, logger)
+	require.NoError(t, store.Restore())
+
+	first, _ := metric.CreateMetric(metric.GaugeType, "First", metric.WithValueFloat(1))
+	second, _ := metric.CreateMetric(metric.GaugeType, "Second", metric.WithValueFloat(2))
+	require.NoError(t, store.Upsert(first))
+	require.NoError(t, store.Upsert(second))
+
+	// Сбой: хранилище не закрывается и снимок не записывается
+	info, err := os.Stat(fileName + ".wal")
+	require.NoError(t, err)
+
+	// Последняя запись прервана на середине
+	require.NoError(t, os.Truncate(fileName+".wal", info.Size()-5))
+
+	restored := New(fileName, logger)
+	require.NoError(t, restored.Restore())
+
+	_, err = restored.Get(first)
+	assert.NoError(t, err)
+
+	_, err = restored.Get(second)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	// Новые записи добавляются после последней целой записи
+	third, _ := metric.CreateMetric(metric.GaugeType, "Third", metric.WithValueFloat(3))
+	require.NoError(t, restored.Upsert(third))
+	require.NoError(t, restored.Close())
+
+	again := New(fileName, logger)
+	require.NoError(t, again.Restore())
+
+	metrics, err := again.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+func TestStorage_FlushAtomic(t *testing.T) {
+
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "metrics.json")
+
+	store := New(fileName, logpack.NewLogger())
+	require.NoError(t, store.Restore())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	require.NoError(t, store.Upsert(gauge))
+	require.NoError(t, store.Flush())
+
+	// После записи снимка журнал не содержит записей, временные файлы удалены
+	replayed := 0
+	_, err := replayWAL(fileName+".wal", store.seq, func(walRecord) error {
+		replayed++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Zero(t, replayed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// TestStorage_RestoreWithoutHistory Восстановление снимка без истории не добавляет точки со временем восстановления
+func TestStorage_RestoreWithoutHistory(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+
+	// Снимок предыдущей версии содержит только текущие значения метрик
+	require.NoError(t, os.WriteFile(fileName, []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`), 0o644))
+
+	store := New(fileName, logpack.NewLogger(), WithRetention(time.Hour))
+	require.NoError(t, store.Restore())
+
+	gauge := metric.Metric{ID: "Alloc", MType: metric.GaugeType}
+
+	got, err := store.Get(gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	points, err := store.GetRange(gauge, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, points)
+}
+
+// TestStorage_WALBeforeMemory Если запись в журнал не удалась, метрика в памяти не изменяется
+func TestStorage_WALBeforeMemory(t *testing.T) {
+
+	store := New("", logpack.NewLogger())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	assert.Error(t, store.Upsert(gauge))
+	assert.Error(t, store.UpsertBatch([]metric.Metric{gauge}))
+
+	counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(1))
+	_, err := store.Add(counter)
+	assert.Error(t, err)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+// TestStorage_RestoreWALTimestamp Точки истории из журнала восстанавливаются со временем исходного обновления
+func TestStorage_RestoreWALTimestamp(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	logger := logpack.NewLogger()
+	updated := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+
+	store := New(fileName, logger, WithRetention(time.Hour))
+	store.now = func() time.Time { return updated }
+	require.NoError(t, store.Restore())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1.5))
+	require.NoError(t, store.Upsert(gauge))
+
+	restored := New(fileName, logger, WithRetention(time.Hour))
+	require.NoError(t, restored.Restore())
+
+	points, err := restored.GetRange(gauge, time.Time{}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.True(t, updated.Equal(points[0].Timestamp))
+	assert.Equal(t, 1.5, points[0].Value)
+}
+
+// TestStorage_WALLimit С WithWALLimit Flush не записывает снимок, пока журнал меньше заданного размера
+func TestStorage_WALLimit(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	logger := logpack.NewLogger()
+
+	store := New(fileName, logger, WithWALLimit(1024))
+	require.NoError(t, store.Restore())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	require.NoError(t, store.Upsert(gauge))
+	require.NoError(t, store.Flush())
+
+	_, err := os.Stat(fileName)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for store.wal.size < 1024 {
+		require.NoError(t, store.Upsert(gauge))
+	}
+	require.NoError(t, store.Flush())
+
+	_, err = os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Less(t, store.wal.size, int64(1024))
+
+	// Close записывает снимок независимо от размера журнала
+	other, _ := metric.CreateMetric(metric.GaugeType, "Other", metric.WithValueFloat(2))
+	require.NoError(t, store.Upsert(other))
+	require.NoError(t, store.Close())
+	require.NoError(t, os.Remove(fileName+".wal"))
+
+	restored := New(fileName, logger)
+	require.NoError(t, restored.Restore())
+
+	_, err = restored.Get(other)
+	assert.NoError(t, err)
+}
+
+// TestStorage_RestoreStaleWAL Журнал, не очищенный из-за сбоя после замены снимка, не применяется повторно
+func TestStorage_RestoreStaleWAL(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "metrics.json")
+	logger := logpack.NewLogger()
+
+	store := New(fileName, logger, WithRetention(time.Hour))
+	require.NoError(t, store.Restore())
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	require.NoError(t, store.Upsert(gauge))
+	require.NoError(t, store.Upsert(gauge))
+
+	// Сбой между заменой снимка и очисткой журнала
+	require.NoError(t, store.writeSnapshot(store.seq+1))
+
+	restored := New(fileName, logger, WithRetention(time.Hour))
+	require.NoError(t, restored.Restore())
+
+	points, err := restored.GetRange(gauge, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, points, 2)
+
+	// Записи после восстановления применяются к восстановленному снимку
+	require.NoError(t, restored.Upsert(gauge))
+
+	again := New(fileName, logger, WithRetention(time.Hour))
+	require.NoError(t, again.Restore())
+
+	points, err = again.GetRange(gauge, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, points, 3)
+}
@@ -0,0 +1,203 @@
+package filestorage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+const (
+	opUpsert   = "upsert"
+	opDelete   = "delete"
+	opSnapshot = "snapshot" // первая запись журнала: номер снимка, после которого сделаны записи
+
+	// walHeaderSize Заголовок записи: длина данных и контрольная сумма CRC32
+	walHeaderSize = 8
+
+	// walMaxRecord Максимальный размер данных записи, больший размер означает поврежденный заголовок
+	walMaxRecord = 16 << 20
+)
+
+var (
+	errTornRecord = errors.New("wal record is torn or corrupted")
+	errStaleWAL   = errors.New("wal was written before the snapshot")
+)
+
+type (
+	// walRecord Операция над метрикой, записанная в журнал.
+	// Timestamp - время точки истории, в записях предыдущих версий отсутствует.
+	// Seq - номер снимка в записи opSnapshot.
+	walRecord struct {
+		Op        string           `json:"op"`
+		Metric    metricPkg.Metric `json:"metric"`
+		Timestamp time.Time        `json:"ts"`
+		Seq       uint64           `json:"seq,omitempty"`
+	}
+
+	// wal Журнал упреждающей записи.
+	// Каждая запись: 4 байта длины данных, 4 байта CRC32 данных, данные в формате JSON.
+	wal struct {
+		file *os.File
+		sync bool  // вызывать fsync после каждой записи
+		size int64 // размер журнала в байтах
+	}
+)
+
+// openWAL Открытие журнала на дозапись
+func openWAL(fileName string, sync bool) (*wal, error) {
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open wal: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("could not stat wal: %w", err)
+	}
+
+	return &wal{file: file, sync: sync, size: info.Size()}, nil
+}
+
+// append Запись операции в журнал. После возврата без ошибки запись находится в файле
+// (и на диске, если включен sync).
+func (w *wal) append(record walRecord) error {
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not encode wal record: %w", err)
+	}
+
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	n, err := w.file.Write(buf)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("could not write wal record: %w", err)
+	}
+
+	if w.sync {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("could not sync wal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reset Очистка журнала после записи снимка seq.
+// Журнал начинается с номера снимка, поэтому журнал, не очищенный из-за сбоя после записи снимка,
+// не применяется к нему повторно.
+func (w *wal) reset(seq uint64) error {
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate wal: %w", err)
+	}
+	w.size = 0
+
+	return w.append(walRecord{Op: opSnapshot, Seq: seq})
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+// replayWAL Чтение записей журнала, сделанных после снимка seq, и применение их в порядке записи.
+// Если журнал начат до снимка seq (в журналах предыдущих версий номера нет, он считается нулевым),
+// записи не применяются и возвращается errStaleWAL.
+// Чтение останавливается на первой неполной или поврежденной записи,
+// возвращается смещение конца последней целой записи.
+func replayWAL(fileName string, seq uint64, apply func(walRecord) error) (int64, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("could not open wal: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var offset int64
+	for {
+		record, size, errRead := readRecord(reader)
+		if errors.Is(errRead, io.EOF) {
+			return offset, nil
+		}
+
+		if errRead != nil {
+			return offset, errRead
+		}
+
+		if offset == 0 {
+			var walSeq uint64
+			if record.Op == opSnapshot {
+				walSeq = record.Seq
+			}
+
+			if walSeq < seq {
+				return 0, errStaleWAL
+			}
+		}
+
+		if record.Op == opSnapshot {
+			offset += size
+			continue
+		}
+
+		if err := apply(record); err != nil {
+			return offset, err
+		}
+
+		offset += size
+	}
+}
+
+// readRecord Чтение одной записи журнала, io.EOF - журнал закончился на границе записи
+func readRecord(reader io.Reader) (walRecord, int64, error) {
+
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return walRecord{}, 0, io.EOF
+		}
+
+		return walRecord{}, 0, errTornRecord
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > walMaxRecord {
+		return walRecord{}, 0, errTornRecord
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return walRecord{}, 0, errTornRecord
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return walRecord{}, 0, errTornRecord
+	}
+
+	var record walRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return walRecord{}, 0, errTornRecord
+	}
+
+	return record, int64(walHeaderSize) + int64(size), nil
+}
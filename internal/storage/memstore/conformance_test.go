@@ -0,0 +1,18 @@
+package memstore
+
+import (
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/internal/storage/storagetest"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		return func(t *testing.T) storage.Repository {
+			return New(WithRetention(time.Hour))
+		}
+	}, storagetest.Options{})
+}
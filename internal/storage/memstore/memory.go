@@ -1,108 +1,452 @@
 package memstore
 
 import (
-	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	"metrics-and-alerting/internal/storage"
 	"metrics-and-alerting/pkg/errs"
 	metricPkg "metrics-and-alerting/pkg/metric"
 )
 
-type Storage struct {
-	metrics []metricPkg.Metric
-}
+type (
+	OptionsStorage func(*Storage)
 
-func New() *Storage {
-	return &Storage{
-		metrics: make([]metricPkg.Metric, 0),
+	// Storage Хранение метрик в памяти.
+	// Метрики хранятся в map по ключу серии (тип, имя и метки), доступ защищен RWMutex.
+	// Метрики копируются при записи и чтении, поэтому изменение полученной метрики не влияет на хранилище.
+	Storage struct {
+		mu        sync.RWMutex
+		metrics   map[string]metricPkg.Metric
+		history   map[string][]storage.Point // история значений по ключу серии, точки упорядочены по времени
+		noHistory bool                       // не сохранять историю значений при обновлении
+		retention time.Duration              // сколько хранится история, 0 - без ограничения
+		swept     time.Time                  // время последнего удаления устаревших точек всех серий
+		now       func() time.Time
 	}
-}
+)
 
-// Find - Поиск метрики в слайсе
-// Возвращается индекс метрики в слайсе и ошибку, если такой метрики не существует
-func (store Storage) Find(mSeek metricPkg.Metric) (int, error) {
+// sweepInterval Минимальный интервал между удалениями устаревших точек всех серий в Flush,
+// который может вызываться после каждого изменения
+const sweepInterval = time.Minute
 
-	for i, m := range store.metrics {
-		if m.MType == mSeek.MType && m.ID == mSeek.ID {
-			return i, nil
-		}
+func New(opts ...OptionsStorage) *Storage {
+
+	store := &Storage{
+		metrics: make(map[string]metricPkg.Metric),
+		history: make(map[string][]storage.Point),
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	return store
+}
+
+// WithRetention Окно хранения истории значений метрик, 0 - без ограничения (по умолчанию)
+func WithRetention(retention time.Duration) OptionsStorage {
+	return func(store *Storage) {
+		store.retention = retention
 	}
+}
 
-	return -1, errs.ErrNotFound
+// WithoutHistory Хранение только текущих значений метрик, без истории.
+// Используется, если история не запрашивается, например, в агенте.
+func WithoutHistory() OptionsStorage {
+	return func(store *Storage) {
+		store.noHistory = true
+	}
 }
 
 // Upsert Обновление значения метрики, или добавление метрики, если ранее её не существовало
 func (store *Storage) Upsert(metric metricPkg.Metric) error {
 
-	if idx, err := store.Find(metric); err != nil {
-		store.metrics = append(store.metrics, metric)
-	} else {
+	store.mu.Lock()
+	defer store.mu.Unlock()
 
-		store.metrics[idx].Hash = metric.Hash
+	store.upsert(metric)
+	return nil
+}
 
-		switch metric.MType {
-		case metricPkg.GaugeType:
-			store.metrics[idx].Value = metric.Value
-		case metricPkg.CounterType:
-			store.metrics[idx].Delta = metric.Delta
-		}
-	}
+// UpsertAt Обновление значения метрики с точкой истории в момент ts.
+// Используется при восстановлении из журнала, чтобы история сохранила время исходного обновления.
+func (store *Storage) UpsertAt(metric metricPkg.Metric, ts time.Time) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
 
+	store.upsertAt(metric, ts)
 	return nil
 }
 
 // UpsertBatch Обновление набора метрик
 func (store *Storage) UpsertBatch(metrics []metricPkg.Metric) error {
 
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
 	for _, m := range metrics {
-		if err := store.Upsert(m); err != nil {
-			return fmt.Errorf("can not upsert metrics: %w", err)
-		}
+		store.upsert(m)
 	}
 
 	return nil
 }
 
-// Get - Получение полность заполненной метрики
-func (store Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
+// Add Прибавление Delta счетчика или наблюдений гистограммы к сохраненному значению под блокировкой на запись.
+// Если серии еще нет, она сохраняется с переданным значением.
+func (store *Storage) Add(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	if err := storage.CheckAccumulate(metric); err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.init()
 
-	idx, err := store.Find(metric)
+	var known *metricPkg.Metric
+	if m, ok := store.metrics[seriesKey(metric)]; ok {
+		known = &m
+	}
+
+	accum, err := storage.Accumulate(known, metric)
 	if err != nil {
 		return metricPkg.Metric{}, err
 	}
 
-	return store.metrics[idx], nil
+	return clone(store.upsert(accum)), nil
+}
+
+// Get - Получение полность заполненной метрики
+func (store *Storage) Get(metric metricPkg.Metric) (metricPkg.Metric, error) {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	m, ok := store.metrics[seriesKey(metric)]
+	if !ok {
+		return metricPkg.Metric{}, errs.ErrNotFound
+	}
+
+	return clone(m), nil
 }
 
-// GetBatch Получение всех метрик в виде слайса
-func (store Storage) GetBatch() ([]metricPkg.Metric, error) {
+// GetBatch Получение копии всех метрик, порядок метрик не определен
+func (store *Storage) GetBatch() ([]metricPkg.Metric, error) {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 
-	return store.metrics, nil
+	metrics := make([]metricPkg.Metric, 0, len(store.metrics))
+	for _, m := range store.metrics {
+		metrics = append(metrics, clone(m))
+	}
+
+	return metrics, nil
 }
 
 // Delete - Удаление метрики
 func (store *Storage) Delete(metric metricPkg.Metric) error {
 
-	idx, err := store.Find(metric)
-	if err != nil {
-		return err
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key := seriesKey(metric)
+	if _, ok := store.metrics[key]; !ok {
+		return errs.ErrNotFound
 	}
 
-	store.metrics = append(store.metrics[:idx], store.metrics[idx+1:]...)
+	delete(store.metrics, key)
+	delete(store.history, key)
+
 	return nil
 }
 
-func (store Storage) Flush() error {
+// GetRange Получение значений серии метрики в интервале времени [start, end]
+func (store *Storage) GetRange(metric metricPkg.Metric, start, end time.Time) ([]storage.Point, error) {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	key := seriesKey(metric)
+	if _, ok := store.metrics[key]; !ok {
+		return nil, errs.ErrNotFound
+	}
+
+	points := store.history[key]
+
+	// Устаревшие точки серий, которые давно не обновлялись, еще могут не быть удалены
+	if deadline, ok := store.deadline(); ok && start.Before(deadline) {
+		start = deadline
+	}
+
+	from := sort.Search(len(points), func(i int) bool {
+		return !points[i].Timestamp.Before(start)
+	})
+
+	to := sort.Search(len(points), func(i int) bool {
+		return points[i].Timestamp.After(end)
+	})
+
+	if from >= to {
+		return []storage.Point{}, nil
+	}
+
+	result := make([]storage.Point, to-from)
+	copy(result, points[from:to])
+
+	return result, nil
+}
+
+// LastPoint Последнее сохраненное значение серии метрики
+func (store *Storage) LastPoint(metric metricPkg.Metric) (storage.Point, error) {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	points := store.history[seriesKey(metric)]
+	if len(points) == 0 {
+		return storage.Point{}, errs.ErrNotFound
+	}
+
+	return points[len(points)-1], nil
+}
+
+// History История значений всех серий метрик в окне хранения
+func (store *Storage) History() []storage.Series {
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]string, 0, len(store.history))
+	for key, points := range store.history {
+		if _, ok := store.metrics[key]; ok && len(store.prune(points)) > 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	series := make([]storage.Series, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, storage.Series{
+			Metric: clone(store.metrics[key]),
+			Points: append([]storage.Point(nil), store.prune(store.history[key])...),
+		})
+	}
+
+	return series
+}
+
+// Load Загрузка текущих значений метрик без добавления точек в историю.
+// Используется при восстановлении, история серий загружается отдельно через RestoreHistory.
+func (store *Storage) Load(metrics []metricPkg.Metric) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.init()
+
+	for _, m := range metrics {
+		store.metrics[seriesKey(m)] = clone(m)
+	}
+}
+
+// RestoreHistory Замена истории значений серий метрик
+// Точки за пределами окна хранения отбрасываются.
+func (store *Storage) RestoreHistory(series []storage.Series) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.init()
+
+	for _, s := range series {
+		points := append([]storage.Point(nil), s.Points...)
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Timestamp.Before(points[j].Timestamp)
+		})
+
+		store.history[seriesKey(s.Metric)] = store.prune(points)
+	}
+}
+
+// Flush Удаление устаревших точек истории всех серий, в том числе переставших обновляться.
+// Выполняется не чаще sweepInterval; при чтении устаревшие точки не возвращаются независимо от Flush.
+func (store *Storage) Flush() error {
+
+	if store.retention <= 0 {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.clock()
+	if now.Sub(store.swept) < sweepInterval {
+		return nil
+	}
+	store.swept = now
+
+	for key, points := range store.history {
+		points = store.prune(points)
+		if len(points) == 0 {
+			delete(store.history, key)
+			continue
+		}
+
+		store.history[key] = points
+	}
+
 	return nil
 }
 
-func (store Storage) Restore() error {
+func (store *Storage) Restore() error {
 	return nil
 }
 
-func (store Storage) Close() error {
+func (store *Storage) Close() error {
 	return nil
 }
 
-func (store Storage) Health() bool {
+func (store *Storage) Health() bool {
 	return true
 }
+
+// upsert Обновление метрики, вызывается под блокировкой на запись.
+// Возвращает сохраненную метрику.
+func (store *Storage) upsert(metric metricPkg.Metric) metricPkg.Metric {
+	return store.upsertAt(metric, store.clock())
+}
+
+// upsertAt Обновление метрики с точкой истории в момент ts, вызывается под блокировкой на запись
+func (store *Storage) upsertAt(metric metricPkg.Metric, ts time.Time) metricPkg.Metric {
+
+	store.init()
+
+	key := seriesKey(metric)
+	update := clone(metric)
+
+	known, ok := store.metrics[key]
+	if !ok {
+		known = update
+	} else {
+		known.Hash = update.Hash
+
+		switch metric.MType {
+		case metricPkg.GaugeType:
+			known.Value = update.Value
+		case metricPkg.CounterType:
+			known.Delta = update.Delta
+		case metricPkg.HistogramType:
+			known.Histogram = update.Histogram
+		}
+	}
+
+	store.metrics[key] = known
+
+	if store.noHistory {
+		return known
+	}
+
+	if value, ok := known.FloatValue(); ok {
+		store.appendPoint(key, storage.Point{Timestamp: ts, Value: value})
+	}
+
+	return known
+}
+
+// appendPoint Добавление точки в историю серии с удалением устаревших точек
+func (store *Storage) appendPoint(key string, point storage.Point) {
+
+	points := store.history[key]
+
+	// Время точки не может быть меньше времени последней точки серии
+	if n := len(points); n > 0 && point.Timestamp.Before(points[n-1].Timestamp) {
+		point.Timestamp = points[n-1].Timestamp
+	}
+
+	store.history[key] = store.prune(append(points, point))
+}
+
+// prune Удаление точек старше окна хранения
+func (store *Storage) prune(points []storage.Point) []storage.Point {
+
+	deadline, ok := store.deadline()
+	if !ok || len(points) == 0 {
+		return points
+	}
+
+	idx := sort.Search(len(points), func(i int) bool {
+		return !points[i].Timestamp.Before(deadline)
+	})
+
+	return points[idx:]
+}
+
+// deadline Время, раньше которого точки истории устарели; false, если окно хранения не ограничено
+func (store *Storage) deadline() (time.Time, bool) {
+
+	if store.retention <= 0 {
+		return time.Time{}, false
+	}
+
+	return store.clock().Add(-store.retention), true
+}
+
+// init Создание map для хранилища, объявленного без конструктора
+func (store *Storage) init() {
+
+	if store.metrics == nil {
+		store.metrics = make(map[string]metricPkg.Metric)
+	}
+
+	if store.history == nil {
+		store.history = make(map[string][]storage.Point)
+	}
+}
+
+func (store *Storage) clock() time.Time {
+	if store.now == nil {
+		return time.Now()
+	}
+
+	return store.now()
+}
+
+// seriesKey Ключ серии метрики
+func seriesKey(metric metricPkg.Metric) string {
+	return metric.MType + ":" + metric.SeriesKey()
+}
+
+// clone Копия метрики, не разделяющая с исходной значения по указателям и метки
+func clone(metric metricPkg.Metric) metricPkg.Metric {
+
+	if metric.Value != nil {
+		value := *metric.Value
+		metric.Value = &value
+	}
+
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		metric.Delta = &delta
+	}
+
+	if metric.Histogram != nil {
+		metric.Histogram = metric.Histogram.Copy()
+	}
+
+	if metric.Labels != nil {
+		labels := make(map[string]string, len(metric.Labels))
+		for name, value := range metric.Labels {
+			labels[name] = value
+		}
+		metric.Labels = labels
+	}
+
+	return metric
+}
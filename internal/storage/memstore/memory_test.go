@@ -2,9 +2,15 @@ package memstore
 
 import (
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"metrics-and-alerting/pkg/errs"
 	"metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func BenchmarkInMemoryStorage_Upsert(b *testing.B) {
@@ -26,3 +32,307 @@ func BenchmarkInMemoryStorage_Upsert(b *testing.B) {
 		}
 	}
 }
+
+func TestStorage_UpsertLabels(t *testing.T) {
+
+	memStore := New()
+
+	host1, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1),
+		metric.WithLabels(map[string]string{"host": "web-1"}))
+	host2, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(2),
+		metric.WithLabels(map[string]string{"host": "web-2"}))
+
+	require.NoError(t, memStore.Upsert(host1))
+	require.NoError(t, memStore.Upsert(host2))
+
+	metrics, err := memStore.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	got, err := memStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType, Labels: map[string]string{"host": "web-2"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *got.Value)
+
+	_, err = memStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType})
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+}
+
+func TestStorage_GetRange(t *testing.T) {
+
+	start := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	memStore := New(WithRetention(time.Minute))
+	memStore.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		m, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueInt(int64(i)))
+		require.NoError(t, memStore.Upsert(m))
+		now = now.Add(10 * time.Second)
+	}
+
+	series := metric.Metric{ID: "Alloc", MType: metric.GaugeType}
+
+	points, err := memStore.GetRange(series, start.Add(10*time.Second), start.Add(30*time.Second))
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, 1.0, points[0].Value)
+	assert.Equal(t, 3.0, points[2].Value)
+	assert.Equal(t, start.Add(30*time.Second), points[2].Timestamp)
+
+	// Точки старше окна хранения удаляются при добавлении новых
+	now = start.Add(90 * time.Second)
+	m, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueInt(5))
+	require.NoError(t, memStore.Upsert(m))
+
+	points, err = memStore.GetRange(series, start, now)
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, 3.0, points[0].Value)
+
+	_, err = memStore.GetRange(metric.Metric{ID: "Unknown", MType: metric.GaugeType}, start, now)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	require.NoError(t, memStore.Delete(series))
+	assert.Empty(t, memStore.History())
+}
+
+// TestStorage_RetentionStale Окно хранения действует и для серий, которые перестали обновляться
+func TestStorage_RetentionStale(t *testing.T) {
+
+	start := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	memStore := New(WithRetention(time.Minute))
+	memStore.now = func() time.Time { return now }
+
+	stale, _ := metric.CreateMetric(metric.GaugeType, "Stale", metric.WithValueFloat(1))
+	active, _ := metric.CreateMetric(metric.GaugeType, "Active", metric.WithValueFloat(2))
+	require.NoError(t, memStore.Upsert(stale))
+
+	now = start.Add(2 * time.Minute)
+	require.NoError(t, memStore.Upsert(active))
+
+	// Устаревшие точки не возвращаются еще до удаления
+	points, err := memStore.GetRange(stale, start, now)
+	require.NoError(t, err)
+	assert.Empty(t, points)
+
+	history := memStore.History()
+	require.Len(t, history, 1)
+	assert.Equal(t, "Active", history[0].Metric.ID)
+
+	require.NoError(t, memStore.Flush())
+	assert.NotContains(t, memStore.history, seriesKey(stale))
+	assert.Contains(t, memStore.history, seriesKey(active))
+
+	// Текущее значение серии сохраняется
+	got, err := memStore.Get(stale)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *got.Value)
+}
+
+// TestStorage_HistoryDefault По умолчанию история хранится без ограничения, WithoutHistory ее отключает
+func TestStorage_HistoryDefault(t *testing.T) {
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	end := time.Now().Add(time.Hour)
+
+	memStore := New()
+	require.NoError(t, memStore.Upsert(gauge))
+
+	points, err := memStore.GetRange(gauge, time.Time{}, end)
+	require.NoError(t, err)
+	assert.Len(t, points, 1)
+
+	memStore = New(WithoutHistory())
+	require.NoError(t, memStore.Upsert(gauge))
+
+	points, err = memStore.GetRange(gauge, time.Time{}, end)
+	require.NoError(t, err)
+	assert.Empty(t, points)
+}
+
+func TestStorage_GetBatchCopy(t *testing.T) {
+
+	memStore := New()
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1),
+		metric.WithLabels(map[string]string{"host": "web-1"}))
+	require.NoError(t, memStore.Upsert(gauge))
+
+	// Изменение исходной метрики не влияет на хранилище
+	*gauge.Value = 100
+	gauge.Labels["host"] = "web-2"
+
+	metrics, err := memStore.GetBatch()
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, 1.0, *metrics[0].Value)
+
+	// Изменение полученных метрик не влияет на хранилище
+	*metrics[0].Value = 200
+	metrics[0].Labels["host"] = "web-3"
+
+	got, err := memStore.Get(metric.Metric{ID: "Alloc", MType: metric.GaugeType, Labels: map[string]string{"host": "web-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *got.Value)
+}
+
+// TestStorage_Concurrent Одновременная работа с хранилищем из нескольких горутин.
+// Запускать с флагом -race.
+func TestStorage_Concurrent(t *testing.T) {
+
+	memStore := New(WithRetention(time.Minute))
+
+	const (
+		workers    = 8
+		iterations = 500
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				id := "metric_" + strconv.Itoa(i%50)
+
+				gauge, _ := metric.CreateMetric(metric.GaugeType, id, metric.WithValueInt(int64(i)),
+					metric.WithLabels(map[string]string{"worker": strconv.Itoa(w)}))
+
+				assert.NoError(t, memStore.Upsert(gauge))
+
+				_, _ = memStore.Get(gauge)
+				_, _ = memStore.GetRange(gauge, time.Time{}, time.Now())
+
+				if _, err := memStore.GetBatch(); err != nil {
+					t.Error(err)
+				}
+
+				if i%10 == 0 {
+					_ = memStore.Delete(gauge)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	metrics, err := memStore.GetBatch()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(metrics), workers*50)
+}
+
+func TestStorage_AddConcurrent(t *testing.T) {
+
+	memStore := New()
+
+	const (
+		workers    = 16
+		iterations = 1000
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				counter, _ := metric.CreateMetric(metric.CounterType, "PollCount", metric.WithValueInt(1))
+				if _, err := memStore.Add(counter); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	got, err := memStore.Get(metric.Metric{ID: "PollCount", MType: metric.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *got.Delta)
+
+	gauge, _ := metric.CreateMetric(metric.GaugeType, "Alloc", metric.WithValueFloat(1))
+	_, err = memStore.Add(gauge)
+	assert.ErrorIs(t, err, errs.ErrInvalidType)
+}
+
+const benchSeries = 100000
+
+// newBenchStorage Хранилище со 100 тысячами серий
+func newBenchStorage(b *testing.B) (*Storage, []metric.Metric) {
+
+	memStore := New()
+	metrics := make([]metric.Metric, 0, benchSeries)
+
+	for i := 0; i < benchSeries; i++ {
+		m, _ := metric.CreateMetric(metric.GaugeType, "metric_"+strconv.Itoa(i%1000), metric.WithValueInt(int64(i)),
+			metric.WithLabels(map[string]string{"instance": strconv.Itoa(i / 1000)}))
+		metrics = append(metrics, m)
+	}
+
+	if err := memStore.UpsertBatch(metrics); err != nil {
+		b.Fatalf("error upsert metrics: %v", err)
+	}
+
+	b.ResetTimer()
+	return memStore, metrics
+}
+
+func BenchmarkStorage_Upsert100k(b *testing.B) {
+
+	memStore, metrics := newBenchStorage(b)
+
+	for i := 0; i < b.N; i++ {
+		if err := memStore.Upsert(metrics[i%benchSeries]); err != nil {
+			b.Errorf("error upsert metric: %v", err)
+		}
+	}
+}
+
+func BenchmarkStorage_Get100k(b *testing.B) {
+
+	memStore, metrics := newBenchStorage(b)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := memStore.Get(metrics[i%benchSeries]); err != nil {
+			b.Errorf("error get metric: %v", err)
+		}
+	}
+}
+
+func BenchmarkStorage_GetParallel100k(b *testing.B) {
+
+	memStore, metrics := newBenchStorage(b)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m := metrics[i%benchSeries]
+			if i%10 == 0 {
+				_ = memStore.Upsert(m)
+			} else {
+				_, _ = memStore.Get(m)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkStorage_GetBatch100k(b *testing.B) {
+
+	memStore, _ := newBenchStorage(b)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := memStore.GetBatch(); err != nil {
+			b.Errorf("error get metrics: %v", err)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package storage
 
 import (
+	"time"
+
 	"metrics-and-alerting/pkg/metric"
 )
 
 type Repository interface {
 	Upsert(metric metric.Metric) error
 	UpsertBatch(metrics []metric.Metric) error
+	// Add Атомарное прибавление Delta счетчика или наблюдений гистограммы к сохраненному значению,
+	// возвращает накопленную метрику
+	Add(metric metric.Metric) (metric.Metric, error)
 	Get(metric metric.Metric) (metric.Metric, error)
 	GetBatch() ([]metric.Metric, error)
+	GetRange(metric metric.Metric, start, end time.Time) ([]Point, error)
 	Delete(metric metric.Metric) error
 
 	Flush() error
@@ -17,3 +23,15 @@ type Repository interface {
 
 	Health() bool
 }
+
+// Point Значение серии метрики в момент времени
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Series История значений серии метрики
+type Series struct {
+	Metric metric.Metric `json:"metric"`
+	Points []Point       `json:"points"`
+}
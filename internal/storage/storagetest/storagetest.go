@@ -0,0 +1,396 @@
+// Package storagetest Общий набор тестов для реализаций storage.Repository
+package storagetest
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics-and-alerting/internal/storage"
+	"metrics-and-alerting/pkg/errs"
+	metricPkg "metrics-and-alerting/pkg/metric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// Opener Открытие хранилища. Повторные вызовы одного Opener открывают одни и те же данные,
+	// как при перезапуске сервера.
+	Opener func(t *testing.T) storage.Repository
+
+	// Factory Создание Opener для новых пустых данных, вызывается в начале каждого теста
+	Factory func(t *testing.T) Opener
+
+	// Options Возможности проверяемого хранилища
+	Options struct {
+		// Persistent Данные сохраняются после Flush и Close и загружаются Restore в новом хранилище
+		Persistent bool
+	}
+)
+
+// Run Запуск всех тестов набора для хранилища, создаваемого factory
+func Run(t *testing.T, factory Factory, opts Options) {
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, open Opener)
+	}{
+		{name: "UpsertGet", run: testUpsertGet},
+		{name: "UpsertReplace", run: testUpsertReplace},
+		{name: "UpsertBatch", run: testUpsertBatch},
+		{name: "Labels", run: testLabels},
+		{name: "TypeCollision", run: testTypeCollision},
+		{name: "Add", run: testAdd},
+		{name: "Delete", run: testDelete},
+		{name: "NotFound", run: testNotFound},
+		{name: "ConcurrentWriters", run: testConcurrentWriters},
+	}
+
+	if opts.Persistent {
+		tests = append(tests, struct {
+			name string
+			run  func(t *testing.T, open Opener)
+		}{name: "FlushRestore", run: testFlushRestore})
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, factory(t))
+		})
+	}
+}
+
+// openStore Открытие хранилища с закрытием по окончании теста
+func openStore(t *testing.T, open Opener) storage.Repository {
+
+	store := open(t)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	return store
+}
+
+func gauge(t *testing.T, id string, value float64, labels map[string]string) metricPkg.Metric {
+
+	m, err := metricPkg.CreateMetric(metricPkg.GaugeType, id, metricPkg.WithValueFloat(value), metricPkg.WithLabels(labels))
+	require.NoError(t, err)
+
+	return m
+}
+
+func counter(t *testing.T, id string, delta int64, labels map[string]string) metricPkg.Metric {
+
+	m, err := metricPkg.CreateMetric(metricPkg.CounterType, id, metricPkg.WithValueInt(delta), metricPkg.WithLabels(labels))
+	require.NoError(t, err)
+
+	return m
+}
+
+func histogram(t *testing.T, id string) metricPkg.Metric {
+
+	h, err := metricPkg.NewHistogram([]float64{0.5, 1})
+	require.NoError(t, err)
+
+	h.Observe(0.1)
+	h.Observe(2)
+
+	m, err := metricPkg.CreateMetric(metricPkg.HistogramType, id, metricPkg.WithHistogram(*h))
+	require.NoError(t, err)
+
+	return m
+}
+
+func testUpsertGet(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	g := gauge(t, "Alloc", 1.5, nil)
+	c := counter(t, "PollCount", 3, nil)
+	h := histogram(t, "Latency")
+
+	for _, m := range []metricPkg.Metric{g, c, h} {
+		require.NoError(t, store.Upsert(m))
+	}
+
+	got, err := store.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType})
+	require.NoError(t, err)
+	require.NotNil(t, got.Value)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = store.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	require.NotNil(t, got.Delta)
+	assert.Equal(t, int64(3), *got.Delta)
+
+	got, err = store.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	require.NoError(t, err)
+	require.NotNil(t, got.Histogram)
+	assert.Equal(t, *h.Histogram, *got.Histogram)
+}
+
+func testUpsertReplace(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	require.NoError(t, store.Upsert(gauge(t, "Alloc", 1, nil)))
+	require.NoError(t, store.Upsert(gauge(t, "Alloc", 2, nil)))
+
+	// Upsert заменяет значение счетчика, сложение выполняет Add
+	require.NoError(t, store.Upsert(counter(t, "PollCount", 5, nil)))
+	require.NoError(t, store.Upsert(counter(t, "PollCount", 7, nil)))
+
+	got, err := store.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *got.Value)
+
+	got, err = store.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *got.Delta)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+func testUpsertBatch(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	batch := make([]metricPkg.Metric, 0, 20)
+	for i := 0; i < 10; i++ {
+		batch = append(batch, gauge(t, "gauge_"+strconv.Itoa(i), float64(i), nil))
+		batch = append(batch, counter(t, "counter_"+strconv.Itoa(i), int64(i), nil))
+	}
+
+	require.NoError(t, store.UpsertBatch(batch))
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, len(batch))
+
+	for _, m := range batch {
+		got, errGet := store.Get(m)
+		require.NoError(t, errGet, m.ShotString())
+		assert.Equal(t, m.StringValue(), got.StringValue())
+	}
+}
+
+func testLabels(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	require.NoError(t, store.Upsert(gauge(t, "Alloc", 1, map[string]string{"host": "web-1"})))
+	require.NoError(t, store.Upsert(gauge(t, "Alloc", 2, map[string]string{"host": "web-2"})))
+	require.NoError(t, store.Upsert(gauge(t, "Alloc", 3, nil)))
+
+	for host, value := range map[string]float64{"web-1": 1, "web-2": 2} {
+		got, err := store.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType, Labels: map[string]string{"host": host}})
+		require.NoError(t, err)
+		assert.Equal(t, value, *got.Value)
+		assert.Equal(t, host, got.Labels["host"])
+	}
+
+	got, err := store.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, *got.Value)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 3)
+}
+
+// testTypeCollision Метрики разных типов с одинаковым именем - разные серии
+func testTypeCollision(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	require.NoError(t, store.Upsert(gauge(t, "Requests", 1.5, nil)))
+	require.NoError(t, store.Upsert(counter(t, "Requests", 10, nil)))
+
+	got, err := store.Get(metricPkg.Metric{ID: "Requests", MType: metricPkg.GaugeType})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = store.Get(metricPkg.Metric{ID: "Requests", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *got.Delta)
+
+	require.NoError(t, store.Delete(metricPkg.Metric{ID: "Requests", MType: metricPkg.GaugeType}))
+
+	_, err = store.Get(metricPkg.Metric{ID: "Requests", MType: metricPkg.CounterType})
+	assert.NoError(t, err)
+}
+
+func testAdd(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	accum, err := store.Add(counter(t, "PollCount", 5, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *accum.Delta)
+
+	accum, err = store.Add(counter(t, "PollCount", 3, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), *accum.Delta)
+
+	got, err := store.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), *got.Delta)
+
+	_, err = store.Add(gauge(t, "Alloc", 1, nil))
+	assert.ErrorIs(t, err, errs.ErrInvalidType)
+
+	_, err = store.Add(histogram(t, "Latency"))
+	require.NoError(t, err)
+
+	accum, err = store.Add(histogram(t, "Latency"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), accum.Histogram.Count)
+	assert.Equal(t, []uint64{2, 0, 2}, accum.Histogram.Counts)
+
+	got, err = store.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), got.Histogram.Count)
+
+	other, err := metricPkg.NewHistogram([]float64{10})
+	require.NoError(t, err)
+
+	_, err = store.Add(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType, Histogram: other})
+	assert.ErrorIs(t, err, errs.ErrBucketsMismatch)
+}
+
+func testDelete(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	g := gauge(t, "Alloc", 1, nil)
+	require.NoError(t, store.Upsert(g))
+	require.NoError(t, store.Upsert(gauge(t, "Frees", 2, nil)))
+
+	require.NoError(t, store.Delete(g))
+
+	_, err := store.Get(g)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	assert.ErrorIs(t, store.Delete(g), errs.ErrNotFound)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
+
+func testNotFound(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	unknown := metricPkg.Metric{ID: "Unknown", MType: metricPkg.GaugeType}
+
+	_, err := store.Get(unknown)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	assert.ErrorIs(t, store.Delete(unknown), errs.ErrNotFound)
+
+	_, err = store.GetRange(unknown, time.Time{}, time.Now())
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+// testConcurrentWriters Одновременная запись разных серий и сложение одного счетчика
+func testConcurrentWriters(t *testing.T, open Opener) {
+
+	store := openStore(t, open)
+
+	const (
+		workers    = 8
+		iterations = 25
+	)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				labels := map[string]string{"worker": strconv.Itoa(w)}
+
+				if err := store.Upsert(gauge(t, "gauge_"+strconv.Itoa(i), float64(i), labels)); err != nil {
+					t.Error(err)
+				}
+
+				if _, err := store.Add(counter(t, "PollCount", 1, nil)); err != nil {
+					t.Error(err)
+				}
+
+				if _, err := store.GetBatch(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	got, err := store.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *got.Delta)
+
+	metrics, err := store.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, workers*iterations+1)
+}
+
+// testFlushRestore Данные, записанные до Flush и Close, загружаются новым хранилищем
+func testFlushRestore(t *testing.T, open Opener) {
+
+	store := open(t)
+
+	labels := map[string]string{"host": "web-1"}
+	removed := gauge(t, "Removed", 1, nil)
+
+	require.NoError(t, store.UpsertBatch([]metricPkg.Metric{
+		gauge(t, "Alloc", 1.5, labels),
+		counter(t, "PollCount", 3, nil),
+		histogram(t, "Latency"),
+		removed,
+	}))
+
+	_, err := store.Add(counter(t, "PollCount", 2, nil))
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(removed))
+
+	require.NoError(t, store.Flush())
+	require.NoError(t, store.Close())
+
+	restored := openStore(t, open)
+	require.NoError(t, restored.Restore())
+
+	got, err := restored.Get(metricPkg.Metric{ID: "Alloc", MType: metricPkg.GaugeType, Labels: labels})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *got.Value)
+
+	got, err = restored.Get(metricPkg.Metric{ID: "PollCount", MType: metricPkg.CounterType})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *got.Delta)
+
+	got, err = restored.Get(metricPkg.Metric{ID: "Latency", MType: metricPkg.HistogramType})
+	require.NoError(t, err)
+	require.NotNil(t, got.Histogram)
+	assert.Equal(t, uint64(2), got.Histogram.Count)
+
+	_, err = restored.Get(removed)
+	assert.ErrorIs(t, err, errs.ErrNotFound)
+
+	metrics, err := restored.GetBatch()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 3)
+}
@@ -0,0 +1,177 @@
+// Package envelope Гибридное шифрование данных агента: данные шифруются случайным ключом AES-256-GCM,
+// ключ шифруется открытым ключом RSA-OAEP сервера.
+//
+// Формат конверта:
+//
+//	magic "MENV" (4 байта) | версия (1 байт) | ID ключа (8 байт) |
+//	длина зашифрованного ключа (2 байта, big-endian) | зашифрованный ключ AES | nonce (12 байт) | данные AES-GCM
+//
+// Заголовок до зашифрованного ключа включительно защищен AES-GCM как дополнительные данные.
+package envelope
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Заголовок HTTP запроса со схемой шифрования тела и значения схем
+const (
+	Header         = "X-Encryption"
+	SchemeEnvelope = "envelope"
+	SchemeLegacy   = "legacy"
+)
+
+const (
+	// Version1 Версия формата: AES-256-GCM, ключ зашифрован RSA-OAEP с SHA-256
+	Version1 byte = 1
+
+	magic       = "MENV"
+	keyIDSize   = 8
+	aesKeySize  = 32
+	wrappedSize = 2
+	headerSize  = len(magic) + 1 + keyIDSize + wrappedSize
+)
+
+var (
+	ErrMalformed          = errors.New("envelope is malformed")
+	ErrUnsupportedVersion = errors.New("envelope version is not supported")
+	ErrUnknownKey         = errors.New("envelope is encrypted with unknown key")
+)
+
+// KeyID Идентификатор открытого ключа: первые 8 байт SHA-256 от ключа в формате PKIX
+func KeyID(pub *rsa.PublicKey) ([]byte, error) {
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode public key: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	return sum[:keyIDSize], nil
+}
+
+// KeyIDString Идентификатор ключа в шестнадцатеричном виде для журналов
+func KeyIDString(pub *rsa.PublicKey) string {
+
+	id, err := KeyID(pub)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// Seal Шифрование data в конверт для владельца закрытого ключа, соответствующего pub
+func Seal(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, aesKeySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("could not generate data key: %w", err)
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not encrypt data key: %w", err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, headerSize+len(wrapped)+aead.NonceSize()+len(data)+aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, Version1)
+	out = append(out, keyID...)
+	out = append(out, 0, 0)
+	binary.BigEndian.PutUint16(out[headerSize-wrappedSize:headerSize], uint16(len(wrapped)))
+	out = append(out, wrapped...)
+
+	header := out
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// Open Расшифровка конверта закрытым ключом priv
+func Open(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrMalformed
+	}
+
+	if version := data[len(magic)]; version != Version1 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	keyID, err := KeyID(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(data[len(magic)+1:len(magic)+1+keyIDSize]) != string(keyID) {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownKey, data[len(magic)+1:len(magic)+1+keyIDSize])
+	}
+
+	wrappedLen := int(binary.BigEndian.Uint16(data[headerSize-wrappedSize : headerSize]))
+	if len(data) < headerSize+wrappedLen {
+		return nil, ErrMalformed
+	}
+
+	header := data[:headerSize+wrappedLen]
+
+	key, err := priv.Decrypt(nil, header[headerSize:], &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt data key: %w", err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := data[len(header):]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrMalformed
+	}
+
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt data: %w", err)
+	}
+
+	return plain, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+
+	if len(key) != aesKeySize {
+		return nil, ErrMalformed
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,153 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	keysOnce sync.Once
+	keys     [2]*rsa.PrivateKey
+)
+
+// testKeys Ключи RSA 4096 бит, как создаваемые cmd/crypto
+func testKeys(t testing.TB) (*rsa.PrivateKey, *rsa.PrivateKey) {
+
+	keysOnce.Do(func() {
+		for i := range keys {
+			key, err := rsa.GenerateKey(rand.Reader, 4096)
+			require.NoError(t, err)
+			keys[i] = key
+		}
+	})
+
+	return keys[0], keys[1]
+}
+
+func payload(size int) []byte {
+	return bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1.5},`), size/42+1)[:size]
+}
+
+func TestSealOpen(t *testing.T) {
+
+	key, other := testKeys(t)
+
+	for _, size := range []int{0, 1, 446, 64 << 10} {
+		data := payload(size)
+
+		sealed, err := Seal(&key.PublicKey, data)
+		require.NoError(t, err)
+		assert.Equal(t, Version1, sealed[len(magic)])
+
+		opened, err := Open(key, sealed)
+		require.NoError(t, err)
+		assert.Equal(t, data, append([]byte{}, opened...))
+
+		_, err = Open(other, sealed)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	}
+}
+
+func TestOpen_Tampered(t *testing.T) {
+
+	key, _ := testKeys(t)
+
+	sealed, err := Seal(&key.PublicKey, payload(1024))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		want   error
+	}{
+		{name: "magic", modify: func(b []byte) []byte { b[0] = 'X'; return b }, want: ErrMalformed},
+		{name: "version", modify: func(b []byte) []byte { b[len(magic)] = 2; return b }, want: ErrUnsupportedVersion},
+		{name: "truncated header", modify: func(b []byte) []byte { return b[:headerSize-1] }, want: ErrMalformed},
+		{name: "truncated data", modify: func(b []byte) []byte { return b[:len(b)-1] }},
+		{name: "ciphertext", modify: func(b []byte) []byte { b[len(b)-20] ^= 1; return b }},
+		{name: "wrapped key", modify: func(b []byte) []byte { b[headerSize] ^= 1; return b }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.modify(append([]byte(nil), sealed...))
+
+			_, errOpen := Open(key, data)
+			require.Error(t, errOpen)
+
+			if tt.want != nil {
+				assert.ErrorIs(t, errOpen, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacy(t *testing.T) {
+
+	key, _ := testKeys(t)
+	data := payload(4096)
+
+	sealed, err := SealLegacy(&key.PublicKey, data)
+	require.NoError(t, err)
+
+	opened, err := OpenLegacy(key, sealed)
+	require.NoError(t, err)
+	assert.Equal(t, data, opened)
+}
+
+// Сравнение с прежним форматом на пакете метрик 64 КБ:
+// прежний формат выполняет операцию RSA на каждые 446 байт данных, конверт - одну на пакет.
+func BenchmarkSeal_Legacy(b *testing.B) {
+	benchmarkSeal(b, SealLegacy)
+}
+
+func BenchmarkSeal_Envelope(b *testing.B) {
+	benchmarkSeal(b, Seal)
+}
+
+func BenchmarkOpen_Legacy(b *testing.B) {
+	benchmarkOpen(b, SealLegacy, OpenLegacy)
+}
+
+func BenchmarkOpen_Envelope(b *testing.B) {
+	benchmarkOpen(b, Seal, Open)
+}
+
+func benchmarkSeal(b *testing.B, seal func(*rsa.PublicKey, []byte) ([]byte, error)) {
+
+	key, _ := testKeys(b)
+	data := payload(64 << 10)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := seal(&key.PublicKey, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkOpen(b *testing.B, seal func(*rsa.PublicKey, []byte) ([]byte, error), open func(*rsa.PrivateKey, []byte) ([]byte, error)) {
+
+	key, _ := testKeys(b)
+	data := payload(64 << 10)
+
+	sealed, err := seal(&key.PublicKey, data)
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := open(key, sealed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
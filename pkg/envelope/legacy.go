@@ -0,0 +1,63 @@
+package envelope
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+)
+
+// SealLegacy Шифрование data блоками RSA-OAEP с SHA-256.
+// Прежний формат, поддерживается для агентов, не использующих конверт.
+func SealLegacy(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+
+	hashFunc := sha256.New()
+	dataLen := len(data)
+	step := pub.Size() - hashFunc.Size()*2 - 2
+	var encryptedBytes []byte
+	for start := 0; start < dataLen; start += step {
+		finish := start + step
+		if finish > dataLen {
+			finish = dataLen
+		}
+
+		encryptedBlockBytes, err := rsa.EncryptOAEP(
+			hashFunc,
+			rand.Reader,
+			pub,
+			data[start:finish],
+			nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedBytes = append(encryptedBytes, encryptedBlockBytes...)
+	}
+
+	return encryptedBytes, nil
+}
+
+// OpenLegacy Расшифровка данных, зашифрованных SealLegacy
+func OpenLegacy(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+
+	dataLen := len(data)
+	step := priv.PublicKey.Size()
+	var decryptedBytes []byte
+
+	for start := 0; start < dataLen; start += step {
+		finish := start + step
+		if finish > dataLen {
+			finish = dataLen
+		}
+
+		decryptedBlockBytes, err := priv.Decrypt(nil, data[start:finish], &rsa.OAEPOptions{Hash: crypto.SHA256})
+		if err != nil {
+			return nil, err
+		}
+
+		decryptedBytes = append(decryptedBytes, decryptedBlockBytes...)
+	}
+
+	return decryptedBytes, nil
+}
@@ -3,6 +3,8 @@ package errs
 import (
 	"errors"
 	"net/http"
+
+	"google.golang.org/grpc/codes"
 )
 
 type ErrStorage struct {
@@ -19,13 +21,15 @@ func (es ErrStorage) Error() string {
 
 // Ошибки метрики
 var (
-	ErrNotFound     = NewErr("metric not found")
-	ErrUnknownType  = NewErr("metric has unknown type")
-	ErrInvalidID    = NewErr("metric has incorrect id")
-	ErrInvalidType  = NewErr("metric has incorrect type")
-	ErrInvalidValue = NewErr("metric has incorrect value")
-	ErrInvalidJSON  = NewErr("can't convert data JSON to metric")
-	ErrSignFailed   = NewErr("sign verification failed")
+	ErrNotFound        = NewErr("metric not found")
+	ErrUnknownType     = NewErr("metric has unknown type")
+	ErrInvalidID       = NewErr("metric has incorrect id")
+	ErrInvalidType     = NewErr("metric has incorrect type")
+	ErrInvalidValue    = NewErr("metric has incorrect value")
+	ErrInvalidLabel    = NewErr("metric has incorrect label")
+	ErrBucketsMismatch = NewErr("histogram buckets mismatch")
+	ErrInvalidJSON     = NewErr("can't convert data JSON to metric")
+	ErrSignFailed      = NewErr("sign verification failed")
 )
 
 // Ошибки внешнего хранилища
@@ -35,6 +39,16 @@ var (
 	ErrFailedConnection = NewErr("can not create connection")
 )
 
+// Ошибки алертинга
+var (
+	ErrInvalidRule = NewErr("alert rule has incorrect format")
+)
+
+// Ошибки запросов истории метрик
+var (
+	ErrInvalidQuery = NewErr("query has incorrect parameters")
+)
+
 // ErrorHTTP - Преобразование ошибки Storage в HTTP код
 func ErrorHTTP(err error) int {
 
@@ -54,7 +68,10 @@ func ErrorHTTP(err error) int {
 		ErrInvalidID,
 		ErrInvalidType,
 		ErrInvalidValue,
+		ErrInvalidLabel,
+		ErrBucketsMismatch,
 		ErrInvalidJSON,
+		ErrInvalidQuery,
 		ErrSignFailed:
 
 		return http.StatusBadRequest
@@ -63,3 +80,37 @@ func ErrorHTTP(err error) int {
 		return http.StatusInternalServerError
 	}
 }
+
+// ErrorGRPC - Преобразование ошибки Storage в код gRPC
+func ErrorGRPC(err error) codes.Code {
+
+	var storeErr ErrStorage
+	if !errors.As(err, &storeErr) {
+		return codes.Internal
+	}
+
+	switch storeErr {
+	case ErrNotFound:
+		return codes.NotFound
+
+	case ErrUnknownType:
+		return codes.Unimplemented
+
+	case ErrSignFailed:
+		return codes.Unauthenticated
+
+	case
+		ErrInvalidID,
+		ErrInvalidType,
+		ErrInvalidValue,
+		ErrInvalidLabel,
+		ErrBucketsMismatch,
+		ErrInvalidJSON,
+		ErrInvalidQuery:
+
+		return codes.InvalidArgument
+
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,330 @@
+// Package exposition Представление метрик в текстовом формате Prometheus и OpenMetrics
+package exposition
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// Format Формат представления метрик
+type Format string
+
+const (
+	FormatText        Format = "text/plain; version=0.0.4; charset=utf-8"
+	FormatOpenMetrics Format = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+const (
+	mimeText        = "text/plain"
+	mimeOpenMetrics = "application/openmetrics-text"
+)
+
+// Negotiate Выбор формата по заголовку Accept.
+// OpenMetrics выбирается, если клиент явно запросил его с приоритетом не ниже text/plain,
+// во всех остальных случаях используется текстовый формат Prometheus.
+func Negotiate(accept string) Format {
+
+	qText, qOpenMetrics := -1.0, -1.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, errParse := strconv.ParseFloat(value, 64); errParse == nil {
+				q = parsed
+			}
+		}
+
+		switch mediaType {
+		case mimeOpenMetrics:
+			qOpenMetrics = math.Max(qOpenMetrics, q)
+		case mimeText, "text/*", "*/*":
+			qText = math.Max(qText, q)
+		}
+	}
+
+	if qOpenMetrics > 0 && qOpenMetrics >= qText {
+		return FormatOpenMetrics
+	}
+
+	return FormatText
+}
+
+// family Семейство серий с одним именем и типом
+type family struct {
+	name    string // имя семейства в строке # TYPE
+	sample  string // имя значений семейства
+	mtype   string
+	metrics []metricPkg.Metric
+}
+
+// Encode Запись метрик в формате format.
+// Серии группируются по имени после приведения к допустимому виду, для каждого семейства выводится строка # TYPE.
+// Серии, тип которых не совпадает с типом уже выведенного семейства с тем же именем,
+// и серии, совпадающие с уже выведенной серией после приведения имен, пропускаются.
+func Encode(w io.Writer, metrics []metricPkg.Metric, format Format) error {
+
+	writer := bufio.NewWriter(w)
+
+	for _, f := range families(metrics, format) {
+		if err := encodeFamily(writer, f); err != nil {
+			return err
+		}
+	}
+
+	if format == FormatOpenMetrics {
+		if _, err := writer.WriteString("# EOF\n"); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+func families(metrics []metricPkg.Metric, format Format) []*family {
+
+	byName := make(map[string]*family)
+	names := make([]string, 0)
+
+	for _, m := range metrics {
+		if _, ok := m.FloatValue(); !ok {
+			continue
+		}
+
+		name := SanitizeName(m.ID)
+		sample := name
+
+		// В OpenMetrics имя семейства счетчика не содержит суффикс _total, а у значений он обязателен
+		if m.MType == metricPkg.CounterType && format == FormatOpenMetrics {
+			name = strings.TrimSuffix(name, "_total")
+			sample = name + "_total"
+		}
+
+		f, ok := byName[name]
+		if !ok {
+			f = &family{name: name, sample: sample, mtype: m.MType}
+			byName[name] = f
+			names = append(names, name)
+		}
+
+		if f.mtype != m.MType {
+			continue
+		}
+
+		f.metrics = append(f.metrics, m)
+	}
+
+	sort.Strings(names)
+
+	result := make([]*family, 0, len(names))
+	for _, name := range names {
+		f := byName[name]
+		sort.Slice(f.metrics, func(i, j int) bool {
+			return f.metrics[i].SeriesKey() < f.metrics[j].SeriesKey()
+		})
+
+		f.metrics = uniqueSeries(f.metrics)
+		result = append(result, f)
+	}
+
+	return result
+}
+
+// uniqueSeries Удаление серий, метки которых совпадают с метками предыдущей серии после приведения имен.
+// Такие серии появляются, если разные имена метрик или меток приводятся к одному имени, остается первая серия.
+func uniqueSeries(metrics []metricPkg.Metric) []metricPkg.Metric {
+
+	seen := make(map[string]struct{}, len(metrics))
+	unique := metrics[:0]
+
+	for _, m := range metrics {
+		key := labelsKey(m.Labels)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		unique = append(unique, m)
+	}
+
+	return unique
+}
+
+// labelsKey Ключ набора меток после приведения имен меток
+func labelsKey(labels map[string]string) string {
+
+	pairs := make([]string, 0, len(labels))
+	for label, value := range labels {
+		pairs = append(pairs, SanitizeLabelName(label)+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "\xff")
+}
+
+func encodeFamily(w *bufio.Writer, f *family) error {
+
+	if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.mtype); err != nil {
+		return err
+	}
+
+	for _, m := range f.metrics {
+		var err error
+
+		switch m.MType {
+		case metricPkg.GaugeType:
+			err = writeSample(w, f.sample, m.Labels, "", "", formatFloat(*m.Value))
+
+		case metricPkg.CounterType:
+			err = writeSample(w, f.sample, m.Labels, "", "", strconv.FormatInt(*m.Delta, 10))
+
+		case metricPkg.HistogramType:
+			err = writeHistogram(w, f.name, m)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHistogram Запись гистограммы: накопительные корзины _bucket, _sum и _count.
+// Метка серии le выводится как exported_le, как это делает Prometheus при конфликте меток.
+func writeHistogram(w *bufio.Writer, name string, m metricPkg.Metric) error {
+
+	h := m.Histogram
+
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("could not encode histogram %s: %d buckets for %d bounds", m.ShotString(), len(h.Counts), len(h.Bounds))
+	}
+
+	labels := m.Labels
+	for label := range m.Labels {
+		if SanitizeLabelName(label) != "le" {
+			continue
+		}
+
+		labels = make(map[string]string, len(m.Labels))
+		for k, v := range m.Labels {
+			if SanitizeLabelName(k) == "le" {
+				k = "exported_le"
+			}
+			labels[k] = v
+		}
+
+		break
+	}
+
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		if err := writeSample(w, name+"_bucket", labels, "le", formatFloat(bound), strconv.FormatUint(cumulative, 10)); err != nil {
+			return err
+		}
+	}
+
+	if err := writeSample(w, name+"_bucket", labels, "le", "+Inf", strconv.FormatUint(h.Count, 10)); err != nil {
+		return err
+	}
+
+	if err := writeSample(w, name+"_sum", labels, "", "", formatFloat(h.Sum)); err != nil {
+		return err
+	}
+
+	return writeSample(w, name+"_count", labels, "", "", strconv.FormatUint(h.Count, 10))
+}
+
+// writeSample Запись строки значения: <имя>{<метки>} <значение>
+// extraName и extraValue - дополнительная метка (например, le у корзины гистограммы).
+func writeSample(w *bufio.Writer, name string, labels map[string]string, extraName, extraValue, value string) error {
+
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, label := range names {
+		pairs = append(pairs, SanitizeLabelName(label)+`="`+EscapeLabelValue(labels[label])+`"`)
+	}
+
+	if len(extraName) > 0 {
+		pairs = append(pairs, extraName+`="`+EscapeLabelValue(extraValue)+`"`)
+	}
+
+	var err error
+	if len(pairs) == 0 {
+		_, err = fmt.Fprintf(w, "%s %s\n", name, value)
+	} else {
+		_, err = fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), value)
+	}
+
+	return err
+}
+
+// SanitizeName Приведение имени метрики к допустимому виду [a-zA-Z_:][a-zA-Z0-9_:]*
+func SanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName Приведение имени метки к допустимому виду [a-zA-Z_][a-zA-Z0-9_]*
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+
+	var builder strings.Builder
+
+	for i, r := range name {
+		valid := r == '_' ||
+			(r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9' && i > 0) ||
+			(r == ':' && allowColon)
+
+		if valid {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune('_')
+		}
+	}
+
+	return builder.String()
+}
+
+// EscapeLabelValue Экранирование значения метки: обратная косая черта, двойная кавычка и перевод строки
+func EscapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
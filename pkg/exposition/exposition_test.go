@@ -0,0 +1,137 @@
+package exposition
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+func testMetrics() []metricPkg.Metric {
+
+	gauge, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "HeapAlloc", metricPkg.WithValueFloat(1.5),
+		metricPkg.WithLabels(map[string]string{"host": "web-1", "path": "C:\\tmp\n\"x\""}))
+	counter, _ := metricPkg.CreateMetric(metricPkg.CounterType, "PollCount", metricPkg.WithValueInt(7))
+	histogram, _ := metricPkg.CreateMetric(metricPkg.HistogramType, "latency.seconds",
+		metricPkg.WithValue("bounds=0.1,1;counts=2,1,1;sum=3.5;count=4"))
+	conflict, _ := metricPkg.CreateMetric(metricPkg.CounterType, "HeapAlloc", metricPkg.WithValueInt(1))
+
+	return []metricPkg.Metric{counter, gauge, histogram, conflict}
+}
+
+func TestEncode_Text(t *testing.T) {
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, testMetrics(), FormatText))
+
+	want := `# TYPE HeapAlloc gauge
+HeapAlloc{host="web-1",path="C:\\tmp\n\"x\""} 1.5
+# TYPE PollCount counter
+PollCount 7
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 3.5
+latency_seconds_count 4
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestEncode_OpenMetrics(t *testing.T) {
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, testMetrics()[:2], FormatOpenMetrics))
+
+	want := `# TYPE HeapAlloc gauge
+HeapAlloc{host="web-1",path="C:\\tmp\n\"x\""} 1.5
+# TYPE PollCount counter
+PollCount_total 7
+# EOF
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestEncode_InvalidHistogram(t *testing.T) {
+
+	invalid := metricPkg.Metric{
+		ID:        "latency",
+		MType:     metricPkg.HistogramType,
+		Histogram: &metricPkg.Histogram{Bounds: []float64{1, 2, 3}, Counts: []uint64{1}, Count: 1},
+	}
+
+	var buf bytes.Buffer
+	assert.Error(t, Encode(&buf, []metricPkg.Metric{invalid}, FormatText))
+}
+
+func TestEncode_LabelLe(t *testing.T) {
+
+	histogram, _ := metricPkg.CreateMetric(metricPkg.HistogramType, "latency",
+		metricPkg.WithValue("bounds=1;counts=1,0;sum=0.5;count=1"),
+		metricPkg.WithLabels(map[string]string{"le": "user"}))
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, []metricPkg.Metric{histogram}, FormatText))
+
+	want := `# TYPE latency histogram
+latency_bucket{exported_le="user",le="1"} 1
+latency_bucket{exported_le="user",le="+Inf"} 1
+latency_sum{exported_le="user"} 0.5
+latency_count{exported_le="user"} 1
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestEncode_NameCollisions(t *testing.T) {
+
+	dotted, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "heap.alloc", metricPkg.WithValueFloat(1))
+	underscored, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "heap_alloc", metricPkg.WithValueFloat(2))
+	labeled, _ := metricPkg.CreateMetric(metricPkg.GaugeType, "heap-alloc", metricPkg.WithValueFloat(3),
+		metricPkg.WithLabels(map[string]string{"host": "web-1"}))
+	requests, _ := metricPkg.CreateMetric(metricPkg.CounterType, "requests", metricPkg.WithValueInt(1))
+	requestsTotal, _ := metricPkg.CreateMetric(metricPkg.CounterType, "requests_total", metricPkg.WithValueInt(2))
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, []metricPkg.Metric{dotted, underscored, labeled, requests, requestsTotal}, FormatOpenMetrics))
+
+	// Серии с одинаковыми именами после приведения объединяются в одно семейство, совпадающие серии пропускаются
+	want := `# TYPE heap_alloc gauge
+heap_alloc{host="web-1"} 3
+heap_alloc 1
+# TYPE requests counter
+requests_total 1
+# EOF
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestNegotiate(t *testing.T) {
+
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{accept: "", want: FormatText},
+		{accept: "*/*", want: FormatText},
+		{accept: "text/plain;version=0.0.4", want: FormatText},
+		{accept: "application/openmetrics-text;version=1.0.0", want: FormatOpenMetrics},
+		{accept: "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4,*/*;q=0.1", want: FormatOpenMetrics},
+		{accept: "application/openmetrics-text;q=0.2,text/plain;q=0.9", want: FormatText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.accept))
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+
+	assert.Equal(t, "go_memstats:alloc", SanitizeName("go_memstats:alloc"))
+	assert.Equal(t, "_cpu_0_usage", SanitizeName("1cpu.0-usage"))
+	assert.Equal(t, "label_name", SanitizeLabelName("label:name"))
+}
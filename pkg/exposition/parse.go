@@ -0,0 +1,396 @@
+package exposition
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// ParseError Ошибка разбора строки текстового формата
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors Ошибки разбора всех некорректных строк
+type ParseErrors []ParseError
+
+func (errs ParseErrors) Error() string {
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// histogramSeries Накопление строк _bucket, _sum и _count одной серии гистограммы
+type histogramSeries struct {
+	name    string
+	labels  map[string]string
+	buckets map[float64]float64
+	sum     float64
+	count   float64
+	line    int
+}
+
+// Parse Разбор метрик в текстовом формате Prometheus.
+// Значения counter - накопленные с запуска источника и приводятся к целому, значения без типа
+// и untyped считаются gauge. Гистограммы собираются из строк _bucket, _sum и _count,
+// у summary учитываются только _sum и _count. Метки времени игнорируются.
+// Значения NaN и ±Inf некорректны: их нельзя передать серверу в JSON.
+// Некорректные строки пропускаются, их ошибки возвращаются в ParseErrors вместе с метриками остальных строк.
+func Parse(r io.Reader) ([]metricPkg.Metric, error) {
+
+	var (
+		metrics    []metricPkg.Metric
+		parseErrs  ParseErrors
+		types      = make(map[string]string)
+		histograms = make(map[string]*histogramSeries)
+		order      []string
+	)
+
+	scan := bufio.NewScanner(r)
+	line := 0
+
+	for scan.Scan() {
+		line++
+		text := strings.TrimSpace(scan.Text())
+
+		if len(text) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(text, "#") {
+			fields := strings.Fields(text)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, value, err := parseSample(text)
+		if err != nil {
+			parseErrs = append(parseErrs, ParseError{Line: line, Err: err})
+			continue
+		}
+
+		family, suffix := familyOf(name, types)
+
+		switch types[family] {
+		case metricPkg.HistogramType:
+			key, series, errSeries := histogramOf(histograms, family, labels, suffix)
+			if errSeries != nil {
+				parseErrs = append(parseErrs, ParseError{Line: line, Err: errSeries})
+				continue
+			}
+
+			if series.line == 0 {
+				series.line = line
+				order = append(order, key)
+			}
+
+			switch suffix {
+			case "_bucket":
+				bound, _ := strconv.ParseFloat(labels["le"], 64)
+				series.buckets[bound] = value
+			case "_sum":
+				series.sum = value
+			case "_count":
+				series.count = value
+			}
+
+		case metricPkg.CounterType:
+			if value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+				parseErrs = append(parseErrs, ParseError{Line: line, Err: fmt.Errorf("invalid counter value %v of %s", value, name)})
+				continue
+			}
+
+			m, errCreate := metricPkg.CreateMetric(metricPkg.CounterType, name,
+				metricPkg.WithValueInt(int64(value)), metricPkg.WithLabels(labels))
+			if errCreate != nil {
+				parseErrs = append(parseErrs, ParseError{Line: line, Err: errCreate})
+				continue
+			}
+			metrics = append(metrics, m)
+
+		case "summary":
+			if _, quantile := labels["quantile"]; quantile {
+				continue
+			}
+			fallthrough
+
+		default:
+			if math.IsInf(value, 0) || math.IsNaN(value) {
+				parseErrs = append(parseErrs, ParseError{Line: line, Err: fmt.Errorf("invalid gauge value %v of %s", value, name)})
+				continue
+			}
+
+			m, errCreate := metricPkg.CreateMetric(metricPkg.GaugeType, name,
+				metricPkg.WithValueFloat(value), metricPkg.WithLabels(labels))
+			if errCreate != nil {
+				parseErrs = append(parseErrs, ParseError{Line: line, Err: errCreate})
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	if err := scan.Err(); err != nil {
+		return metrics, err
+	}
+
+	for _, key := range order {
+		series := histograms[key]
+
+		m, err := series.metric()
+		if err != nil {
+			parseErrs = append(parseErrs, ParseError{Line: series.line, Err: err})
+			continue
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	if len(parseErrs) > 0 {
+		sort.SliceStable(parseErrs, func(i, j int) bool { return parseErrs[i].Line < parseErrs[j].Line })
+		return metrics, parseErrs
+	}
+
+	return metrics, nil
+}
+
+// familyOf Имя семейства строки и суффикс (_bucket, _sum, _count, _total), если семейство объявлено в # TYPE
+func familyOf(name string, types map[string]string) (string, string) {
+
+	if _, ok := types[name]; ok {
+		return name, ""
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		family := strings.TrimSuffix(name, suffix)
+		if _, ok := types[family]; ok && family != name {
+			return family, suffix
+		}
+	}
+
+	return name, ""
+}
+
+// histogramOf Серия гистограммы для строки с метками labels без метки le
+func histogramOf(histograms map[string]*histogramSeries, family string, labels map[string]string, suffix string) (string, *histogramSeries, error) {
+
+	if suffix != "_bucket" && suffix != "_sum" && suffix != "_count" {
+		return "", nil, fmt.Errorf("unexpected sample %s%s of histogram", family, suffix)
+	}
+
+	seriesLabels := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if name != "le" {
+			seriesLabels[name] = value
+		}
+	}
+
+	if suffix == "_bucket" {
+		if _, err := strconv.ParseFloat(labels["le"], 64); err != nil {
+			return "", nil, fmt.Errorf("invalid bucket bound %q of histogram %s", labels["le"], family)
+		}
+	}
+
+	m := metricPkg.Metric{ID: family, Labels: seriesLabels}
+	key := m.SeriesKey()
+
+	series, ok := histograms[key]
+	if !ok {
+		series = &histogramSeries{name: family, labels: seriesLabels, buckets: make(map[float64]float64)}
+		histograms[key] = series
+	}
+
+	return key, series, nil
+}
+
+// metric Гистограмма из накопительных корзин
+func (series histogramSeries) metric() (metricPkg.Metric, error) {
+
+	bounds := make([]float64, 0, len(series.buckets))
+	for bound := range series.buckets {
+		if !math.IsInf(bound, 1) {
+			bounds = append(bounds, bound)
+		}
+	}
+	sort.Float64s(bounds)
+
+	if math.IsInf(series.sum, 0) || math.IsNaN(series.sum) {
+		return metricPkg.Metric{}, fmt.Errorf("invalid histogram sum %v of %s", series.sum, series.name)
+	}
+
+	h := metricPkg.Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+		Sum:    series.sum,
+		Count:  uint64(series.count),
+	}
+
+	var previous uint64
+	for i, bound := range bounds {
+		cumulative := uint64(series.buckets[bound])
+		if cumulative < previous {
+			return metricPkg.Metric{}, fmt.Errorf("histogram %s buckets are not cumulative", series.name)
+		}
+
+		h.Counts[i] = cumulative - previous
+		previous = cumulative
+	}
+
+	if h.Count < previous {
+		return metricPkg.Metric{}, fmt.Errorf("histogram %s count is less than buckets", series.name)
+	}
+	h.Counts[len(bounds)] = h.Count - previous
+
+	return metricPkg.CreateMetric(metricPkg.HistogramType, series.name,
+		metricPkg.WithHistogram(h), metricPkg.WithLabels(series.labels))
+}
+
+// parseSample Разбор строки значения: <имя>{<метки>} <значение> [<метка времени>]
+func parseSample(text string) (string, map[string]string, float64, error) {
+
+	end := strings.IndexAny(text, "{ \t")
+	if end <= 0 {
+		return "", nil, 0, errors.New("sample has no value")
+	}
+
+	name := text[:end]
+	if SanitizeName(name) != name {
+		return "", nil, 0, fmt.Errorf("invalid metric name %q", name)
+	}
+
+	rest := text[end:]
+
+	var labels map[string]string
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		labels, rest, err = parseLabels(rest[1:])
+		if err != nil {
+			return "", nil, 0, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) != 1 && len(fields) != 2 {
+		return "", nil, 0, fmt.Errorf("sample %s must have a value and an optional timestamp", name)
+	}
+
+	value, err := parseFloat(fields[0])
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid value %q of %s", fields[0], name)
+	}
+
+	return name, labels, value, nil
+}
+
+// parseLabels Разбор меток до закрывающей скобки, возвращает остаток строки после нее
+func parseLabels(text string) (map[string]string, string, error) {
+
+	labels := make(map[string]string)
+
+	for {
+		text = strings.TrimLeft(text, " \t")
+
+		if strings.HasPrefix(text, "}") {
+			return labels, text[1:], nil
+		}
+
+		eq := strings.IndexByte(text, '=')
+		if eq <= 0 {
+			return nil, "", errors.New("invalid label")
+		}
+
+		name := strings.TrimSpace(text[:eq])
+		if SanitizeLabelName(name) != name {
+			return nil, "", fmt.Errorf("invalid label name %q", name)
+		}
+
+		text = strings.TrimLeft(text[eq+1:], " \t")
+		if !strings.HasPrefix(text, `"`) {
+			return nil, "", fmt.Errorf("label %s value must be quoted", name)
+		}
+
+		value, rest, err := unquoteLabelValue(text[1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("label %s: %w", name, err)
+		}
+
+		labels[name] = value
+
+		text = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(text, ",") {
+			text = text[1:]
+		} else if !strings.HasPrefix(text, "}") {
+			return nil, "", errors.New("labels must be separated by comma")
+		}
+	}
+}
+
+// unquoteLabelValue Значение метки до закрывающей кавычки с раскрытием \\, \" и \n
+func unquoteLabelValue(text string) (string, string, error) {
+
+	var builder strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			return builder.String(), text[i+1:], nil
+
+		case '\\':
+			if i+1 == len(text) {
+				return "", "", errors.New("unterminated escape")
+			}
+
+			i++
+			switch text[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			case '\\', '"':
+				builder.WriteByte(text[i])
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", text[i])
+			}
+
+		default:
+			builder.WriteByte(text[i])
+		}
+	}
+
+	return "", "", errors.New("unterminated value")
+}
+
+// parseFloat Разбор значения, включая +Inf, -Inf и NaN
+func parseFloat(text string) (float64, error) {
+
+	switch text {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+
+	return strconv.ParseFloat(text, 64)
+}
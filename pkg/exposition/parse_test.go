@@ -0,0 +1,102 @@
+package exposition
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+func TestParse_RoundTrip(t *testing.T) {
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, testMetrics(), FormatText))
+
+	parsed, err := Parse(&buf)
+	require.NoError(t, err)
+	require.Len(t, parsed, 3)
+
+	byName := make(map[string]metricPkg.Metric)
+	for _, m := range parsed {
+		byName[m.ID] = m
+	}
+
+	gauge := byName["HeapAlloc"]
+	assert.Equal(t, metricPkg.GaugeType, gauge.MType)
+	assert.Equal(t, 1.5, *gauge.Value)
+	assert.Equal(t, map[string]string{"host": "web-1", "path": "C:\\tmp\n\"x\""}, gauge.Labels)
+
+	counter := byName["PollCount"]
+	assert.Equal(t, metricPkg.CounterType, counter.MType)
+	assert.Equal(t, int64(7), *counter.Delta)
+
+	histogram := byName["latency_seconds"]
+	require.NotNil(t, histogram.Histogram)
+	assert.Equal(t, []float64{0.1, 1}, histogram.Histogram.Bounds)
+	assert.Equal(t, []uint64{2, 1, 1}, histogram.Histogram.Counts)
+	assert.Equal(t, 3.5, histogram.Histogram.Sum)
+	assert.Equal(t, uint64(4), histogram.Histogram.Count)
+}
+
+func TestParse_Text(t *testing.T) {
+
+	text := `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.25
+untyped_value{dc="eu"} 3 1666000000000
+# TYPE requests counter
+requests_total{code="200", method="GET"} 1027
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.2
+rpc_duration_seconds_sum 17.5
+rpc_duration_seconds_count 42
+`
+
+	parsed, err := Parse(strings.NewReader(text))
+	require.NoError(t, err)
+
+	got := make(map[string]metricPkg.Metric)
+	for _, m := range parsed {
+		got[m.SeriesKey()] = m
+	}
+
+	assert.Len(t, got, 5)
+	assert.Equal(t, 0.25, *got["node_load1"].Value)
+	assert.Equal(t, 3.0, *got[`untyped_value{dc="eu"}`].Value)
+	assert.Equal(t, int64(1027), *got[`requests_total{code="200",method="GET"}`].Delta)
+	assert.Equal(t, 17.5, *got["rpc_duration_seconds_sum"].Value)
+	assert.Equal(t, 42.0, *got["rpc_duration_seconds_count"].Value)
+}
+
+func TestParse_Errors(t *testing.T) {
+
+	text := `valid 1
+1invalid 2
+no_value
+bad_label{a=1} 3
+unterminated{a="x} 4
+# TYPE negative counter
+negative -5
+also_valid{a="b"} 2
+not_a_number NaN
+infinite +Inf
+`
+
+	parsed, err := Parse(strings.NewReader(text))
+	require.Len(t, parsed, 2)
+
+	var parseErrs ParseErrors
+	require.True(t, errors.As(err, &parseErrs))
+	require.Len(t, parseErrs, 7)
+
+	lines := make([]int, 0, len(parseErrs))
+	for _, e := range parseErrs {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{2, 3, 4, 5, 7, 9, 10}, lines)
+}
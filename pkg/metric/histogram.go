@@ -0,0 +1,219 @@
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"metrics-and-alerting/pkg/errs"
+)
+
+// Histogram Распределение значений по корзинам
+// Counts содержит количество наблюдений в каждой корзине (не накопительно):
+// Counts[i] - наблюдения в интервале (Bounds[i-1], Bounds[i]], последний элемент - наблюдения больше Bounds[len-1].
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы корзин по возрастанию
+	Counts []uint64  `json:"counts"` // количество наблюдений в корзинах, len(Counts) = len(Bounds) + 1
+	Sum    float64   `json:"sum"`    // сумма наблюдений
+	Count  uint64    `json:"count"`  // количество наблюдений
+}
+
+// NewHistogram Создание пустой гистограммы с границами корзин bounds
+func NewHistogram(bounds []float64) (*Histogram, error) {
+
+	h := &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Validate Проверка согласованности гистограммы
+func (h Histogram) Validate() error {
+
+	for i := 1; i < len(h.Bounds); i++ {
+		if h.Bounds[i] <= h.Bounds[i-1] {
+			return fmt.Errorf("%w: histogram bounds must be sorted in ascending order", errs.ErrInvalidValue)
+		}
+	}
+
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: histogram must have %d buckets", errs.ErrInvalidValue, len(h.Bounds)+1)
+	}
+
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+
+	if total != h.Count {
+		return fmt.Errorf("%w: histogram count does not match buckets", errs.ErrInvalidValue)
+	}
+
+	return nil
+}
+
+// Observe Добавление наблюдения в гистограмму
+func (h *Histogram) Observe(value float64) {
+
+	idx := sort.SearchFloat64s(h.Bounds, value)
+
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += value
+}
+
+// Merge Сложение двух гистограмм с одинаковыми границами корзин
+func (h Histogram) Merge(other Histogram) (Histogram, error) {
+
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return Histogram{}, errs.ErrBucketsMismatch
+	}
+
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return Histogram{}, errs.ErrBucketsMismatch
+		}
+	}
+
+	merged := Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: make([]uint64, len(h.Counts)),
+		Sum:    h.Sum + other.Sum,
+		Count:  h.Count + other.Count,
+	}
+
+	for i := range h.Counts {
+		merged.Counts[i] = h.Counts[i] + other.Counts[i]
+	}
+
+	return merged, nil
+}
+
+// Copy Глубокая копия гистограммы
+func (h Histogram) Copy() *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// String Гистограмма в виде строки
+// Возвращаемая строка имеет формат: bounds=<b1>,<b2>;counts=<c1>,<c2>,<c3>;sum=<sum>;count=<count>
+func (h Histogram) String() string {
+
+	bounds := make([]string, 0, len(h.Bounds))
+	for _, b := range h.Bounds {
+		bounds = append(bounds, strconv.FormatFloat(b, 'f', -1, 64))
+	}
+
+	counts := make([]string, 0, len(h.Counts))
+	for _, c := range h.Counts {
+		counts = append(counts, strconv.FormatUint(c, 10))
+	}
+
+	return fmt.Sprintf("bounds=%s;counts=%s;sum=%s;count=%d",
+		strings.Join(bounds, ","),
+		strings.Join(counts, ","),
+		strconv.FormatFloat(h.Sum, 'f', -1, 64),
+		h.Count)
+}
+
+// ParseHistogram Разбор гистограммы из строки формата Histogram.String
+func ParseHistogram(data string) (*Histogram, error) {
+
+	h := &Histogram{}
+	fields := make(map[string]string, 4)
+
+	for _, part := range strings.Split(data, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, errs.ErrInvalidValue
+		}
+
+		fields[kv[0]] = kv[1]
+	}
+
+	if len(fields["bounds"]) > 0 {
+		for _, b := range strings.Split(fields["bounds"], ",") {
+			bound, err := strconv.ParseFloat(b, 64)
+			if err != nil {
+				return nil, errs.ErrInvalidValue
+			}
+
+			h.Bounds = append(h.Bounds, bound)
+		}
+	}
+
+	for _, c := range strings.Split(fields["counts"], ",") {
+		count, err := strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			return nil, errs.ErrInvalidValue
+		}
+
+		h.Counts = append(h.Counts, count)
+	}
+
+	sum, err := strconv.ParseFloat(fields["sum"], 64)
+	if err != nil {
+		return nil, errs.ErrInvalidValue
+	}
+
+	count, err := strconv.ParseUint(fields["count"], 10, 64)
+	if err != nil {
+		return nil, errs.ErrInvalidValue
+	}
+
+	h.Sum = sum
+	h.Count = count
+
+	if errValidate := h.Validate(); errValidate != nil {
+		return nil, errValidate
+	}
+
+	return h, nil
+}
+
+// WithHistogram Опция конструктора метрики - инициализация гистограммы
+func WithHistogram(h Histogram) OptionsMetric {
+	return func(metric *Metric) error {
+
+		if metric.MType != HistogramType {
+			return fmt.Errorf("could not create metric: %w", errs.ErrInvalidType)
+		}
+
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("could not create metric: %w", err)
+		}
+
+		metric.Histogram = h.Copy()
+		return nil
+	}
+}
+
+// WithBuckets Опция конструктора метрики - пустая гистограмма с границами корзин bounds
+// Наблюдения добавляются следующими опциями WithValue, WithValueFloat, WithValueInt.
+func WithBuckets(bounds []float64) OptionsMetric {
+	return func(metric *Metric) error {
+
+		if metric.MType != HistogramType {
+			return fmt.Errorf("could not create metric: %w", errs.ErrInvalidType)
+		}
+
+		h, err := NewHistogram(bounds)
+		if err != nil {
+			return fmt.Errorf("could not create metric: %w", err)
+		}
+
+		metric.Histogram = h
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package metric
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics-and-alerting/pkg/errs"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+
+	h, err := NewHistogram([]float64{0.1, 0.5, 1})
+	require.NoError(t, err)
+
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(5), h.Count)
+	assert.InDelta(t, 3.15, h.Sum, 1e-9)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogram_ParseString(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "Valid histogram",
+			data: "bounds=0.1,0.5,1;counts=2,1,1,1;sum=3.15;count=5",
+		},
+		{
+			name: "Without bounds",
+			data: "bounds=;counts=3;sum=6;count=3",
+		},
+		{
+			name:    "Count does not match buckets",
+			data:    "bounds=0.1;counts=1,1;sum=1;count=5",
+			wantErr: true,
+		},
+		{
+			name:    "Bounds not sorted",
+			data:    "bounds=1,0.5;counts=0,0,0;sum=0;count=0",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid format",
+			data:    "123",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ParseHistogram(tt.data)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errs.ErrInvalidValue)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.data, h.String())
+		})
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+
+	a := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7, Count: 3}
+	b := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 9, Count: 5}
+
+	merged, err := a.Merge(b)
+	require.NoError(t, err)
+
+	assert.Equal(t, []uint64{1, 4, 3}, merged.Counts)
+	assert.Equal(t, uint64(8), merged.Count)
+	assert.Equal(t, float64(16), merged.Sum)
+
+	// Исходные гистограммы не изменились
+	assert.Equal(t, []uint64{1, 0, 2}, a.Counts)
+
+	other := Histogram{Bounds: []float64{1, 5}, Counts: []uint64{0, 0, 0}}
+	_, err = a.Merge(other)
+	assert.True(t, errors.Is(err, errs.ErrBucketsMismatch))
+}
+
+func TestMetric_Histogram(t *testing.T) {
+
+	m, err := CreateMetric(HistogramType, "Latency", WithBuckets([]float64{0.1, 1}), WithValueFloat(0.2), WithValue("3"))
+	require.NoError(t, err)
+	require.NotNil(t, m.Histogram)
+	assert.Equal(t, "bounds=0.1,1;counts=0,1,1;sum=3.2;count=2", m.StringValue())
+
+	parsed, err := CreateMetric(HistogramType, "Latency", WithValue(m.StringValue()))
+	require.NoError(t, err)
+	assert.Equal(t, m.Histogram, parsed.Histogram)
+
+	hash, err := m.Sign([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, hash)
+
+	_, err = CreateMetric(HistogramType, "Latency", WithValueFloat(1))
+	assert.ErrorIs(t, err, errs.ErrInvalidValue)
+
+	_, err = CreateMetric(GaugeType, "Latency", WithBuckets([]float64{1}))
+	assert.ErrorIs(t, err, errs.ErrInvalidType)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,19 +13,22 @@ import (
 )
 
 const (
-	GaugeType   string = "gauge"
-	CounterType string = "counter"
+	GaugeType     string = "gauge"
+	CounterType   string = "counter"
+	HistogramType string = "histogram"
 )
 
 type (
 	OptionsMetric func(*Metric) error
 
 	Metric struct {
-		ID    string   `json:"id"`              // имя метрики
-		MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-		Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-		Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-		Hash  string   `json:"hash,omitempty"`  // значение метрики
+		ID        string            `json:"id"`                  // имя метрики
+		MType     string            `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+		Delta     *int64            `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+		Value     *float64          `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+		Histogram *Histogram        `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+		Hash      string            `json:"hash,omitempty"`      // значение метрики
+		Labels    map[string]string `json:"labels,omitempty"`    // метки метрики, вместе с именем определяют серию
 	}
 )
 
@@ -76,6 +80,22 @@ func WithValue(data string) OptionsMetric {
 			}
 			metric.Delta = &val
 
+		case HistogramType:
+			// Значение - гистограмма в формате Histogram.String,
+			// либо одно наблюдение, если границы корзин заданы опцией WithBuckets
+			if metric.Histogram != nil {
+				if val, err := strconv.ParseFloat(data, 64); err == nil {
+					metric.Histogram.Observe(val)
+					return nil
+				}
+			}
+
+			h, err := ParseHistogram(data)
+			if err != nil {
+				return fmt.Errorf("could not create metric: %w", err)
+			}
+			metric.Histogram = h
+
 		default:
 			return fmt.Errorf("could not create metric: %w", errs.ErrUnknownType)
 		}
@@ -86,6 +106,7 @@ func WithValue(data string) OptionsMetric {
 
 // WithValueFloat Опция конструктора метрики - инициализация значения метрики
 // Подходит для всех типов метрик, значение value конвертируется при необходимости в int64.
+// Для гистограммы value добавляется как наблюдение, границы корзин должны быть заданы опцией WithBuckets.
 func WithValueFloat(value float64) OptionsMetric {
 	return func(metric *Metric) error {
 
@@ -97,6 +118,12 @@ func WithValueFloat(value float64) OptionsMetric {
 			val := int64(value)
 			metric.Delta = &val
 
+		case HistogramType:
+			if metric.Histogram == nil {
+				return fmt.Errorf("could not change data metric: %w", errs.ErrInvalidValue)
+			}
+			metric.Histogram.Observe(value)
+
 		default:
 			return fmt.Errorf("could not change data metric: %w", errs.ErrUnknownType)
 		}
@@ -107,6 +134,7 @@ func WithValueFloat(value float64) OptionsMetric {
 
 // WithValueInt Опция конструктора метрики - инициализация значения метрики
 // Подходит для всех типов метрик, значение value конвертируется при необходимости в float64.
+// Для гистограммы value добавляется как наблюдение, границы корзин должны быть заданы опцией WithBuckets.
 func WithValueInt(value int64) OptionsMetric {
 	return func(metric *Metric) error {
 
@@ -118,6 +146,12 @@ func WithValueInt(value int64) OptionsMetric {
 		case CounterType:
 			metric.Delta = &value
 
+		case HistogramType:
+			if metric.Histogram == nil {
+				return fmt.Errorf("could not change data metric: %w", errs.ErrInvalidValue)
+			}
+			metric.Histogram.Observe(float64(value))
+
 		default:
 			return fmt.Errorf("could not change data metric: %w", errs.ErrUnknownType)
 		}
@@ -126,8 +160,79 @@ func WithValueInt(value int64) OptionsMetric {
 	}
 }
 
+// WithLabels Опция конструктора метрики - инициализация меток метрики
+func WithLabels(labels map[string]string) OptionsMetric {
+	return func(metric *Metric) error {
+
+		if len(labels) == 0 {
+			return nil
+		}
+
+		metric.Labels = make(map[string]string, len(labels))
+
+		for name, value := range labels {
+			if len(name) == 0 {
+				return fmt.Errorf("could not create metric: %w", errs.ErrInvalidLabel)
+			}
+
+			metric.Labels[name] = value
+		}
+
+		return nil
+	}
+}
+
+// SeriesKey Каноническое имя серии метрики
+// Возвращаемая строка имеет формат: <id>{<label>="<value>",...} с метками, отсортированными по имени.
+// Для метрики без меток возвращается <id>.
+func (metric Metric) SeriesKey() string {
+
+	if len(metric.Labels) == 0 {
+		return metric.ID
+	}
+
+	names := make([]string, 0, len(metric.Labels))
+	for name := range metric.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builder := strings.Builder{}
+	builder.WriteString(metric.ID)
+	builder.WriteString("{")
+
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+
+		builder.WriteString(name)
+		builder.WriteString("=")
+		builder.WriteString(strconv.Quote(metric.Labels[name]))
+	}
+
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// SameSeries Проверка, что метрики относятся к одной серии: совпадают тип, имя и метки
+func (metric Metric) SameSeries(other Metric) bool {
+
+	if metric.MType != other.MType || metric.ID != other.ID || len(metric.Labels) != len(other.Labels) {
+		return false
+	}
+
+	for name, value := range metric.Labels {
+		if otherValue, ok := other.Labels[name]; !ok || otherValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Sign Подпись метрики
-// Данные метрики преобразуются в строку формата <id>:<type>:<value>
+// Данные метрики преобразуются в строку формата <series>:<type>:<value>, где <series> - результат SeriesKey,
 // и при помощи алгоритка SHA256 и ключа key вычиляется хеш метрики
 func (metric Metric) Sign(key []byte) (string, error) {
 
@@ -144,7 +249,7 @@ func (metric Metric) Sign(key []byte) (string, error) {
 		}
 
 		src = fmt.Sprintf("%s:%s:%d",
-			metric.ID,
+			metric.SeriesKey(),
 			metric.MType,
 			*metric.Delta)
 
@@ -154,9 +259,20 @@ func (metric Metric) Sign(key []byte) (string, error) {
 		}
 
 		src = fmt.Sprintf("%s:%s:%f",
-			metric.ID,
+			metric.SeriesKey(),
 			metric.MType,
 			*metric.Value)
+
+	case HistogramType:
+		if metric.Histogram == nil {
+			return ``, errs.ErrInvalidValue
+		}
+
+		src = fmt.Sprintf("%s:%s:%s",
+			metric.SeriesKey(),
+			metric.MType,
+			metric.Histogram.String())
+
 	default:
 		return ``, errs.ErrUnknownType
 	}
@@ -189,11 +305,41 @@ func (metric Metric) Map() map[string]string {
 		if metric.Delta != nil {
 			data["value"] = strconv.FormatInt(*metric.Delta, 10)
 		}
+
+	case HistogramType:
+		if metric.Histogram != nil {
+			data["value"] = metric.Histogram.String()
+		}
 	}
 
 	return data
 }
 
+// FloatValue Значение метрики в виде числа
+// Для гистограммы возвращается количество наблюдений.
+// Второе значение - false, если у метрики нет значения.
+func (metric Metric) FloatValue() (float64, bool) {
+
+	switch metric.MType {
+	case GaugeType:
+		if metric.Value != nil {
+			return *metric.Value, true
+		}
+
+	case CounterType:
+		if metric.Delta != nil {
+			return float64(*metric.Delta), true
+		}
+
+	case HistogramType:
+		if metric.Histogram != nil {
+			return float64(metric.Histogram.Count), true
+		}
+	}
+
+	return 0, false
+}
+
 // StringValue Преобразование значения метрики в строку
 func (metric Metric) StringValue() string {
 	switch metric.MType {
@@ -206,19 +352,24 @@ func (metric Metric) StringValue() string {
 		if metric.Delta != nil {
 			return strconv.FormatInt(*metric.Delta, 10)
 		}
+
+	case HistogramType:
+		if metric.Histogram != nil {
+			return metric.Histogram.String()
+		}
 	}
 
 	return ``
 }
 
 // ShotString Данные метрики в виде строки в компактном виде
-// Возвращаемая строка имеет формат: <type>/<id>/<value>
+// Возвращаемая строка имеет формат: <type>/<series>/<value>
 func (metric Metric) ShotString() string {
 	builder := strings.Builder{}
 
 	builder.WriteString(metric.MType)
 	builder.WriteString(" / ")
-	builder.WriteString(metric.ID)
+	builder.WriteString(metric.SeriesKey())
 	builder.WriteString(" / ")
 
 	switch metric.MType {
@@ -231,6 +382,11 @@ func (metric Metric) ShotString() string {
 		if metric.Delta != nil {
 			builder.WriteString(fmt.Sprintf("%d", *metric.Delta))
 		}
+
+	case HistogramType:
+		if metric.Histogram != nil {
+			builder.WriteString(fmt.Sprintf("count=%d sum=%f", metric.Histogram.Count, metric.Histogram.Sum))
+		}
 	}
 
 	return builder.String()
@@ -245,6 +401,7 @@ func (metric Metric) String() string {
 	builder.WriteString("\n")
 	builder.WriteString(fmt.Sprintf("\t ID: %s\n", metric.ID))
 	builder.WriteString(fmt.Sprintf("\t TYPE: %s\n", metric.MType))
+	builder.WriteString(fmt.Sprintf("\t LABELS: %v\n", metric.Labels))
 	builder.WriteString(fmt.Sprintf("\t HASH: %s\n", metric.Hash))
 
 	if metric.Delta != nil {
@@ -259,5 +416,9 @@ func (metric Metric) String() string {
 		builder.WriteString("\t VALUE: nil\n")
 	}
 
+	if metric.Histogram != nil {
+		builder.WriteString(fmt.Sprintf("\t HISTOGRAM: %s\n", metric.Histogram.String()))
+	}
+
 	return builder.String()
 }
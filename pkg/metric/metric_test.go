@@ -0,0 +1,75 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric_SeriesKey(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{
+			name: "Without labels",
+			want: "Alloc",
+		},
+		{
+			name:   "Labels sorted by name",
+			labels: map[string]string{"instance": "a1", "host": "web-1"},
+			want:   `Alloc{host="web-1",instance="a1"}`,
+		},
+		{
+			name:   "Label value escaped",
+			labels: map[string]string{"path": `C:\"tmp"`},
+			want:   `Alloc{path="C:\\\"tmp\""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := CreateMetric(GaugeType, "Alloc", WithValueFloat(1), WithLabels(tt.labels))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m.SeriesKey())
+		})
+	}
+}
+
+func TestMetric_SameSeries(t *testing.T) {
+
+	host1, _ := CreateMetric(GaugeType, "Alloc", WithLabels(map[string]string{"host": "web-1"}))
+	host2, _ := CreateMetric(GaugeType, "Alloc", WithLabels(map[string]string{"host": "web-2"}))
+	plain, _ := CreateMetric(GaugeType, "Alloc")
+	counter, _ := CreateMetric(CounterType, "Alloc", WithLabels(map[string]string{"host": "web-1"}))
+
+	assert.True(t, host1.SameSeries(host1))
+	assert.False(t, host1.SameSeries(host2))
+	assert.False(t, host1.SameSeries(plain))
+	assert.False(t, host1.SameSeries(counter))
+	assert.True(t, plain.SameSeries(Metric{ID: "Alloc", MType: GaugeType, Labels: map[string]string{}}))
+}
+
+func TestMetric_SignLabels(t *testing.T) {
+
+	key := []byte("secret")
+
+	plain, _ := CreateMetric(CounterType, "PollCount", WithValueInt(5))
+	labeled, _ := CreateMetric(CounterType, "PollCount", WithValueInt(5), WithLabels(map[string]string{"host": "web-1"}))
+
+	plainHash, err := plain.Sign(key)
+	require.NoError(t, err)
+
+	labeledHash, err := labeled.Sign(key)
+	require.NoError(t, err)
+
+	// Подпись метрики без меток не изменилась: <id>:<type>:<value>
+	assert.Equal(t, "6c9fe43102c73262035842e922b81e40252f73e8033185cff20136451bd3e692", plainHash)
+	assert.NotEqual(t, plainHash, labeledHash)
+
+	_, err = CreateMetric(GaugeType, "Alloc", WithLabels(map[string]string{"": "x"}))
+	assert.Error(t, err)
+}
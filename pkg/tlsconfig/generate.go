@@ -0,0 +1,141 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// KeyPair Сертификат и закрытый ключ
+type KeyPair struct {
+	Cert    *x509.Certificate
+	Key     *ecdsa.PrivateKey
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// NewCA Создание самоподписанного сертификата CA для локального тестирования
+func NewCA(commonName string, validFor time.Duration) (*KeyPair, error) {
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	return newKeyPair(template, nil, validFor)
+}
+
+// NewServerCert Создание сертификата сервера для адресов и имен hosts, подписанного ca
+func NewServerCert(ca *KeyPair, hosts []string, validFor time.Duration) (*KeyPair, error) {
+
+	template := &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if len(host) == 0 {
+			continue
+		}
+
+		if len(template.Subject.CommonName) == 0 {
+			template.Subject.CommonName = host
+		}
+
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	if len(template.Subject.CommonName) == 0 {
+		return nil, fmt.Errorf("server certificate requires at least one host")
+	}
+
+	return newKeyPair(template, ca, validFor)
+}
+
+// NewClientCert Создание сертификата клиента commonName, подписанного ca
+func NewClientCert(ca *KeyPair, commonName string, validFor time.Duration) (*KeyPair, error) {
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	return newKeyPair(template, ca, validFor)
+}
+
+// WriteFiles Запись сертификата и ключа в файлы в формате PEM
+func (kp *KeyPair) WriteFiles(certFile, keyFile string) error {
+
+	if err := ioutil.WriteFile(certFile, kp.CertPEM, 0644); err != nil {
+		return fmt.Errorf("could not write certificate: %w", err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, kp.KeyPEM, 0600); err != nil {
+		return fmt.Errorf("could not write key: %w", err)
+	}
+
+	return nil
+}
+
+// newKeyPair Создание ключа и сертификата по шаблону template, подписанного parent.
+// Если parent не задан, сертификат самоподписанный.
+func newKeyPair(template *x509.Certificate, parent *KeyPair, validFor time.Duration) (*KeyPair, error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("could not generate serial number: %w", err)
+	}
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(validFor)
+
+	signCert, signKey := template, key
+	if parent != nil {
+		signCert, signKey = parent.Cert, parent.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signCert, &key.PublicKey, signKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode key: %w", err)
+	}
+
+	return &KeyPair{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
@@ -0,0 +1,96 @@
+// Package tlsconfig Настройка TLS и взаимной аутентификации (mTLS) для серверов и клиентов
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// Server Настройка TLS сервера по сертификату certFile и ключу keyFile.
+// Если задан clientCAFile, сервер принимает только клиентов с сертификатом, подписанным этим CA.
+// Если сертификат не задан, возвращает nil - соединения без TLS.
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+
+	if len(certFile) == 0 && len(keyFile) == 0 {
+		if len(clientCAFile) > 0 {
+			return nil, fmt.Errorf("client CA requires server certificate and key")
+		}
+
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(clientCAFile) > 0 {
+		pool, errPool := loadPool(clientCAFile)
+		if errPool != nil {
+			return nil, errPool
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// Client Настройка TLS клиента.
+// caFile - CA для проверки сертификата сервера, если не задан - используются системные CA.
+// certFile и keyFile - сертификат клиента для взаимной аутентификации.
+// Если ни один файл не задан, возвращает nil - соединения без TLS.
+func Client(caFile, certFile, keyFile string) (*tls.Config, error) {
+
+	if len(caFile) == 0 && len(certFile) == 0 && len(keyFile) == 0 {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(caFile) > 0 {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// loadPool Чтение сертификатов CA в формате PEM
+func loadPool(file string) (*x509.CertPool, error) {
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
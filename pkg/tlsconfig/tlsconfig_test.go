@@ -0,0 +1,102 @@
+package tlsconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCerts Создание CA, сертификатов сервера и клиента в каталоге dir
+func writeCerts(t *testing.T, dir string) {
+
+	ca, err := NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, ca.WriteFiles(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")))
+
+	serverCert, err := NewServerCert(ca, []string{"localhost", "127.0.0.1"}, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, serverCert.WriteFiles(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")))
+
+	clientCert, err := NewClientCert(ca, "agent", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, clientCert.WriteFiles(filepath.Join(dir, "agent.crt"), filepath.Join(dir, "agent.key")))
+}
+
+func TestMutualTLS(t *testing.T) {
+
+	dir := t.TempDir()
+	writeCerts(t, dir)
+
+	serverCfg, err := Server(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		ca      string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{name: "client certificate", ca: "ca.crt", cert: "agent.crt", key: "agent.key"},
+		{name: "without client certificate", ca: "ca.crt", wantErr: true},
+		{name: "unknown server CA", cert: "agent.crt", key: "agent.key", wantErr: true},
+		// Сертификат сервера не подходит для аутентификации клиента
+		{name: "server certificate as client", ca: "ca.crt", cert: "server.crt", key: "server.key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			path := func(name string) string {
+				if len(name) == 0 {
+					return ""
+				}
+				return filepath.Join(dir, name)
+			}
+
+			clientCfg, errCfg := Client(path(tt.ca), path(tt.cert), path(tt.key))
+			require.NoError(t, errCfg)
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+			resp, errResp := client.Get(srv.URL)
+			if tt.wantErr {
+				assert.Error(t, errResp)
+				return
+			}
+
+			require.NoError(t, errResp)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestConfig_Disabled(t *testing.T) {
+
+	cfg, err := Server("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = Client("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = Server("", "", "ca.crt")
+	assert.Error(t, err)
+
+	_, err = Server("missing.crt", "missing.key", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package proto
+
+import (
+	"fmt"
+
+	"metrics-and-alerting/pkg/errs"
+	metricPkg "metrics-and-alerting/pkg/metric"
+)
+
+// ToMetric Преобразование сообщения в метрику
+func ToMetric(in *Metric) (metricPkg.Metric, error) {
+
+	if in == nil {
+		return metricPkg.Metric{}, fmt.Errorf("could not convert metric: %w", errs.ErrInvalidValue)
+	}
+
+	opts := []metricPkg.OptionsMetric{metricPkg.WithLabels(in.Labels)}
+
+	switch in.Type {
+	case metricPkg.GaugeType:
+		opts = append(opts, metricPkg.WithValueFloat(in.Value))
+
+	case metricPkg.CounterType:
+		opts = append(opts, metricPkg.WithValueInt(in.Delta))
+
+	case metricPkg.HistogramType:
+		if in.Histogram == nil {
+			return metricPkg.Metric{}, fmt.Errorf("could not convert metric %s: %w", in.Id, errs.ErrInvalidValue)
+		}
+
+		opts = append(opts, metricPkg.WithHistogram(metricPkg.Histogram{
+			Bounds: in.Histogram.Bounds,
+			Counts: in.Histogram.Counts,
+			Sum:    in.Histogram.Sum,
+			Count:  in.Histogram.Count,
+		}))
+
+	default:
+		return metricPkg.Metric{}, fmt.Errorf("could not convert metric %s: %w", in.Id, errs.ErrUnknownType)
+	}
+
+	m, err := metricPkg.CreateMetric(in.Type, in.Id, opts...)
+	if err != nil {
+		return metricPkg.Metric{}, err
+	}
+
+	m.Hash = in.Hash
+	return m, nil
+}
+
+// FromMetric Преобразование метрики в сообщение
+func FromMetric(m metricPkg.Metric) *Metric {
+
+	out := &Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Hash:   m.Hash,
+		Labels: m.Labels,
+	}
+
+	if m.Delta != nil {
+		out.Delta = *m.Delta
+	}
+
+	if m.Value != nil {
+		out.Value = *m.Value
+	}
+
+	if m.Histogram != nil {
+		out.Histogram = &Histogram{
+			Bounds: m.Histogram.Bounds,
+			Counts: m.Histogram.Counts,
+			Sum:    m.Histogram.Sum,
+			Count:  m.Histogram.Count,
+		}
+	}
+
+	return out
+}
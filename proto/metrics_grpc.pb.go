@@ -25,6 +25,11 @@ const _ = grpc.SupportPackageIsVersion7
 type MetricsClient interface {
 	UpsertGauge(ctx context.Context, in *UpsertGaugeRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	UpsertCounter(ctx context.Context, in *UpsertCounterRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	UpsertBatch(ctx context.Context, in *UpsertBatchRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (Metrics_StreamMetricsClient, error)
+	GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*Metric, error)
+	ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error)
 }
 
 type metricsClient struct {
@@ -53,12 +58,110 @@ func (c *metricsClient) UpsertCounter(ctx context.Context, in *UpsertCounterRequ
 	return out, nil
 }
 
+func (c *metricsClient) UpsertBatch(ctx context.Context, in *UpsertBatchRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/UpsertBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (Metrics_StreamMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[0], "/metrics.Metrics/StreamMetrics", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsStreamMetricsClient{stream}
+	return x, nil
+}
+
+type Metrics_StreamMetricsClient interface {
+	Send(*Metric) error
+	CloseAndRecv() (*StreamMetricsResponse, error)
+	grpc.ClientStream
+}
+
+type metricsStreamMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsStreamMetricsClient) Send(m *Metric) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricsStreamMetricsClient) CloseAndRecv() (*StreamMetricsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamMetricsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricsClient) GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/GetMetric", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	out := new(ListMetricsResponse)
+	err := c.cc.Invoke(ctx, "/metrics.Metrics/ListMetrics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[1], "/metrics.Metrics/WatchMetrics", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsWatchMetricsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Metrics_WatchMetricsClient interface {
+	Recv() (*Metric, error)
+	grpc.ClientStream
+}
+
+type metricsWatchMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsWatchMetricsClient) Recv() (*Metric, error) {
+	m := new(Metric)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility
 type MetricsServer interface {
 	UpsertGauge(context.Context, *UpsertGaugeRequest) (*emptypb.Empty, error)
 	UpsertCounter(context.Context, *UpsertCounterRequest) (*emptypb.Empty, error)
+	UpsertBatch(context.Context, *UpsertBatchRequest) (*emptypb.Empty, error)
+	StreamMetrics(Metrics_StreamMetricsServer) error
+	GetMetric(context.Context, *GetMetricRequest) (*Metric, error)
+	ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error)
+	WatchMetrics(*WatchMetricsRequest, Metrics_WatchMetricsServer) error
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -72,6 +175,21 @@ func (UnimplementedMetricsServer) UpsertGauge(context.Context, *UpsertGaugeReque
 func (UnimplementedMetricsServer) UpsertCounter(context.Context, *UpsertCounterRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpsertCounter not implemented")
 }
+func (UnimplementedMetricsServer) UpsertBatch(context.Context, *UpsertBatchRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpsertBatch not implemented")
+}
+func (UnimplementedMetricsServer) StreamMetrics(Metrics_StreamMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricsServer) GetMetric(context.Context, *GetMetricRequest) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
+}
+func (UnimplementedMetricsServer) ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedMetricsServer) WatchMetrics(*WatchMetricsRequest, Metrics_WatchMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchMetrics not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 
 // UnsafeMetricsServer may be embedded to opt out of forward compatibility for this service.
@@ -121,6 +239,107 @@ func _Metrics_UpsertCounter_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_UpsertBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpsertBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).UpsertBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/UpsertBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).UpsertBatch(ctx, req.(*UpsertBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServer).StreamMetrics(&metricsStreamMetricsServer{stream})
+}
+
+type Metrics_StreamMetricsServer interface {
+	SendAndClose(*StreamMetricsResponse) error
+	Recv() (*Metric, error)
+	grpc.ServerStream
+}
+
+type metricsStreamMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsStreamMetricsServer) SendAndClose(m *StreamMetricsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricsStreamMetricsServer) Recv() (*Metric, error) {
+	m := new(Metric)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Metrics_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).GetMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/GetMetric",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).GetMetric(ctx, req.(*GetMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/metrics.Metrics/ListMetrics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).ListMetrics(ctx, req.(*ListMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_WatchMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchMetricsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServer).WatchMetrics(m, &metricsWatchMetricsServer{stream})
+}
+
+type Metrics_WatchMetricsServer interface {
+	Send(*Metric) error
+	grpc.ServerStream
+}
+
+type metricsWatchMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsWatchMetricsServer) Send(m *Metric) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -136,7 +355,30 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpsertCounter",
 			Handler:    _Metrics_UpsertCounter_Handler,
 		},
+		{
+			MethodName: "UpsertBatch",
+			Handler:    _Metrics_UpsertBatch_Handler,
+		},
+		{
+			MethodName: "GetMetric",
+			Handler:    _Metrics_GetMetric_Handler,
+		},
+		{
+			MethodName: "ListMetrics",
+			Handler:    _Metrics_ListMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _Metrics_StreamMetrics_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchMetrics",
+			Handler:       _Metrics_WatchMetrics_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metrics.proto",
 }